@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"unicode/utf8"
+)
+
+const (
+	// discordMessageLimit is the most characters discord accepts in a message
+	discordMessageLimit = 2000
+	// maxTemplateLength keeps templates themselves readable in the config listing
+	maxTemplateLength = 500
+)
+
+// defaultAnnounceTemplate is used by guilds that haven't set their own
+const defaultAnnounceTemplate = "{{.OwnerName}} is now live at {{.URL}}{{if .Title}}\n> {{.Title}}{{end}}"
+
+// announceData is everything a template can use
+type announceData struct {
+	OwnerName   string
+	URL         string
+	Title       string
+	Game        string
+	ViewerCount int
+	Platform    string
+}
+
+// sampleAnnounceData fills in previews and validation
+var sampleAnnounceData = announceData{
+	OwnerName:   "halkeye",
+	URL:         "https://www.twitch.tv/halkeye",
+	Title:       "Building a discord bot",
+	Game:        "Science & Technology",
+	ViewerCount: 42,
+	Platform:    "Twitch",
+}
+
+func newAnnounceData(stream *Stream, status liveStatus) announceData {
+	return announceData{
+		OwnerName:   stream.OwnerDisplayName(),
+		URL:         stream.URL(),
+		Title:       status.Title,
+		Game:        status.Game,
+		ViewerCount: status.ViewerCount,
+		Platform:    stream.Type.String(),
+	}
+}
+
+// announceTemplateFuncs are the only functions templates can call, on top of the
+// comparison builtins in allowedTemplateBuiltins
+var announceTemplateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+var allowedTemplateBuiltins = map[string]bool{
+	"and": true, "or": true, "not": true,
+	"eq": true, "ne": true, "lt": true, "le": true, "gt": true, "ge": true,
+}
+
+// parseAnnounceTemplate parses a guild's template, only allowing fields, if/else
+// and a few simple functions so templates can't loop or call into anything else
+func parseAnnounceTemplate(text string) (*template.Template, error) {
+	if utf8.RuneCountInString(text) > maxTemplateLength {
+		return nil, fmt.Errorf("Templates can be at most %d characters", maxTemplateLength)
+	}
+	tmpl, err := template.New("announce").Funcs(announceTemplateFuncs).Parse(text)
+	if err != nil {
+		return nil, errors.New("That template doesn't parse: " + strings.TrimPrefix(err.Error(), "template: "))
+	}
+	if len(tmpl.Templates()) > 1 {
+		return nil, errors.New("Templates can't define other templates")
+	}
+	err = checkTemplateNode(tmpl.Tree.Root)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+func checkTemplateNode(node parse.Node) error {
+	switch n := node.(type) {
+	case nil:
+		return nil
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			err := checkTemplateNode(child)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case *parse.TextNode, *parse.FieldNode, *parse.DotNode, *parse.StringNode,
+		*parse.NumberNode, *parse.BoolNode, *parse.NilNode:
+		return nil
+	case *parse.ActionNode:
+		return checkTemplateNode(n.Pipe)
+	case *parse.IfNode:
+		return checkBranchNode(&n.BranchNode)
+	case *parse.WithNode:
+		return checkBranchNode(&n.BranchNode)
+	case *parse.PipeNode:
+		if n == nil {
+			return nil
+		}
+		if len(n.Decl) > 0 {
+			return errors.New("Templates can't set variables")
+		}
+		for _, cmd := range n.Cmds {
+			err := checkTemplateNode(cmd)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			err := checkTemplateNode(arg)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case *parse.IdentifierNode:
+		if _, ok := announceTemplateFuncs[n.Ident]; ok || allowedTemplateBuiltins[n.Ident] {
+			return nil
+		}
+		return errors.New("Templates can't use " + n.Ident)
+	}
+	return fmt.Errorf("Templates can't use %s", node)
+}
+
+func checkBranchNode(n *parse.BranchNode) error {
+	for _, child := range []parse.Node{n.Pipe, n.List, n.ElseList} {
+		err := checkTemplateNode(child)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errTemplateTooLong stops rendering once the output can't fit in a message
+var errTemplateTooLong = errors.New("Template output is too long")
+
+// limitedBuffer refuses writes past its limit so templates can't grow without bound
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.limit {
+		b.Buffer.Write(p[:b.limit-b.Len()])
+		return 0, errTemplateTooLong
+	}
+	return b.Buffer.Write(p)
+}
+
+// renderAnnounceTemplate renders a template, cutting it down to fit in limit characters
+func renderAnnounceTemplate(text string, data announceData, limit int) (string, error) {
+	if text == "" {
+		text = defaultAnnounceTemplate
+	}
+	tmpl, err := parseAnnounceTemplate(text)
+	if err != nil {
+		return "", err
+	}
+
+	// utf8 runes are at most 4 bytes, so this always holds limit characters
+	out := &limitedBuffer{limit: limit * utf8.UTFMax}
+	err = tmpl.Execute(out, data)
+	if err != nil && !errors.Is(err, errTemplateTooLong) {
+		return "", errors.New("That template doesn't render: " + strings.TrimPrefix(err.Error(), "template: "))
+	}
+
+	message := strings.TrimSpace(truncateText(out.String(), limit))
+	if message == "" {
+		return "", errors.New("That template renders an empty message")
+	}
+	return message, nil
+}
+
+// truncateText cuts text down to limit characters, marking that it was cut
+func truncateText(text string, limit int) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:limit-1]) + "…"
+}
+
+// validateAnnounceTemplate is used when admins set a template, it must render the sample
+func validateAnnounceTemplate(ctx *commandContext, value string) (interface{}, error) {
+	_, err := renderAnnounceTemplate(value, sampleAnnounceData, discordMessageLimit)
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func init() {
+	commands.Register(&command{
+		Name:        "preview",
+		Usage:       "[\"template\"]",
+		Description: "Shows what a go-live announcement will look like",
+		GuildOnly:   true,
+		ManageGuild: true,
+		Run:         previewCommand,
+	})
+}
+
+func previewCommand(ctx *commandContext) error {
+	text := strings.Join(ctx.Args, " ")
+	if text == "" {
+		guild, err := ctx.App.Store.GetGuild(ctx.GuildID)
+		if err != nil {
+			return err
+		}
+		text = guild.AnnounceTemplate
+	}
+
+	data := sampleAnnounceData
+	data.OwnerName = ctx.Author.Username
+	if ctx.Member != nil && ctx.Member.Nick != "" {
+		data.OwnerName = ctx.Member.Nick
+	}
+	message, err := renderAnnounceTemplate(text, data, discordMessageLimit)
+	if err != nil {
+		ctx.Reply(err.Error())
+		return nil
+	}
+	ctx.Reply(message)
+	return nil
+}
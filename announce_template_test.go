@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRenderAnnounceTemplate(t *testing.T) {
+	items := [][]interface{}{
+		// template, rendered or "" for an error
+		[]interface{}{"", "halkeye is now live at https://www.twitch.tv/halkeye\n> Building a discord bot"},
+		[]interface{}{"{{.OwnerName}} is playing {{.Game}} for {{.ViewerCount}} viewers", "halkeye is playing Science & Technology for 42 viewers"},
+		[]interface{}{"{{upper .Platform}}! {{if gt .ViewerCount 10}}busy{{else}}quiet{{end}}", "TWITCH! busy"},
+		[]interface{}{"{{with .Title}}{{.}}{{end}}", "Building a discord bot"},
+		[]interface{}{"{{.Nope}}", ""},
+		[]interface{}{"{{.OwnerName", ""},
+		[]interface{}{"{{range .OwnerName}}x{{end}}", ""},
+		[]interface{}{`{{printf "%s" .URL}}`, ""},
+		[]interface{}{`{{define "x"}}x{{end}}`, ""},
+		[]interface{}{"{{$x := .URL}}{{$x}}", ""},
+		[]interface{}{"{{if false}}x{{end}}", ""},
+		[]interface{}{strings.Repeat("x", maxTemplateLength+1), ""},
+	}
+
+	for _, item := range items {
+		got, err := renderAnnounceTemplate(item[0].(string), sampleAnnounceData, discordMessageLimit)
+		if item[1].(string) == "" {
+			if err == nil {
+				t.Errorf("renderAnnounceTemplate(%q) = %q; want an error", item[0].(string), got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("renderAnnounceTemplate(%q) got an error: %s", item[0].(string), err)
+		}
+		if got != item[1].(string) {
+			t.Errorf("renderAnnounceTemplate(%q) = %q; want %q", item[0].(string), got, item[1].(string))
+		}
+	}
+}
+
+func TestRenderAnnounceTemplateLimit(t *testing.T) {
+	data := sampleAnnounceData
+	data.Title = strings.Repeat("é", 3000)
+
+	got, err := renderAnnounceTemplate("{{.Title}}{{.Title}}", data, discordMessageLimit)
+	if err != nil {
+		t.Fatalf("renderAnnounceTemplate() got an error: %s", err)
+	}
+	if utf8.RuneCountInString(got) != discordMessageLimit || !strings.HasSuffix(got, "…") {
+		t.Errorf("renderAnnounceTemplate() is %d characters; want it cut to %d", utf8.RuneCountInString(got), discordMessageLimit)
+	}
+}
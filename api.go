@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/getsentry/raven-go"
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+)
+
+// apiPrefix is where the current version of the api is mounted
+const apiPrefix = "/api/v1"
+
+// apiError is an error the api shows to the caller with its status code
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e apiError) Error() string {
+	return e.Message
+}
+
+// apiErrorBody is what every error response looks like
+type apiErrorBody struct {
+	Error string `json:"error"`
+}
+
+type apiGuild struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type apiStream struct {
+	ID          int64      `json:"id"`
+	GuildID     string     `json:"guild_id"`
+	OwnerID     string     `json:"owner_id"`
+	OwnerName   string     `json:"owner_name"`
+	Type        string     `json:"type"`
+	URL         string     `json:"url"`
+	Live        bool       `json:"live"`
+	LiveSince   *time.Time `json:"live_since,omitempty"`
+	Title       string     `json:"title,omitempty"`
+	Game        string     `json:"game,omitempty"`
+	ViewerCount int        `json:"viewer_count"`
+}
+
+type apiAddStream struct {
+	URL string `json:"url"`
+}
+
+func newAPIStream(stream Stream) apiStream {
+	s := apiStream{
+		ID:        stream.ID,
+		GuildID:   stream.GuildID,
+		OwnerID:   stream.OwnerID,
+		OwnerName: stream.OwnerDisplayName(),
+		Type:      stream.Type.String(),
+		URL:       stream.URL(),
+		Live:      stream.Live,
+	}
+	if stream.Live {
+		liveSince := stream.LiveSince
+		s.LiveSince = &liveSince
+		s.Title = stream.Title
+		s.Game = stream.Game
+		s.ViewerCount = stream.ViewerCount
+	}
+	return s
+}
+
+// apiCaller is who made an api request
+type apiCaller struct {
+	User *discordgo.User
+	// Guilds are the guilds the caller can use, by id
+	Guilds map[string]apiGuild
+	// Token is set when the caller used an api token instead of logging in
+	Token *APIToken
+}
+
+// Guild returns the guild if the caller can use it, otherwise a 404 so guild ids can't be probed
+func (c *apiCaller) Guild(guildID string) (apiGuild, error) {
+	guild, ok := c.Guilds[guildID]
+	if !ok {
+		return apiGuild{}, apiError{http.StatusNotFound, "Guild not found"}
+	}
+	return guild, nil
+}
+
+// apiRoute is one endpoint, the openapi spec is generated from these
+type apiRoute struct {
+	Method  string
+	Path    string
+	Summary string
+	// Status is returned on success, it defaults to 200
+	Status int
+	// Request is an example of the json body, if there is one
+	Request interface{}
+	// Response is an example of what is returned, if anything
+	Response interface{}
+	Handle   func(r *http.Request, caller *apiCaller) (interface{}, error)
+}
+
+// apiCallerKey is where apiAuthMiddleware keeps the caller in the request context
+type apiCallerKey struct{}
+
+// apiAuthMiddleware authenticates every api request. Read-only tokens can only make GET requests,
+// and changes made with the dashboard login have to come from the dashboard.
+func (a *App) apiAuthMiddleware(authenticate func(r *http.Request) (*apiCaller, error)) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			caller, err := authenticate(r)
+			if err != nil {
+				writeAPIError(w, err)
+				return
+			}
+			if caller.Token == nil && r.Method != "GET" && !sameOriginJSON(r) {
+				writeAPIError(w, apiError{http.StatusForbidden, "Changes made with a dashboard login have to be json sent from " + viper.GetString("self_url")})
+				return
+			}
+			if caller.Token != nil {
+				if r.Method != "GET" && !caller.Token.CanWrite() {
+					writeAPIError(w, apiError{http.StatusForbidden, "This api token is read-only"})
+					return
+				}
+				a.touchAPIToken(caller.Token, time.Now())
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiCallerKey{}, caller)))
+		})
+	}
+}
+
+// sameOriginJSON checks a request is json sent by our own pages. Browsers send the
+// login cookie along with requests from any site, but other sites can't set the
+// origin and need permission to send json.
+func sameOriginJSON(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return false
+	}
+	selfURL, err := url.Parse(viper.GetString("self_url"))
+	if err != nil || selfURL.Host == "" {
+		return false
+	}
+	return r.Header.Get("Origin") == selfURL.Scheme+"://"+selfURL.Host
+}
+
+// apiRoutes lists every endpoint of the api
+func (a *App) apiRoutes() []apiRoute {
+	return []apiRoute{
+		apiRoute{
+			Method:   "GET",
+			Path:     "/guilds",
+			Summary:  "Lists the guilds you share with the bot",
+			Response: []apiGuild{},
+			Handle:   apiListGuilds,
+		},
+		apiRoute{
+			Method:   "GET",
+			Path:     "/guilds/{guildID}/streams",
+			Summary:  "Lists a guild's streams and whether they are live",
+			Response: []apiStream{},
+			Handle:   a.apiListStreams,
+		},
+		apiRoute{
+			Method:   "POST",
+			Path:     "/guilds/{guildID}/streams",
+			Summary:  "Adds one of your streams to a guild",
+			Status:   http.StatusCreated,
+			Request:  apiAddStream{},
+			Response: apiStream{},
+			Handle:   a.apiAddStreamHandler,
+		},
+		apiRoute{
+			Method:  "DELETE",
+			Path:    "/guilds/{guildID}/streams/{streamID}",
+			Summary: "Removes one of your streams from a guild",
+			Status:  http.StatusNoContent,
+			Handle:  a.apiDeleteStream,
+		},
+	}
+}
+
+// registerAPI mounts the api and its openapi spec on the router
+func (a *App) registerAPI(r *mux.Router) {
+	routes := a.apiRoutes()
+	r.HandleFunc(apiPrefix+"/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, openAPISpec(routes))
+	}).Methods("GET")
+
+	api := r.PathPrefix(apiPrefix).Subrouter()
+	api.Use(a.apiAuthMiddleware(a.apiAuthenticate))
+	for _, route := range routes {
+		api.Handle(route.Path, apiHandler(route)).Methods(route.Method)
+	}
+}
+
+// apiHandler runs the route for the caller apiAuthMiddleware found and writes what it returned as json
+func apiHandler(route apiRoute) http.Handler {
+	return http.HandlerFunc(raven.RecoveryHandler(func(w http.ResponseWriter, r *http.Request) {
+		caller, ok := r.Context().Value(apiCallerKey{}).(*apiCaller)
+		if !ok {
+			writeAPIError(w, apiError{http.StatusUnauthorized, "Log in or send an api token"})
+			return
+		}
+		out, err := route.Handle(r, caller)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if status == http.StatusNoContent {
+			w.WriteHeader(status)
+			return
+		}
+		writeJSON(w, status, out)
+	}))
+}
+
+func writeJSON(w http.ResponseWriter, status int, out interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(out)
+	if err != nil {
+		log.Error("Error writing api response", err)
+	}
+}
+
+// writeAPIError hides anything that isn't an apiError behind a 500
+func writeAPIError(w http.ResponseWriter, err error) {
+	if e, ok := err.(apiError); ok {
+		writeJSON(w, e.Status, apiErrorBody{e.Message})
+		return
+	}
+	raven.CaptureErrorAndWait(err, nil)
+	log.Error("Error handling api request", err)
+	writeJSON(w, http.StatusInternalServerError, apiErrorBody{"Something went wrong"})
+}
+
+// bearerToken returns the token from an Authorization: Bearer header
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) < len("Bearer ") || !strings.EqualFold(header[:len("Bearer ")], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(header[len("Bearer "):])
+}
+
+// apiAuthenticate accepts an api token or the dashboard's discord login
+func (a *App) apiAuthenticate(r *http.Request) (*apiCaller, error) {
+	if token := bearerToken(r); token != "" {
+		return a.tokenCaller(token)
+	}
+	if accessToken := a.getDiscordAccessTokenFromSession(r); accessToken != "" {
+		return a.sessionCaller(accessToken)
+	}
+	return nil, apiError{http.StatusUnauthorized, "Log in or send an api token"}
+}
+
+func (a *App) tokenCaller(token string) (*apiCaller, error) {
+	apiToken, err := a.findAPIToken(token)
+	if err == errNotFound {
+		return nil, apiError{http.StatusUnauthorized, "That api token isn't valid"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cached, ok := a.Guilds.Get(apiToken.GuildID)
+	if !ok {
+		// the bot has left the guild the token was made for
+		return nil, apiError{http.StatusUnauthorized, "That api token isn't valid"}
+	}
+	guild := apiGuild{ID: apiToken.GuildID, Name: cached.Name}
+	return &apiCaller{
+		User:   &discordgo.User{ID: apiToken.OwnerID, Username: apiToken.OwnerName},
+		Guilds: map[string]apiGuild{guild.ID: guild},
+		Token:  apiToken,
+	}, nil
+}
+
+func (a *App) sessionCaller(accessToken string) (*apiCaller, error) {
+	login, ok := a.Logins.Get(accessToken, time.Now())
+	if !ok {
+		clientDG, err := a.UserDiscord(accessToken)
+		if err != nil {
+			return nil, err
+		}
+
+		login.User, err = clientDG.User("@me")
+		if err != nil {
+			log.Info("Unable to use the session's discord token", err)
+			return nil, apiError{http.StatusUnauthorized, "Your discord login has expired"}
+		}
+		login.Guilds, err = allUserGuilds(clientDG)
+		if err != nil {
+			return nil, err
+		}
+		a.Logins.Set(accessToken, login, time.Now())
+	}
+
+	// checked every time, the bot may have left a guild since the login was cached
+	caller := &apiCaller{User: login.User, Guilds: map[string]apiGuild{}}
+	for _, guild := range login.Guilds {
+		if a.Guilds.Has(guild.ID) {
+			caller.Guilds[guild.ID] = apiGuild{ID: guild.ID, Name: guild.Name}
+		}
+	}
+	return caller, nil
+}
+
+// userGuildsPageSize is the most guilds discord returns at once
+const userGuildsPageSize = 200
+
+// allUserGuilds pages through every guild a dashboard user is in
+func allUserGuilds(client discordUser) ([]*discordgo.UserGuild, error) {
+	guilds := []*discordgo.UserGuild{}
+	after := ""
+	for {
+		page, err := client.UserGuilds(userGuildsPageSize, "", after, false)
+		if err != nil {
+			return nil, err
+		}
+		guilds = append(guilds, page...)
+		if len(page) < userGuildsPageSize {
+			return guilds, nil
+		}
+		after = page[len(page)-1].ID
+	}
+}
+
+func apiListGuilds(r *http.Request, caller *apiCaller) (interface{}, error) {
+	guilds := []apiGuild{}
+	for _, guild := range caller.Guilds {
+		guilds = append(guilds, guild)
+	}
+	sort.Slice(guilds, func(i, j int) bool { return guilds[i].Name < guilds[j].Name })
+	return guilds, nil
+}
+
+func (a *App) apiListStreams(r *http.Request, caller *apiCaller) (interface{}, error) {
+	guild, err := caller.Guild(mux.Vars(r)["guildID"])
+	if err != nil {
+		return nil, err
+	}
+
+	streams, err := a.Store.GuildStreams(guild.ID)
+	if err != nil {
+		return nil, err
+	}
+	out := []apiStream{}
+	for _, stream := range streams {
+		out = append(out, newAPIStream(stream))
+	}
+	return out, nil
+}
+
+func (a *App) apiAddStreamHandler(r *http.Request, caller *apiCaller) (interface{}, error) {
+	guild, err := caller.Guild(mux.Vars(r)["guildID"])
+	if err != nil {
+		return nil, err
+	}
+
+	var body apiAddStream
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || body.URL == "" {
+		return nil, apiError{http.StatusBadRequest, "Send the stream's url as {\"url\": \"...\"}"}
+	}
+
+	// the caller only has an id and username, the member has the names and avatar to save
+	member, err := a.Discord.GuildMember(guild.ID, caller.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := a.addStream(guild.ID, member.User, member.Nick, body.URL)
+	if invalid, ok := err.(invalidStreamError); ok {
+		return nil, apiError{http.StatusUnprocessableEntity, invalid.Error()}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newAPIStream(*stream), nil
+}
+
+func (a *App) apiDeleteStream(r *http.Request, caller *apiCaller) (interface{}, error) {
+	guild, err := caller.Guild(mux.Vars(r)["guildID"])
+	if err != nil {
+		return nil, err
+	}
+	streamID, err := strconv.ParseInt(mux.Vars(r)["streamID"], 10, 64)
+	if err != nil {
+		return nil, apiError{http.StatusNotFound, "Stream not found"}
+	}
+
+	stream, err := a.Store.GetStream(streamID)
+	if err == errNotFound || (err == nil && (stream.GuildID != guild.ID || stream.OwnerID != caller.User.ID)) {
+		return nil, apiError{http.StatusNotFound, "Stream not found"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, a.deleteStream(*stream)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiPathParam finds the {name} parameters in a route's path
+var apiPathParam = regexp.MustCompile(`{([^}:]+)}`)
+
+// openAPISpec describes the routes as an openapi 3 document
+func openAPISpec(routes []apiRoute) map[string]interface{} {
+	schemas := map[string]interface{}{}
+	errorResponse := map[string]interface{}{
+		"description": "Error",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": openAPISchema(reflect.TypeOf(apiErrorBody{}), schemas)},
+		},
+	}
+
+	paths := map[string]interface{}{}
+	for _, route := range routes {
+		operation := map[string]interface{}{
+			"summary":     route.Summary,
+			"operationId": strings.ToLower(route.Method) + strings.Replace(strings.Title(apiPathParam.ReplaceAllString(route.Path, "")), "/", "", -1),
+		}
+
+		params := []interface{}{}
+		for _, match := range apiPathParam.FindAllStringSubmatch(route.Path, -1) {
+			params = append(params, map[string]interface{}{
+				"name":     match[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+
+		if route.Request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": openAPISchema(reflect.TypeOf(route.Request), schemas)},
+				},
+			}
+		}
+
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := map[string]interface{}{"description": http.StatusText(status)}
+		if route.Response != nil {
+			success["content"] = map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": openAPISchema(reflect.TypeOf(route.Response), schemas)},
+			}
+		}
+		operation["responses"] = map[string]interface{}{
+			strconv.Itoa(status): success,
+			"default":            errorResponse,
+		}
+
+		path := apiPrefix + route.Path
+		if _, ok := paths[path]; !ok {
+			paths[path] = map[string]interface{}{}
+		}
+		paths[path].(map[string]interface{})[strings.ToLower(route.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Discord Streamers",
+			"version": Version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"session": map[string]interface{}{
+					"type":        "apiKey",
+					"in":          "cookie",
+					"name":        sessionStoreKey,
+					"description": "The dashboard login. Anything but GET also needs a json Content-Type and an Origin of this site.",
+				},
+				"token": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"session": []string{}},
+			map[string]interface{}{"token": []string{}},
+		},
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// openAPISchema describes a go type, structs are added to schemas and referenced by name
+func openAPISchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	if t.Kind() == reflect.Ptr {
+		return openAPISchema(t.Elem(), schemas)
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": openAPISchema(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": openAPISchema(t.Elem(), schemas)}
+	case reflect.Struct:
+		name := strings.TrimPrefix(t.Name(), "api")
+		if _, ok := schemas[name]; !ok {
+			// add it first so types that refer to themselves don't loop
+			schemas[name] = map[string]interface{}{}
+			properties := map[string]interface{}{}
+			required := []string{}
+			for i := 0; i < t.NumField(); i++ {
+				field := t.Field(i)
+				tag := strings.Split(field.Tag.Get("json"), ",")
+				if tag[0] == "-" || field.PkgPath != "" {
+					continue
+				}
+				fieldName := tag[0]
+				if fieldName == "" {
+					fieldName = field.Name
+				}
+				properties[fieldName] = openAPISchema(field.Type, schemas)
+				if len(tag) == 1 && field.Type.Kind() != reflect.Ptr {
+					required = append(required, fieldName)
+				}
+			}
+			schema := map[string]interface{}{"type": "object", "properties": properties}
+			if len(required) > 0 {
+				schema["required"] = required
+			}
+			schemas[name] = schema
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
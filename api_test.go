@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+)
+
+func TestBearerToken(t *testing.T) {
+	items := [][]interface{}{
+		[]interface{}{"Bearer abc123", "abc123"},
+		[]interface{}{"bearer  abc123 ", "abc123"},
+		[]interface{}{"Basic abc123", ""},
+		[]interface{}{"Bearer", ""},
+		[]interface{}{"", ""},
+	}
+
+	for _, item := range items {
+		r := httptest.NewRequest("GET", "/api/v1/guilds", nil)
+		r.Header.Set("Authorization", item[0].(string))
+		if got := bearerToken(r); got != item[1].(string) {
+			t.Errorf("bearerToken(%q) = %q; want %q", item[0].(string), got, item[1].(string))
+		}
+	}
+}
+
+func TestAPIHandler(t *testing.T) {
+	caller := &apiCaller{Guilds: map[string]apiGuild{"guild": apiGuild{ID: "guild", Name: "Guild"}}}
+	loggedIn := func(r *http.Request) (*apiCaller, error) { return caller, nil }
+	loggedOut := func(r *http.Request) (*apiCaller, error) {
+		return nil, apiError{http.StatusUnauthorized, "Log in or send an api token"}
+	}
+	// recently used so the test doesn't need a database to record it
+	readOnly := func(r *http.Request) (*apiCaller, error) {
+		return &apiCaller{Guilds: caller.Guilds, Token: &APIToken{Scope: apiScopeRead, LastUsedAt: time.Now()}}, nil
+	}
+	readWrite := func(r *http.Request) (*apiCaller, error) {
+		return &apiCaller{Guilds: caller.Guilds, Token: &APIToken{Scope: apiScopeReadWrite, LastUsedAt: time.Now()}}, nil
+	}
+	created := apiRoute{Status: 201, Handle: func(r *http.Request, caller *apiCaller) (interface{}, error) {
+		return caller.Guild("guild")
+	}}
+
+	items := [][]interface{}{
+		// route, authenticate, method, status, body
+		[]interface{}{apiRoute{Handle: apiListGuilds}, loggedIn, "GET", 200, `[{"id":"guild","name":"Guild"}]`},
+		[]interface{}{apiRoute{Handle: apiListGuilds}, loggedOut, "GET", 401, `{"error":"Log in or send an api token"}`},
+		[]interface{}{apiRoute{Handle: apiListGuilds}, readOnly, "GET", 200, `[{"id":"guild","name":"Guild"}]`},
+		[]interface{}{created, loggedIn, "POST", 201, `{"id":"guild","name":"Guild"}`},
+		[]interface{}{created, readOnly, "POST", 403, `{"error":"This api token is read-only"}`},
+		[]interface{}{created, readWrite, "POST", 201, `{"id":"guild","name":"Guild"}`},
+		[]interface{}{apiRoute{Handle: func(r *http.Request, caller *apiCaller) (interface{}, error) {
+			return caller.Guild("someone-elses")
+		}}, loggedIn, "GET", 404, `{"error":"Guild not found"}`},
+		[]interface{}{apiRoute{Handle: func(r *http.Request, caller *apiCaller) (interface{}, error) {
+			return nil, errors.New("database is down")
+		}}, loggedIn, "GET", 500, `{"error":"Something went wrong"}`},
+		[]interface{}{apiRoute{Status: 204, Handle: func(r *http.Request, caller *apiCaller) (interface{}, error) {
+			return nil, nil
+		}}, loggedIn, "DELETE", 204, ``},
+	}
+
+	viper.Set("self_url", "https://streamers.example.com/")
+	defer viper.Set("self_url", "")
+	for idx, item := range items {
+		w := httptest.NewRecorder()
+		handler := (&App{}).apiAuthMiddleware(item[1].(func(r *http.Request) (*apiCaller, error)))(apiHandler(item[0].(apiRoute)))
+		r := httptest.NewRequest(item[2].(string), "/", nil)
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("Origin", "https://streamers.example.com")
+		handler.ServeHTTP(w, r)
+		if w.Code != item[3].(int) {
+			t.Errorf("route %d returned %d; want %d", idx, w.Code, item[3].(int))
+		}
+		if strings.TrimSpace(w.Body.String()) != item[4].(string) {
+			t.Errorf("route %d returned %s; want %s", idx, w.Body.String(), item[4].(string))
+		}
+	}
+}
+
+func TestAPISessionCrossSite(t *testing.T) {
+	viper.Set("self_url", "https://streamers.example.com/")
+	defer viper.Set("self_url", "")
+	loggedIn := func(r *http.Request) (*apiCaller, error) { return &apiCaller{}, nil }
+	withToken := func(r *http.Request) (*apiCaller, error) {
+		return &apiCaller{Token: &APIToken{Scope: apiScopeReadWrite, LastUsedAt: time.Now()}}, nil
+	}
+	route := apiRoute{Status: 204, Handle: func(r *http.Request, caller *apiCaller) (interface{}, error) {
+		return nil, nil
+	}}
+
+	items := [][]interface{}{
+		// authenticate, method, content type, origin, status
+		[]interface{}{loggedIn, "POST", "application/json", "https://streamers.example.com", 204},
+		[]interface{}{loggedIn, "DELETE", "application/json; charset=utf-8", "https://streamers.example.com", 204},
+		[]interface{}{loggedIn, "POST", "application/x-www-form-urlencoded", "https://streamers.example.com", 403},
+		[]interface{}{loggedIn, "POST", "text/plain", "https://evil.example.com", 403},
+		[]interface{}{loggedIn, "POST", "application/json", "https://evil.example.com", 403},
+		[]interface{}{loggedIn, "POST", "application/json", "", 403},
+		[]interface{}{loggedIn, "GET", "", "https://evil.example.com", 204},
+		[]interface{}{withToken, "POST", "text/plain", "", 204},
+	}
+
+	for _, item := range items {
+		w := httptest.NewRecorder()
+		handler := (&App{}).apiAuthMiddleware(item[0].(func(r *http.Request) (*apiCaller, error)))(apiHandler(route))
+		r := httptest.NewRequest(item[1].(string), "/", nil)
+		r.Header.Set("Content-Type", item[2].(string))
+		if item[3].(string) != "" {
+			r.Header.Set("Origin", item[3].(string))
+		}
+		handler.ServeHTTP(w, r)
+		if w.Code != item[4].(int) {
+			t.Errorf("%s with %q from %q returned %d; want %d", item[1].(string), item[2].(string), item[3].(string), w.Code, item[4].(int))
+		}
+	}
+}
+
+func TestTokenCaller(t *testing.T) {
+	app, _ := newTestApp(t, nil)
+	app.Guilds.Set(&Guild{ID: "joined", Name: "Streamers"})
+	for _, token := range []*APIToken{
+		&APIToken{GuildID: "joined", OwnerID: "o1", Name: "script", TokenHash: hashAPIToken("joined-secret"), Scope: apiScopeRead},
+		&APIToken{GuildID: "left", OwnerID: "o1", Name: "script", TokenHash: hashAPIToken("left-secret"), Scope: apiScopeRead},
+	} {
+		err := app.Store.AddAPIToken(token)
+		if err != nil {
+			t.Fatalf("AddAPIToken() got an error: %s", err)
+		}
+	}
+
+	caller, err := app.tokenCaller("joined-secret")
+	if err != nil || caller.Guilds["joined"].Name != "Streamers" {
+		t.Errorf("tokenCaller(joined) = %+v, %v; want the guild", caller, err)
+	}
+	for _, token := range []string{"left-secret", "unknown"} {
+		_, err = app.tokenCaller(token)
+		if e, ok := err.(apiError); !ok || e.Status != http.StatusUnauthorized {
+			t.Errorf("tokenCaller(%s) error = %v; want a 401", token, err)
+		}
+	}
+}
+
+func TestSessionCaller(t *testing.T) {
+	user := fakeDiscordUser{user: &discordgo.User{ID: "owner", Username: "halkeye"}}
+	for i := 0; i < userGuildsPageSize+10; i++ {
+		user.guilds = append(user.guilds, &discordgo.UserGuild{ID: fmt.Sprintf("%03d", i), Name: "Guild"})
+	}
+	app, _ := newTestApp(t, map[string]fakeDiscordUser{"token": user})
+	app.Guilds.Set(&Guild{ID: "000", Name: "First"})
+	app.Guilds.Set(&Guild{ID: fmt.Sprintf("%03d", userGuildsPageSize+5), Name: "Past the first page"})
+
+	caller, err := app.sessionCaller("token")
+	if err != nil || caller.User.ID != "owner" || len(caller.Guilds) != 2 {
+		t.Fatalf("sessionCaller() = %+v, %v; want both guilds the bot is in", caller, err)
+	}
+
+	// later requests don't ask discord again, but still notice the bot leaving
+	app.UserDiscord = func(accessToken string) (discordUser, error) {
+		return nil, errors.New("discord was asked again")
+	}
+	app.Guilds.Delete("000")
+	caller, err = app.sessionCaller("token")
+	if err != nil || len(caller.Guilds) != 1 {
+		t.Errorf("cached sessionCaller() = %+v, %v; want the guild the bot is still in", caller, err)
+	}
+	if _, err = app.sessionCaller("unknown"); err == nil {
+		t.Errorf("sessionCaller(unknown) got no error")
+	}
+}
+
+func TestAPIAddStreamKeepsNames(t *testing.T) {
+	app, discord := newTestApp(t, nil)
+	app.Guilds.Set(&Guild{ID: "guild", Name: "Streamers"})
+	owner := &discordgo.User{ID: "owner", Username: "halkeye", GlobalName: "Gavin", Avatar: "avatar"}
+	discord.members["guild"] = []*discordgo.Member{&discordgo.Member{User: owner, Nick: "Nick"}}
+	mustAddStream(t, app.Store, Stream{GuildID: "guild", OwnerID: "owner", OwnerName: "halkeye", OwnerGlobalName: "Gavin", OwnerNick: "Nick", OwnerAvatar: "avatar", Type: streamFake, StreamUsername: "halkeye", StreamUserID: "id-halkeye"})
+
+	// api tokens only know the owner's id and username
+	caller := &apiCaller{User: &discordgo.User{ID: "owner", Username: "halkeye"}, Guilds: map[string]apiGuild{"guild": apiGuild{ID: "guild"}}}
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"url": "https://fake.example.com/halkeye"}`))
+	r = mux.SetURLVars(r, map[string]string{"guildID": "guild"})
+	_, err := app.apiAddStreamHandler(r, caller)
+	if err != nil {
+		t.Fatalf("apiAddStreamHandler() got an error: %s", err)
+	}
+	streams, _ := app.Store.GuildStreams("guild")
+	if len(streams) != 1 || streams[0].OwnerNick != "Nick" || streams[0].OwnerGlobalName != "Gavin" || streams[0].OwnerAvatar != "avatar" {
+		t.Errorf("apiAddStreamHandler() left %+v; want the member's names kept", streams)
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	routes := (&App{}).apiRoutes()
+	b, err := json.Marshal(openAPISpec(routes))
+	if err != nil {
+		t.Fatalf("openAPISpec() can't be encoded: %s", err)
+	}
+	var spec struct {
+		Paths      map[string]map[string]json.RawMessage
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]interface{}
+				Required   []string
+			}
+		}
+	}
+	json.Unmarshal(b, &spec)
+
+	for _, route := range routes {
+		if _, ok := spec.Paths[apiPrefix+route.Path][strings.ToLower(route.Method)]; !ok {
+			t.Errorf("openAPISpec() is missing %s %s", route.Method, route.Path)
+		}
+	}
+	stream := spec.Components.Schemas["Stream"]
+	if _, ok := stream.Properties["live_since"]; !ok {
+		t.Errorf("Stream schema = %+v; want live_since", stream)
+	}
+	required := strings.Join(stream.Required, ",")
+	if !strings.Contains(required, "url") || strings.Contains(required, "live_since") || strings.Contains(required, "title") {
+		t.Errorf("Stream required = %s; want url but not live_since or title", required)
+	}
+	if !strings.Contains(string(spec.Paths[apiPrefix+"/guilds/{guildID}/streams/{streamID}"]["delete"]), `"name":"streamID"`) {
+		t.Errorf("delete is missing the streamID parameter")
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/getsentry/raven-go"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"golang.org/x/oauth2"
+)
+
+// discordClient is the part of the bot's discord session the handlers and
+// pollers use, so they can be run in tests against a fake
+type discordClient interface {
+	discordSession
+	ChannelMessageEditComplex(m *discordgo.MessageEdit, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageDelete(channelID, messageID string, options ...discordgo.RequestOption) error
+	GuildMember(guildID, userID string, options ...discordgo.RequestOption) (*discordgo.Member, error)
+	GuildMembers(guildID string, after string, limit int, options ...discordgo.RequestOption) ([]*discordgo.Member, error)
+	GuildMemberRoleAdd(guildID, userID, roleID string, options ...discordgo.RequestOption) error
+	GuildMemberRoleRemove(guildID, userID, roleID string, options ...discordgo.RequestOption) error
+	InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error
+	InteractionResponseEdit(interaction *discordgo.Interaction, newresp *discordgo.WebhookEdit, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	// BotUserID is the bot's own user id, it is empty until the gateway is ready
+	BotUserID() string
+}
+
+// botSession is the real discordClient
+type botSession struct {
+	*discordgo.Session
+}
+
+func (s botSession) BotUserID() string {
+	if s.State == nil || s.State.User == nil {
+		return ""
+	}
+	return s.State.User.ID
+}
+
+// discordUser is what the dashboard asks discord on behalf of a logged in user
+type discordUser interface {
+	User(userID string, options ...discordgo.RequestOption) (*discordgo.User, error)
+	UserGuilds(limit int, beforeID, afterID string, withCounts bool, options ...discordgo.RequestOption) ([]*discordgo.UserGuild, error)
+}
+
+func newDiscordUser(accessToken string) (discordUser, error) {
+	return discordgo.New("Bearer " + accessToken)
+}
+
+// setDiscordAPIURL points discordgo, and the dashboard logins, at another
+// discord api. discordgo builds its endpoints from package vars when it is
+// loaded so they all have to be swapped out.
+func setDiscordAPIURL(apiURL string) {
+	if !strings.HasSuffix(apiURL, "/") {
+		apiURL += "/"
+	}
+	discordgo.EndpointAPI = apiURL
+	discordgo.EndpointGuilds = apiURL + "guilds/"
+	discordgo.EndpointChannels = apiURL + "channels/"
+	discordgo.EndpointUsers = apiURL + "users/"
+	discordgo.EndpointGateway = apiURL + "gateway"
+	discordgo.EndpointGatewayBot = discordgo.EndpointGateway + "/bot"
+	discordgo.EndpointWebhooks = apiURL + "webhooks/"
+	discordgo.EndpointStickers = apiURL + "stickers/"
+	discordgo.EndpointStageInstances = apiURL + "stage-instances"
+	discordgo.EndpointVoice = apiURL + "voice/"
+	discordgo.EndpointVoiceRegions = discordgo.EndpointVoice + "regions"
+	discordgo.EndpointNitroStickersPacks = apiURL + "sticker-packs"
+	discordgo.EndpointGuildCreate = apiURL + "guilds"
+	discordgo.EndpointApplications = apiURL + "applications"
+	discordgo.EndpointOAuth2 = apiURL + "oauth2/"
+	discordgo.EndpointOAuth2Applications = discordgo.EndpointOAuth2 + "applications"
+	discordgo.EndpointOauth2 = discordgo.EndpointOAuth2
+	discordgo.EndpointOauth2Applications = discordgo.EndpointOAuth2Applications
+}
+
+// twitchEvents manages eventsub subscriptions, eventSubClient is the real one
+type twitchEvents interface {
+	Subscribe(broadcasterUserID string) error
+	Unsubscribe(broadcasterUserID string) error
+	Sync(broadcasterUserIDs []string) error
+}
+
+// App is everything the discord handlers, web handlers and pollers share.
+// main builds it from the config, tests build it around fakes.
+type App struct {
+	Store   Store
+	Discord discordClient
+	// Providers looks up and polls streams, it starts as the registered providers
+	Providers map[StreamType]StreamProvider
+	// TwitchEvents is nil when eventsub isn't configured
+	TwitchEvents twitchEvents
+	// EventSubSecret signs the eventsub messages twitch sends to the callback
+	EventSubSecret string
+	Guilds         *guildRegistry
+	Sessions       sessions.Store
+	// Logins remembers who dashboard logins are so api requests don't all ask discord
+	Logins *loginCache
+	OAuth  *oauth2.Config
+	// UserDiscord makes a client that acts as a dashboard user
+	UserDiscord func(accessToken string) (discordUser, error)
+}
+
+func newApp(store Store) *App {
+	providers := map[StreamType]StreamProvider{}
+	for streamType, provider := range streamProviders {
+		providers[streamType] = provider
+	}
+	return &App{
+		Store:       store,
+		Providers:   providers,
+		Guilds:      newGuildRegistry(),
+		Logins:      newLoginCache(),
+		UserDiscord: newDiscordUser,
+	}
+}
+
+// provider returns the platform for a stream type, falling back to the registered one
+func (a *App) provider(streamType StreamType) StreamProvider {
+	if provider, ok := a.Providers[streamType]; ok {
+		return provider
+	}
+	return streamType.Provider()
+}
+
+// Router serves the dashboard, widget and api
+func (a *App) Router() *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/", raven.RecoveryHandler(a.homePageHandler))
+	r.HandleFunc("/start", raven.RecoveryHandler(a.startHandler))
+	r.HandleFunc("/auth-callback", raven.RecoveryHandler(a.authCallbackHandler))
+	r.HandleFunc("/destroy-session", raven.RecoveryHandler(a.sessionDestroyHandler))
+	r.HandleFunc("/streams/{id:[0-9]+}/stats", raven.RecoveryHandler(a.streamStatsHandler))
+	r.HandleFunc("/g/{guildID:[0-9]+}/widget", raven.RecoveryHandler(a.widgetHandler)).Methods("GET")
+	r.HandleFunc("/g/{guildID:[0-9]+}/widget.json", raven.RecoveryHandler(a.widgetJSONHandler)).Methods("GET")
+	r.Handle("/healthcheck", a.healthcheckHandler())
+	a.registerAPI(r)
+	if a.TwitchEvents != nil {
+		r.Handle("/eventsub/twitch", eventSubHandler(a.EventSubSecret, a.onTwitchStreamEvent)).Methods("POST")
+	}
+	r.PathPrefix("/").Handler(http.FileServer(http.Dir("./static/")))
+	return r
+}
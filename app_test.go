@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/gorilla/sessions"
+)
+
+// fakeDiscord is an in-memory discordClient, it remembers what the bot did
+type fakeDiscord struct {
+	fakeSession
+	// members are what GuildMembers returns, by guild id
+	members map[string][]*discordgo.Member
+	// roles records role changes as "+user role" and "-user role"
+	roles   []string
+	complex []*discordgo.MessageSend
+	deleted []string
+	// sendErr makes ChannelMessageSendComplex fail when set
+	sendErr error
+}
+
+func newFakeDiscord() *fakeDiscord {
+	return &fakeDiscord{members: map[string][]*discordgo.Member{}}
+}
+
+func (f *fakeDiscord) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if f.sendErr != nil {
+		return nil, f.sendErr
+	}
+	f.complex = append(f.complex, data)
+	return f.fakeSession.ChannelMessageSendComplex(channelID, data)
+}
+
+func (f *fakeDiscord) ChannelMessageEditComplex(m *discordgo.MessageEdit, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	return &discordgo.Message{ID: m.ID, ChannelID: m.Channel}, nil
+}
+
+func (f *fakeDiscord) ChannelMessageDelete(channelID, messageID string, options ...discordgo.RequestOption) error {
+	f.deleted = append(f.deleted, messageID)
+	return nil
+}
+
+func (f *fakeDiscord) GuildMember(guildID, userID string, options ...discordgo.RequestOption) (*discordgo.Member, error) {
+	for _, member := range f.members[guildID] {
+		if member.User.ID == userID {
+			return member, nil
+		}
+	}
+	return nil, errors.New("Unknown Member")
+}
+
+func (f *fakeDiscord) GuildMembers(guildID string, after string, limit int, options ...discordgo.RequestOption) ([]*discordgo.Member, error) {
+	page := []*discordgo.Member{}
+	for _, member := range f.members[guildID] {
+		if member.User.ID > after && len(page) < limit {
+			page = append(page, member)
+		}
+	}
+	return page, nil
+}
+
+func (f *fakeDiscord) GuildMemberRoleAdd(guildID, userID, roleID string, options ...discordgo.RequestOption) error {
+	f.roles = append(f.roles, "+"+userID+" "+roleID)
+	return nil
+}
+
+func (f *fakeDiscord) GuildMemberRoleRemove(guildID, userID, roleID string, options ...discordgo.RequestOption) error {
+	f.roles = append(f.roles, "-"+userID+" "+roleID)
+	return nil
+}
+
+func (f *fakeDiscord) InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error {
+	return nil
+}
+
+func (f *fakeDiscord) InteractionResponseEdit(interaction *discordgo.Interaction, newresp *discordgo.WebhookEdit, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if newresp.Content != nil {
+		f.sent = append(f.sent, *newresp.Content)
+	}
+	return &discordgo.Message{}, nil
+}
+
+func (f *fakeDiscord) BotUserID() string {
+	return "bot"
+}
+
+// fakeDiscordUser is a dashboard user who is in guilds
+type fakeDiscordUser struct {
+	user   *discordgo.User
+	guilds []*discordgo.UserGuild
+}
+
+func (f fakeDiscordUser) User(userID string, options ...discordgo.RequestOption) (*discordgo.User, error) {
+	return f.user, nil
+}
+
+func (f fakeDiscordUser) UserGuilds(limit int, beforeID, afterID string, withCounts bool, options ...discordgo.RequestOption) ([]*discordgo.UserGuild, error) {
+	page := []*discordgo.UserGuild{}
+	for _, guild := range f.guilds {
+		if guild.ID > afterID && len(page) < limit {
+			page = append(page, guild)
+		}
+	}
+	return page, nil
+}
+
+// testSQLiteStore is a migrated sqlite store that is removed after the test
+func testSQLiteStore(t *testing.T) Store {
+	store, err := newSQLiteStore(filepath.Join(t.TempDir(), "streamers.db"))
+	if err != nil {
+		t.Fatalf("newSQLiteStore() got an error: %s", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	_, err = migrateUp(store, latestMigration(store.Migrations()))
+	if err != nil {
+		t.Fatalf("migrateUp() got an error: %s", err)
+	}
+	return store
+}
+
+// newTestApp is an App backed by sqlite and fakes with the fake stream provider
+// registered. Dashboard logins are accepted for the access tokens in users.
+func newTestApp(t *testing.T, users map[string]fakeDiscordUser) (*App, *fakeDiscord) {
+	withFakeProvider(t, fakeProvider{})
+	discord := newFakeDiscord()
+	app := newApp(testSQLiteStore(t))
+	app.Discord = discord
+	app.Sessions = sessions.NewCookieStore([]byte("test secret"))
+	app.UserDiscord = func(accessToken string) (discordUser, error) {
+		user, ok := users[accessToken]
+		if !ok {
+			return nil, errors.New("unknown access token")
+		}
+		return user, nil
+	}
+	return app, discord
+}
+
+func TestAppProvider(t *testing.T) {
+	withFakeProvider(t, fakeProvider{})
+	app := newApp(nil)
+	app.Providers[StreamTwitch] = fakeProvider{}
+
+	if _, ok := app.provider(StreamTwitch).(fakeProvider); !ok {
+		t.Errorf("provider(Twitch) = %T; want the provider set on the app", app.provider(StreamTwitch))
+	}
+	delete(app.Providers, streamFake)
+	if _, ok := app.provider(streamFake).(fakeProvider); !ok {
+		t.Errorf("provider(Fake) = %T; want the registered provider", app.provider(streamFake))
+	}
+}
+
+func TestSetDiscordAPIURL(t *testing.T) {
+	originalAPIURL := discordgo.EndpointAPI
+	defer setDiscordAPIURL(originalAPIURL)
+
+	setDiscordAPIURL("https://discord.example.com/api/v9")
+	items := [][]interface{}{
+		[]interface{}{discordgo.EndpointGuilds, "https://discord.example.com/api/v9/guilds/"},
+		[]interface{}{discordgo.EndpointVoiceRegions, "https://discord.example.com/api/v9/voice/regions"},
+		[]interface{}{discordgo.EndpointNitroStickersPacks, "https://discord.example.com/api/v9/sticker-packs"},
+		[]interface{}{discordgo.EndpointOAuth2Applications, "https://discord.example.com/api/v9/oauth2/applications"},
+	}
+
+	for _, item := range items {
+		if item[0].(string) != item[1].(string) {
+			t.Errorf("endpoint = %s; want %s", item[0].(string), item[1].(string))
+		}
+	}
+}
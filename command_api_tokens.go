@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	commands.Register(&command{
+		Name:        "apiToken",
+		Usage:       "<create name [read or read-write] | list | revoke number>",
+		Description: "Manages tokens for using the api without logging in",
+		MinArgs:     1,
+		GuildOnly:   true,
+		ManageGuild: true,
+		Run:         apiTokenCommand,
+	})
+}
+
+func apiTokenCommand(ctx *commandContext) error {
+	switch strings.ToLower(ctx.Args[0]) {
+	case "create":
+		return createAPITokenCommand(ctx, ctx.Args[1:])
+	case "list":
+		return listAPITokensCommand(ctx)
+	case "revoke":
+		return revokeAPITokenCommand(ctx, ctx.Args[1:])
+	}
+	ctx.Reply("Usage: " + ctx.Usage(commands.Lookup("apiToken")))
+	return nil
+}
+
+func createAPITokenCommand(ctx *commandContext, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		ctx.Reply("Usage: " + ctx.Prefix + "apiToken create <name> [read or read-write]")
+		return nil
+	}
+	scope := apiScopeRead
+	if len(args) == 2 {
+		scope = strings.ToLower(args[1])
+	}
+	if scope != apiScopeRead && scope != apiScopeReadWrite {
+		ctx.Reply("Tokens can only be read or read-write")
+		return nil
+	}
+
+	token, err := newAPIToken()
+	if err != nil {
+		return err
+	}
+	apiToken := &APIToken{
+		GuildID:   ctx.GuildID,
+		OwnerID:   ctx.Author.ID,
+		OwnerName: ctx.Author.Username,
+		Name:      args[0],
+		TokenHash: hashAPIToken(token),
+		Scope:     scope,
+		CreatedAt: time.Now(),
+	}
+	err = ctx.App.Store.AddAPIToken(apiToken)
+	if err != nil {
+		return err
+	}
+	log.Notice(ctx.Author.Username, "Created api token", apiToken.String())
+
+	message := fmt.Sprintf("Your %s token %s is `%s`\nSend it as `Authorization: Bearer <token>`, it won't be shown again", scope, apiToken.Name, token)
+	if ctx.Responder != nil {
+		// slash command replies are only shown to the person who ran them
+		ctx.Reply(message)
+		return nil
+	}
+	channel, err := ctx.Session.UserChannelCreate(ctx.Author.ID)
+	if err == nil {
+		_, err = ctx.Session.ChannelMessageSend(channel.ID, message)
+	}
+	if err != nil {
+		log.Warning("Unable to send", apiToken.String(), "privately", err)
+		_, revokeErr := ctx.App.Store.DeleteAPIToken(apiToken.GuildID, apiToken.ID)
+		if revokeErr != nil {
+			return revokeErr
+		}
+		ctx.Reply("I couldn't send you a private message, so the token wasn't created")
+		return nil
+	}
+	ctx.Reply(fmt.Sprintf("Created token %d, I've sent it to you in a private message", apiToken.ID))
+	return nil
+}
+
+func listAPITokensCommand(ctx *commandContext) error {
+	tokens, err := ctx.App.Store.GuildAPITokens(ctx.GuildID)
+	if err != nil {
+		return err
+	}
+	ctx.Reply(formatAPITokens(tokens))
+	return nil
+}
+
+// formatAPITokens lists tokens by their id, which is what revoke takes
+func formatAPITokens(tokens []APIToken) string {
+	if len(tokens) == 0 {
+		return "There are no api tokens for this server"
+	}
+	lines := []string{"API tokens:"}
+	for _, token := range tokens {
+		used := "never used"
+		if !token.LastUsedAt.IsZero() {
+			used = fmt.Sprintf("last used <t:%d:R>", token.LastUsedAt.Unix())
+		}
+		lines = append(lines, fmt.Sprintf("%d. %s (%s) created by %s, %s", token.ID, token.Name, token.Scope, token.OwnerName, used))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func revokeAPITokenCommand(ctx *commandContext, args []string) error {
+	if len(args) != 1 {
+		ctx.Reply("Usage: " + ctx.Prefix + "apiToken revoke <number>")
+		return nil
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		ctx.Reply("Use the number from " + ctx.Prefix + "apiToken list")
+		return nil
+	}
+
+	deleted, err := ctx.App.Store.DeleteAPIToken(ctx.GuildID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		ctx.Reply(fmt.Sprintf("There is no api token %d", id))
+		return nil
+	}
+	log.Notice(ctx.Author.Username, "Revoked api token", id)
+	ctx.Reply(fmt.Sprintf("Revoked api token %d", id))
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestNewAPIToken(t *testing.T) {
+	first, err := newAPIToken()
+	if err != nil {
+		t.Fatalf("newAPIToken() got an error: %s", err)
+	}
+	second, _ := newAPIToken()
+
+	if !strings.HasPrefix(first, apiTokenPrefix) || first == second {
+		t.Errorf("newAPIToken() = %s, %s; want two different tokens starting with %s", first, second, apiTokenPrefix)
+	}
+	if hashAPIToken(first) != hashAPIToken(first) || hashAPIToken(first) == hashAPIToken(second) || strings.Contains(hashAPIToken(first), first) {
+		t.Errorf("hashAPIToken() should be stable, different per token and not contain the token")
+	}
+}
+
+func TestFormatAPITokens(t *testing.T) {
+	tokens := []APIToken{
+		APIToken{ID: 3, Name: "overlay", Scope: apiScopeRead, OwnerName: "halkeye"},
+		APIToken{ID: 7, Name: "cron", Scope: apiScopeReadWrite, OwnerName: "halkeye", LastUsedAt: time.Unix(1557024652, 0)},
+	}
+
+	want := "API tokens:\n3. overlay (read) created by halkeye, never used\n7. cron (read-write) created by halkeye, last used <t:1557024652:R>"
+	if got := formatAPITokens(tokens); got != want {
+		t.Errorf("formatAPITokens() = %q; want %q", got, want)
+	}
+}
+
+func TestAPITokenCommandUsage(t *testing.T) {
+	items := [][]interface{}{
+		[]interface{}{"!apiToken rotate", "Usage: !apiToken <create name [read or read-write] | list | revoke number>"},
+		[]interface{}{"!apiToken create", "Usage: !apiToken create <name> [read or read-write]"},
+		[]interface{}{"!apiToken create overlay admin", "Tokens can only be read or read-write"},
+		[]interface{}{"!apiToken revoke overlay", "Use the number from !apiToken list"},
+	}
+
+	for _, item := range items {
+		session := &fakeSession{permissions: discordgo.PermissionManageServer}
+		commands.Dispatch(newTestContext(session, "guild"), item[0].(string))
+		if reply := strings.Join(session.sent, "\n"); reply != item[1].(string) {
+			t.Errorf("%s replied %q; want %q", item[0].(string), reply, item[1].(string))
+		}
+	}
+}
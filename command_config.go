@@ -0,0 +1,294 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/viper"
+)
+
+// guildSetting is something admins can change per guild with the config command
+type guildSetting struct {
+	Name        string
+	Column      string
+	Usage       string
+	Description string
+	// Parse turns what was typed into the value saved, "none" skips it and saves Reset
+	Parse func(ctx *commandContext, value string) (interface{}, error)
+	Reset interface{}
+	Show  func(guild *Guild) string
+	// Changed runs after a new value is saved, previous is the guild before the change
+	Changed func(ctx *commandContext, previous *Guild, guild *Guild)
+}
+
+// guildSettings is every setting in the order the config command lists them
+var guildSettings = []*guildSetting{
+	&guildSetting{
+		Name:        "announceChannel",
+		Column:      "announce_channel_id",
+		Usage:       "<#channel or here>",
+		Description: "Where go-live announcements are posted",
+		Parse:       parseChannelSetting,
+		Reset:       "",
+		Show:        func(guild *Guild) string { return showMention("<#", guild.AnnounceChannelID) },
+	},
+	&guildSetting{
+		Name:        "prefix",
+		Usage:       "<prefix>",
+		Column:      "prefix",
+		Description: "What commands start with",
+		Parse:       parsePrefixSetting,
+		Reset:       "",
+		Show:        func(guild *Guild) string { return guild.CommandPrefix() },
+	},
+	&guildSetting{
+		Name:        "leaderboardChannel",
+		Column:      "leaderboard_channel_id",
+		Usage:       "<#channel or here>",
+		Description: "Where last week's leaderboard is posted every monday",
+		Parse:       parseChannelSetting,
+		Reset:       "",
+		Show:        func(guild *Guild) string { return showMention("<#", guild.LeaderboardChannelID) },
+	},
+	&guildSetting{
+		Name:        "liveRole",
+		Column:      "live_role_id",
+		Usage:       "<@role>",
+		Description: "Role members have while they are live",
+		Parse:       parseRoleSetting,
+		Reset:       "",
+		Show:        func(guild *Guild) string { return showMention("<@&", guild.LiveRoleID) },
+		Changed: func(ctx *commandContext, previous *Guild, guild *Guild) {
+			if previous.LiveRoleID != guild.LiveRoleID {
+				ctx.App.moveLiveRole(guild.ID, previous.LiveRoleID)
+			}
+		},
+	},
+	&guildSetting{
+		Name:        "mentionRole",
+		Column:      "mention_role_id",
+		Usage:       "<@role>",
+		Description: "Role pinged by go-live announcements",
+		Parse:       parseRoleSetting,
+		Reset:       "",
+		Show:        func(guild *Guild) string { return showMention("<@&", guild.MentionRoleID) },
+	},
+	&guildSetting{
+		Name:        "template",
+		Column:      "announce_template",
+		Usage:       "\"<message>\"",
+		Description: "Wording of go-live announcements",
+		Parse:       validateAnnounceTemplate,
+		Reset:       "",
+		Show: func(guild *Guild) string {
+			if guild.AnnounceTemplate == "" {
+				return "default"
+			}
+			return "`" + guild.AnnounceTemplate + "`"
+		},
+	},
+	&guildSetting{
+		Name:        "streamTypes",
+		Column:      "allowed_stream_types",
+		Usage:       "<type,type>",
+		Description: "Which sites members can add streams from",
+		Parse:       parseStreamTypesSetting,
+		Reset:       []StreamType{},
+		Show: func(guild *Guild) string {
+			if len(guild.AllowedStreamTypes) == 0 {
+				return "all"
+			}
+			names := []string{}
+			for _, streamType := range guild.AllowedStreamTypes {
+				names = append(names, streamType.String())
+			}
+			return strings.Join(names, ", ")
+		},
+	},
+	&guildSetting{
+		Name:        "endAction",
+		Column:      "announce_end_action",
+		Usage:       "<edit, delete or keep>",
+		Description: "What happens to announcements when the stream ends",
+		Parse:       parseEndActionSetting,
+		Reset:       "",
+		Show: func(guild *Guild) string {
+			if guild.AnnounceEndAction == "" {
+				return announceEndEdit
+			}
+			return guild.AnnounceEndAction
+		},
+	},
+	&guildSetting{
+		Name:        "dashboard",
+		Column:      "public_dashboard",
+		Usage:       "<public or private>",
+		Description: "Whether people outside the server can see who is live with the widget",
+		Parse:       parseDashboardSetting,
+		Reset:       false,
+		Show: func(guild *Guild) string {
+			if guild.PublicDashboard {
+				return "public, embed " + viper.GetString("self_url") + "g/" + guild.ID + "/widget"
+			}
+			return "private"
+		},
+	},
+}
+
+func init() {
+	commands.Register(&command{
+		Name:        "config",
+		Usage:       "[setting] [value or none]",
+		Description: "Shows or changes this server's settings",
+		GuildOnly:   true,
+		ManageGuild: true,
+		Run:         configCommand,
+	})
+}
+
+// lookupGuildSetting finds a setting by name, ignoring case
+func lookupGuildSetting(name string) *guildSetting {
+	for _, setting := range guildSettings {
+		if strings.EqualFold(setting.Name, name) {
+			return setting
+		}
+	}
+	return nil
+}
+
+func configCommand(ctx *commandContext) error {
+	guild, err := ctx.App.Store.GetGuild(ctx.GuildID)
+	if err != nil {
+		return err
+	}
+
+	if len(ctx.Args) == 0 {
+		lines := []string{"Settings:"}
+		for _, setting := range guildSettings {
+			lines = append(lines, fmt.Sprintf("`%s` %s - %s", setting.Name, setting.Show(guild), setting.Description))
+		}
+		lines = append(lines, "Change one with `"+ctx.Usage(commands.Lookup("config"))+"`")
+		ctx.Reply(strings.Join(lines, "\n"))
+		return nil
+	}
+
+	setting := lookupGuildSetting(ctx.Args[0])
+	if setting == nil {
+		ctx.Reply("There is no setting called " + ctx.Args[0])
+		return nil
+	}
+	if len(ctx.Args) == 1 {
+		ctx.Reply(fmt.Sprintf("`%s` is %s", setting.Name, setting.Show(guild)))
+		return nil
+	}
+	return setGuildSetting(ctx, setting, strings.Join(ctx.Args[1:], " "))
+}
+
+// setGuildSetting parses and saves a setting, replying with what it was changed to
+func setGuildSetting(ctx *commandContext, setting *guildSetting, input string) error {
+	value := setting.Reset
+	if !strings.EqualFold(input, "none") {
+		var err error
+		value, err = setting.Parse(ctx, input)
+		if err != nil {
+			ctx.Reply(err.Error() + ", try " + ctx.Prefix + "config " + setting.Name + " " + setting.Usage)
+			return nil
+		}
+	}
+
+	previous, err := ctx.App.Store.GetGuild(ctx.GuildID)
+	if err != nil {
+		return err
+	}
+	guild, err := ctx.App.updateGuild(ctx.GuildID, setting.Column, value)
+	if err != nil {
+		return err
+	}
+	ctx.Reply(fmt.Sprintf("`%s` is now %s", setting.Name, setting.Show(guild)))
+	if setting.Changed != nil {
+		setting.Changed(ctx, previous, guild)
+	}
+	return nil
+}
+
+func showMention(prefix string, id string) string {
+	if id == "" {
+		return "not set"
+	}
+	return prefix + id + ">"
+}
+
+// snowflake returns the id from a mention like <#id> or <@&id>, or a bare id
+func snowflake(input string, mentionPrefix string) (string, bool) {
+	id := strings.TrimSuffix(strings.TrimPrefix(input, mentionPrefix), ">")
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return "", false
+	}
+	return id, true
+}
+
+func parseChannelSetting(ctx *commandContext, value string) (interface{}, error) {
+	if strings.EqualFold(value, "here") {
+		return ctx.ChannelID, nil
+	}
+	id, ok := snowflake(value, "<#")
+	if !ok {
+		return nil, errors.New("That isn't a channel")
+	}
+	return id, nil
+}
+
+func parseRoleSetting(ctx *commandContext, value string) (interface{}, error) {
+	id, ok := snowflake(value, "<@&")
+	if !ok {
+		return nil, errors.New("That isn't a role")
+	}
+	return id, nil
+}
+
+func parsePrefixSetting(ctx *commandContext, value string) (interface{}, error) {
+	if value == "" || strings.ContainsAny(value, " \t\n") {
+		return nil, errors.New("Prefixes can't be empty or have spaces")
+	}
+	if utf8.RuneCountInString(value) > maxPrefixLength {
+		return nil, fmt.Errorf("Prefixes can be at most %d characters", maxPrefixLength)
+	}
+	return value, nil
+}
+
+func parseStreamTypesSetting(ctx *commandContext, value string) (interface{}, error) {
+	types := []StreamType{}
+	for _, name := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+		streamType, ok := streamTypeByName(name)
+		if !ok {
+			return nil, errors.New("Streams from " + name + " aren't supported")
+		}
+		types = append(types, streamType)
+	}
+	if len(types) == 0 {
+		return nil, errors.New("Pick at least one type")
+	}
+	return types, nil
+}
+
+func parseDashboardSetting(ctx *commandContext, value string) (interface{}, error) {
+	switch strings.ToLower(value) {
+	case "public":
+		return true, nil
+	case "private":
+		return false, nil
+	}
+	return nil, errors.New("The dashboard can only be public or private")
+}
+
+func parseEndActionSetting(ctx *commandContext, value string) (interface{}, error) {
+	value = strings.ToLower(value)
+	switch value {
+	case announceEndEdit, announceEndDelete, announceEndKeep:
+		return value, nil
+	}
+	return nil, errors.New("Announcements can only be edited, deleted or kept")
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSnowflake(t *testing.T) {
+	items := [][]interface{}{
+		[]interface{}{"<@&574047051608883214>", "<@&", "574047051608883214", true},
+		[]interface{}{"574047051608883214", "<@&", "574047051608883214", true},
+		[]interface{}{"<#574047051608883214>", "<#", "574047051608883214", true},
+		[]interface{}{"<#574047051608883214>", "<@&", "", false},
+		[]interface{}{"@streamers", "<@&", "", false},
+	}
+
+	for _, item := range items {
+		got, ok := snowflake(item[0].(string), item[1].(string))
+		if got != item[2].(string) || ok != item[3].(bool) {
+			t.Errorf("snowflake(%q, %q) = %s %t; want %s %t", item[0].(string), item[1].(string), got, ok, item[2].(string), item[3].(bool))
+		}
+	}
+}
+
+func TestGuildSettingParse(t *testing.T) {
+	ctx := newTestContext(&fakeSession{}, "guild")
+
+	items := [][]interface{}{
+		// setting, input, saved value or nil for an error
+		[]interface{}{"announceChannel", "here", "channel"},
+		[]interface{}{"announceChannel", "<#574047051608883214>", "574047051608883214"},
+		[]interface{}{"announceChannel", "general", nil},
+		[]interface{}{"prefix", "?", "?"},
+		[]interface{}{"prefix", "toolong", nil},
+		[]interface{}{"mentionRole", "<@&574047051608883214>", "574047051608883214"},
+		[]interface{}{"endAction", "Delete", "delete"},
+		[]interface{}{"endAction", "archive", nil},
+		[]interface{}{"dashboard", "Public", true},
+		[]interface{}{"dashboard", "hidden", nil},
+		[]interface{}{"streamTypes", "twitch", "[Twitch]"},
+		[]interface{}{"streamTypes", "YouTube, twitch", "[YouTube Twitch]"},
+		[]interface{}{"streamTypes", "myspace", nil},
+	}
+
+	for _, item := range items {
+		setting := lookupGuildSetting(item[0].(string))
+		got, err := setting.Parse(ctx, item[1].(string))
+		if item[2] == nil {
+			if err == nil {
+				t.Errorf("%s.Parse(%q) = %v; want an error", item[0].(string), item[1].(string), got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s.Parse(%q) got an error: %s", item[0].(string), item[1].(string), err)
+			continue
+		}
+		if types, ok := got.([]StreamType); ok {
+			got = fmt.Sprint(types)
+		}
+		if got != item[2] {
+			t.Errorf("%s.Parse(%q) = %v; want %v", item[0].(string), item[1].(string), got, item[2])
+		}
+	}
+}
+
+func TestGuildAllowsStreamType(t *testing.T) {
+	guild := Guild{}
+	if !guild.AllowsStreamType(StreamYouTube) {
+		t.Errorf("guilds without allowed types should allow everything")
+	}
+	guild.AllowedStreamTypes = []StreamType{StreamTwitch}
+	if !guild.AllowsStreamType(StreamTwitch) || guild.AllowsStreamType(StreamYouTube) {
+		t.Errorf("AllowsStreamType should only allow %v", guild.AllowedStreamTypes)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+// maxPrefixLength keeps prefixes short enough to type
+const maxPrefixLength = 5
+
+func init() {
+	commands.Register(&command{
+		Name:        "announceHere",
+		Description: "Posts go-live announcements in this channel",
+		GuildOnly:   true,
+		ManageGuild: true,
+		Run: func(ctx *commandContext) error {
+			return setGuildSetting(ctx, lookupGuildSetting("announceChannel"), "here")
+		},
+	})
+	commands.Register(&command{
+		Name:        "prefix",
+		Usage:       "<prefix>",
+		Description: "Changes the prefix commands start with on this server",
+		MinArgs:     1,
+		GuildOnly:   true,
+		ManageGuild: true,
+		Run: func(ctx *commandContext) error {
+			return setGuildSetting(ctx, lookupGuildSetting("prefix"), ctx.Args[0])
+		},
+	})
+	commands.Register(&command{
+		Name:        "liveRole",
+		Usage:       "<@role or none>",
+		Description: "Gives members this role while they are live",
+		MinArgs:     1,
+		GuildOnly:   true,
+		ManageGuild: true,
+		Run: func(ctx *commandContext) error {
+			return setGuildSetting(ctx, lookupGuildSetting("liveRole"), ctx.Args[0])
+		},
+	})
+}
+
+// updateGuild saves a single column for a guild and refreshes the cached copy
+func (a *App) updateGuild(guildID string, column string, value interface{}) (*Guild, error) {
+	guild, err := a.Store.UpdateGuildSetting(guildID, column, value)
+	if err != nil {
+		return nil, err
+	}
+	a.Guilds.Set(guild)
+	return guild, nil
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/getsentry/raven-go"
+)
+
+// defaultPrefix is used in private messages and for guilds that haven't picked one
+const defaultPrefix = "!"
+
+// discordSession is the part of discordgo.Session the commands use,
+// so they can be run in tests without a gateway connection
+type discordSession interface {
+	ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageSendEmbed(channelID string, embed *discordgo.MessageEmbed, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	UserChannelPermissions(userID, channelID string, fetchOptions ...discordgo.RequestOption) (int64, error)
+	UserChannelCreate(recipientID string, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+}
+
+// commandContext is what a command gets to work with
+type commandContext struct {
+	App       *App
+	Session   discordSession
+	GuildID   string
+	ChannelID string
+	Author    *discordgo.User
+	Member    *discordgo.Member
+	Mentions  []*discordgo.User
+	Prefix    string
+	Args      []string
+	BotUserID string
+	// CommandName turns a command's name into what is typed after Prefix,
+	// slash commands use it to point at their subcommands. Nil keeps the name.
+	CommandName func(name string) string
+	// Responder replaces sending replies to the channel, slash commands use it
+	// to answer the interaction instead. Only one of message or embed is set.
+	Responder func(message string, embed *discordgo.MessageEmbed)
+}
+
+// noMentions stops replies from pinging anyone, they can echo back what members typed
+var noMentions = &discordgo.MessageAllowedMentions{}
+
+// Reply sends a message back to the channel the command came from
+func (c *commandContext) Reply(message string) {
+	if c.Responder != nil {
+		c.Responder(message, nil)
+		return
+	}
+	_, err := c.Session.ChannelMessageSendComplex(c.ChannelID, &discordgo.MessageSend{Content: message, AllowedMentions: noMentions})
+	if err != nil {
+		log.Error("Error replying to command", err)
+	}
+}
+
+// ReplyEmbed sends an embed, or the fallback text when the bot can't embed links in the channel
+func (c *commandContext) ReplyEmbed(embed *discordgo.MessageEmbed, fallback string) {
+	if c.Responder != nil {
+		c.Responder("", embed)
+		return
+	}
+	if !canEmbed(c.Session, c.BotUserID, c.ChannelID) {
+		c.Reply(fallback)
+		return
+	}
+	_, err := c.Session.ChannelMessageSendEmbed(c.ChannelID, embed)
+	if err != nil {
+		log.Error("Error replying to command", err)
+	}
+}
+
+// Invocation is what to type to run cmd from wherever this command was run
+func (c *commandContext) Invocation(cmd *command) string {
+	name := cmd.Name
+	if c.CommandName != nil {
+		name = c.CommandName(name)
+	}
+	return c.Prefix + name
+}
+
+// Usage is how to run cmd with its arguments from wherever this command was run
+func (c *commandContext) Usage(cmd *command) string {
+	if cmd.Usage == "" {
+		return c.Invocation(cmd)
+	}
+	return c.Invocation(cmd) + " " + cmd.Usage
+}
+
+// CanManageGuild checks if the author has the Manage Server permission here
+func (c *commandContext) CanManageGuild() bool {
+	perms, err := c.Session.UserChannelPermissions(c.Author.ID, c.ChannelID)
+	if err != nil {
+		log.Error("Error getting permissions", err)
+		return false
+	}
+	return perms&discordgo.PermissionManageServer != 0
+}
+
+// command is a single bot command
+type command struct {
+	Name        string
+	Aliases     []string
+	Usage       string
+	Description string
+	// MinArgs is how many arguments must be passed before Run is called
+	MinArgs int
+	// GuildOnly commands can't be used in private messages
+	GuildOnly bool
+	// ManageGuild commands need the Manage Server permission
+	ManageGuild bool
+	Run         func(ctx *commandContext) error
+}
+
+// commandRouter finds the command for a message and runs it
+type commandRouter struct {
+	commands map[string]*command
+	aliases  map[string]*command
+}
+
+func newCommandRouter() *commandRouter {
+	return &commandRouter{
+		commands: map[string]*command{},
+		aliases:  map[string]*command{},
+	}
+}
+
+// commands is every command the bot knows
+var commands = newCommandRouter()
+
+// Register adds a command, names and aliases are case insensitive
+func (r *commandRouter) Register(cmd *command) {
+	for _, name := range append([]string{cmd.Name}, cmd.Aliases...) {
+		name = strings.ToLower(name)
+		if r.Lookup(name) != nil {
+			panic("command registered twice: " + name)
+		}
+		r.aliases[name] = cmd
+	}
+	r.commands[strings.ToLower(cmd.Name)] = cmd
+}
+
+// Lookup returns the command for a name or alias
+func (r *commandRouter) Lookup(name string) *command {
+	return r.aliases[strings.ToLower(name)]
+}
+
+// Dispatch runs the command in content, it returns false when content isn't a command
+func (r *commandRouter) Dispatch(ctx *commandContext, content string) bool {
+	if !strings.HasPrefix(content, ctx.Prefix) {
+		return false
+	}
+
+	args, err := tokenize(content[len(ctx.Prefix):])
+	if err != nil {
+		ctx.Reply(err.Error())
+		return true
+	}
+	if len(args) == 0 {
+		return false
+	}
+
+	cmd := r.Lookup(args[0])
+	if cmd == nil {
+		return false
+	}
+	ctx.Args = args[1:]
+	runCommand(ctx, cmd)
+	return true
+}
+
+// runCommand checks the command can be used here and runs it
+func runCommand(ctx *commandContext, cmd *command) {
+	if cmd.GuildOnly && ctx.GuildID == "" {
+		ctx.Reply("Private messages are not currently supported")
+		return
+	}
+	if cmd.ManageGuild && !ctx.CanManageGuild() {
+		ctx.Reply("You need the Manage Server permission to do that")
+		return
+	}
+	if len(ctx.Args) < cmd.MinArgs {
+		ctx.Reply("Usage: " + ctx.Usage(cmd))
+		return
+	}
+
+	err := cmd.Run(ctx)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("Error running command "+cmd.Name, err)
+		ctx.Reply("Something went wrong running that command")
+	}
+}
+
+func (cmd *command) usage(prefix string) string {
+	if cmd.Usage == "" {
+		return prefix + cmd.Name
+	}
+	return prefix + cmd.Name + " " + cmd.Usage
+}
+
+// Help lists every command with how to use it
+func (r *commandRouter) Help(prefix string) string {
+	names := []string{}
+	for name := range r.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := []string{"Commands:"}
+	for _, name := range names {
+		cmd := r.commands[name]
+		line := fmt.Sprintf("`%s` - %s", cmd.usage(prefix), cmd.Description)
+		if len(cmd.Aliases) > 0 {
+			line += " (also " + prefix + strings.Join(cmd.Aliases, ", "+prefix) + ")"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// tokenize splits a command into arguments, double quotes keep spaces together.
+// Single quotes are left alone since they show up in normal words.
+func tokenize(input string) ([]string, error) {
+	args := []string{}
+	var current strings.Builder
+	var quote rune
+	inArg := false
+
+	for _, r := range input {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case r == '"':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("Missing a closing quote")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+func init() {
+	commands.Register(&command{
+		Name:        "help",
+		Description: "Shows this message",
+		Run: func(ctx *commandContext) error {
+			ctx.Reply(commands.Help(ctx.Prefix))
+			return nil
+		},
+	})
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// fakeSession records what commands send instead of talking to discord
+type fakeSession struct {
+	permissions int64
+	sent        []string
+	embeds      []*discordgo.MessageEmbed
+	// mentions is what each complex message was allowed to ping
+	mentions []*discordgo.MessageAllowedMentions
+}
+
+func (f *fakeSession) ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.sent = append(f.sent, content)
+	return &discordgo.Message{ChannelID: channelID, Content: content}, nil
+}
+
+func (f *fakeSession) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.mentions = append(f.mentions, data.AllowedMentions)
+	if data.Content != "" {
+		f.sent = append(f.sent, data.Content)
+	}
+	return &discordgo.Message{ID: "message", ChannelID: channelID, Content: data.Content, Embeds: data.Embeds}, nil
+}
+
+func (f *fakeSession) ChannelMessageSendEmbed(channelID string, embed *discordgo.MessageEmbed, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.embeds = append(f.embeds, embed)
+	return &discordgo.Message{ChannelID: channelID, Embeds: []*discordgo.MessageEmbed{embed}}, nil
+}
+
+func (f *fakeSession) UserChannelCreate(recipientID string, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	return &discordgo.Channel{ID: "dm-" + recipientID}, nil
+}
+
+func (f *fakeSession) UserChannelPermissions(userID, channelID string, fetchOptions ...discordgo.RequestOption) (int64, error) {
+	return f.permissions, nil
+}
+
+func newTestContext(session *fakeSession, guildID string) *commandContext {
+	return &commandContext{
+		App:       newApp(nil),
+		Session:   session,
+		GuildID:   guildID,
+		ChannelID: "channel",
+		Author:    &discordgo.User{ID: "author", Username: "halkeye"},
+		BotUserID: "bot",
+		Prefix:    "!",
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	items := [][]interface{}{
+		[]interface{}{"addStream https://www.twitch.tv/halkeye", []string{"addStream", "https://www.twitch.tv/halkeye"}},
+		[]interface{}{"  spaced   out  ", []string{"spaced", "out"}},
+		[]interface{}{`set template "{{.OwnerName}} is live"`, []string{"set", "template", "{{.OwnerName}} is live"}},
+		[]interface{}{`it's "double quoted"`, []string{"it's", "double quoted"}},
+		[]interface{}{`empty "" arg`, []string{"empty", "", "arg"}},
+		[]interface{}{"", []string{}},
+	}
+
+	for _, item := range items {
+		got, err := tokenize(item[0].(string))
+		if err != nil {
+			t.Errorf("tokenize(%q) got an error: %s", item[0].(string), err)
+		}
+		if strings.Join(got, "|") != strings.Join(item[1].([]string), "|") || len(got) != len(item[1].([]string)) {
+			t.Errorf("tokenize(%q) = %q; want %q", item[0].(string), got, item[1].([]string))
+		}
+	}
+
+	_, err := tokenize(`unclosed "quote`)
+	if err == nil {
+		t.Errorf("tokenize with an unclosed quote should have returned an error")
+	}
+}
+
+func TestCommandRouterDispatch(t *testing.T) {
+	var gotArgs []string
+	router := newCommandRouter()
+	router.Register(&command{
+		Name:    "echo",
+		Aliases: []string{"say"},
+		Usage:   "<words>",
+		MinArgs: 1,
+		Run: func(ctx *commandContext) error {
+			gotArgs = ctx.Args
+			ctx.Reply(strings.Join(ctx.Args, " "))
+			return nil
+		},
+	})
+	router.Register(&command{
+		Name:        "admin",
+		GuildOnly:   true,
+		ManageGuild: true,
+		Run: func(ctx *commandContext) error {
+			ctx.Reply("admin done")
+			return nil
+		},
+	})
+	router.Register(&command{
+		Name: "broken",
+		Run: func(ctx *commandContext) error {
+			return errors.New("broken")
+		},
+	})
+
+	items := [][]interface{}{
+		// content, guild, permissions, handled, reply
+		[]interface{}{"!echo hello world", "guild", int64(0), true, "hello world"},
+		[]interface{}{"!SAY hi", "guild", int64(0), true, "hi"},
+		[]interface{}{"!echo", "guild", int64(0), true, "Usage: !echo <words>"},
+		[]interface{}{"?echo hi", "guild", int64(0), false, ""},
+		[]interface{}{"!unknown", "guild", int64(0), false, ""},
+		[]interface{}{"just chatting", "guild", int64(0), false, ""},
+		[]interface{}{"!admin", "", int64(0), true, "Private messages are not currently supported"},
+		[]interface{}{"!admin", "guild", int64(0), true, "You need the Manage Server permission to do that"},
+		[]interface{}{"!admin", "guild", int64(discordgo.PermissionManageServer), true, "admin done"},
+		[]interface{}{"!broken", "guild", int64(0), true, "Something went wrong running that command"},
+	}
+
+	for _, item := range items {
+		session := &fakeSession{permissions: item[2].(int64)}
+		handled := router.Dispatch(newTestContext(session, item[1].(string)), item[0].(string))
+		if handled != item[3].(bool) {
+			t.Errorf("Dispatch(%q) = %t; want %t", item[0].(string), handled, item[3].(bool))
+		}
+		reply := strings.Join(session.sent, "\n")
+		if reply != item[4].(string) {
+			t.Errorf("Dispatch(%q) replied %q; want %q", item[0].(string), reply, item[4].(string))
+		}
+		for _, allowed := range session.mentions {
+			if allowed == nil || len(allowed.Parse) != 0 || len(allowed.Roles) != 0 || len(allowed.Users) != 0 {
+				t.Errorf("Dispatch(%q) replied allowing mentions %v; want none", item[0].(string), allowed)
+			}
+		}
+	}
+
+	if strings.Join(gotArgs, "|") != "hi" {
+		t.Errorf("echo args = %q; want [hi]", gotArgs)
+	}
+}
+
+func TestCommandHelp(t *testing.T) {
+	session := &fakeSession{}
+	ctx := newTestContext(session, "guild")
+	ctx.Prefix = "?"
+
+	if !commands.Dispatch(ctx, "?help") {
+		t.Fatalf("?help was not handled")
+	}
+	help := strings.Join(session.sent, "\n")
+	for _, want := range []string{"`?addStream <url>`", "(also ?addTwitch)", "`?help`"} {
+		if !strings.Contains(help, want) {
+			t.Errorf("help = %q; want it to contain %q", help, want)
+		}
+	}
+}
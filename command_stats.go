@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func init() {
+	commands.Register(&command{
+		Name:        "stats",
+		Usage:       "[@member]",
+		Description: "Shows how much you, or someone else, has streamed",
+		GuildOnly:   true,
+		Run:         statsCommand,
+	})
+	commands.Register(&command{
+		Name:        "leaderboard",
+		Usage:       "[week or month]",
+		Description: "Ranks this server's streamers by hours live and peak viewers",
+		GuildOnly:   true,
+		Run:         leaderboardCommand,
+	})
+}
+
+func statsCommand(ctx *commandContext) error {
+	ownerID := ctx.Author.ID
+	ownerName := ctx.Author.Username
+	if len(ctx.Args) > 0 {
+		id, ok := mentionUserID(ctx.Args[0])
+		if !ok {
+			ctx.Reply("Usage: " + ctx.Usage(commands.Lookup("stats")))
+			return nil
+		}
+		ownerID = id
+		ownerName = ctx.Args[0]
+		for _, user := range ctx.Mentions {
+			if user.ID == id {
+				ownerName = user.Username
+			}
+		}
+	}
+
+	sessions, err := ctx.App.Store.OwnerSessions(ctx.GuildID, ownerID)
+	if err != nil {
+		return err
+	}
+	if len(sessions) == 0 {
+		ctx.Reply(ownerName + " hasn't streamed yet")
+		return nil
+	}
+
+	stats := sessionStats(sessions, time.Now())
+	ctx.ReplyEmbed(statsEmbed(ownerName, stats), formatStats(ownerName, stats))
+	return nil
+}
+
+// formatStats is the plain text version of statsEmbed
+func formatStats(ownerName string, stats streamStats) string {
+	lines := []string{
+		fmt.Sprintf("%s has streamed %s over %d sessions, %s on average", ownerName, formatDuration(stats.Total), stats.Sessions, formatDuration(stats.Average)),
+	}
+	if len(stats.Games) > 0 {
+		lines = append(lines, "Most streamed: "+formatGames(stats.Games))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func formatGames(games []gameTime) string {
+	names := []string{}
+	for _, game := range games {
+		names = append(names, fmt.Sprintf("%s (%s)", game.Game, formatDuration(game.Duration)))
+	}
+	return strings.Join(names, ", ")
+}
+
+func statsEmbed(ownerName string, stats streamStats) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title: ownerName + "'s streams",
+		Fields: []*discordgo.MessageEmbedField{
+			&discordgo.MessageEmbedField{Name: "Total", Value: formatDuration(stats.Total), Inline: true},
+			&discordgo.MessageEmbedField{Name: "Sessions", Value: fmt.Sprint(stats.Sessions), Inline: true},
+			&discordgo.MessageEmbedField{Name: "Average", Value: formatDuration(stats.Average), Inline: true},
+		},
+	}
+	if len(stats.Games) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Most streamed", Value: truncateText(formatGames(stats.Games), discordEmbedFieldValueLimit)})
+	}
+
+	recent := []string{}
+	for _, session := range stats.Recent {
+		line := fmt.Sprintf("<t:%d:d> %s", session.StartedAt.Unix(), formatDuration(session.Duration(time.Now())))
+		if session.Game != "" {
+			line += " of " + session.Game
+		}
+		if session.EndedAt.IsZero() {
+			line += " (live now)"
+		}
+		recent = append(recent, line)
+	}
+	embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Recent", Value: truncateText(strings.Join(recent, "\n"), discordEmbedFieldValueLimit)})
+	return embed
+}
+
+func leaderboardCommand(ctx *commandContext) error {
+	period := "week"
+	if len(ctx.Args) > 0 {
+		period = strings.ToLower(ctx.Args[0])
+	}
+	days, ok := leaderboardPeriods[period]
+	if !ok {
+		ctx.Reply("Usage: " + ctx.Usage(commands.Lookup("leaderboard")))
+		return nil
+	}
+
+	until := time.Now()
+	board, err := ctx.App.loadLeaderboard(ctx.GuildID, until.AddDate(0, 0, -days), until)
+	if err != nil {
+		return err
+	}
+	title := "Past " + period
+	if len(board.ByHours) == 0 {
+		ctx.Reply(formatLeaderboard(title, board))
+		return nil
+	}
+	ctx.ReplyEmbed(leaderboardEmbed(title, board), formatLeaderboard(title, board))
+	return nil
+}
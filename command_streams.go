@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func init() {
+	commands.Register(&command{
+		Name:        "addStream",
+		Aliases:     []string{"addTwitch"},
+		Usage:       "<url>",
+		Description: "Adds your stream so it shows up on the dashboard",
+		MinArgs:     1,
+		GuildOnly:   true,
+		Run:         addStreamCommand,
+	})
+	commands.Register(&command{
+		Name:        "myStreams",
+		Usage:       "[@member]",
+		Description: "Lists the streams you have added, admins can list anyone's",
+		GuildOnly:   true,
+		Run:         myStreamsCommand,
+	})
+	commands.Register(&command{
+		Name:        "removeStream",
+		Aliases:     []string{"removeTwitch"},
+		Usage:       "<number or url> [@member]",
+		Description: "Removes one of your streams, admins can remove anyone's",
+		MinArgs:     1,
+		GuildOnly:   true,
+		Run:         removeStreamCommand,
+	})
+	commands.Register(&command{
+		Name:        "live",
+		Description: "Lists who is streaming right now",
+		GuildOnly:   true,
+		Run:         liveCommand,
+	})
+}
+
+// invalidStreamError is a problem with the stream someone tried to add,
+// its message is safe to show them
+type invalidStreamError struct {
+	message string
+}
+
+func (e invalidStreamError) Error() string {
+	return e.message
+}
+
+// addStream saves a stream for a member, or updates their names if it was already added
+func (a *App) addStream(guildID string, owner *discordgo.User, nick string, text string) (*Stream, error) {
+	streamType, streamUsername, err := streamFromText(text)
+	if err != nil {
+		log.Error("Error processing url: "+text, err)
+		return nil, invalidStreamError{"Error processing text"}
+	}
+
+	if guild, ok := a.Guilds.Get(guildID); ok && !guild.AllowsStreamType(streamType) {
+		return nil, invalidStreamError{fmt.Sprintf("This server doesn't allow %s streams", streamType)}
+	}
+
+	streamUserID, err := a.provider(streamType).ResolveUserID(streamUsername)
+	if err != nil {
+		log.Error("Looking up username: "+text, err)
+		return nil, invalidStreamError{fmt.Sprintf("User does not exist, or %s is having errors: %s", streamType, err)}
+	}
+
+	stream := &Stream{
+		GuildID:        guildID,
+		Type:           streamType,
+		StreamUsername: streamUsername,
+		StreamUserID:   streamUserID,
+	}
+	stream.SetOwner(owner, nick)
+
+	err = a.Store.AddStream(stream)
+	if err != nil {
+		return nil, err
+	}
+	if streamType == StreamTwitch {
+		a.trackTwitchUser(streamUserID)
+	}
+	log.Notice(owner.Username, "Added new stream", stream.URL())
+	return stream, nil
+}
+
+func addStreamCommand(ctx *commandContext) error {
+	nick := ""
+	if ctx.Member != nil {
+		nick = ctx.Member.Nick
+	}
+	stream, err := ctx.App.addStream(ctx.GuildID, ctx.Author, nick, ctx.Args[0])
+	if invalid, ok := err.(invalidStreamError); ok {
+		ctx.Reply(invalid.Error())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	ctx.ReplyEmbed(addedStreamEmbed(*stream), "Added the URL: "+stream.URL())
+	return nil
+}
+
+func myStreamsCommand(ctx *commandContext) error {
+	ownerID, ownerName, args, ok := streamOwner(ctx)
+	if !ok {
+		return nil
+	}
+	if len(args) != 0 {
+		ctx.Reply("Usage: " + ctx.Usage(commands.Lookup("myStreams")))
+		return nil
+	}
+
+	streams, err := ctx.App.Store.OwnerStreams(ctx.GuildID, ownerID)
+	if err != nil {
+		return err
+	}
+	whose := "Your"
+	if ownerID != ctx.Author.ID {
+		whose = ownerName + "'s"
+	}
+	if len(streams) == 0 {
+		ctx.Reply(formatStreamList(streams, whose, ctx.Usage(commands.Lookup("addStream"))))
+		return nil
+	}
+	ctx.ReplyEmbed(streamListEmbed(streams, whose), formatStreamList(streams, whose, ctx.Usage(commands.Lookup("addStream"))))
+	return nil
+}
+
+func removeStreamCommand(ctx *commandContext) error {
+	ownerID, ownerName, args, ok := streamOwner(ctx)
+	if !ok {
+		return nil
+	}
+	if len(args) != 1 {
+		ctx.Reply("Usage: " + ctx.Usage(commands.Lookup("removeStream")))
+		return nil
+	}
+
+	streams, err := ctx.App.Store.OwnerStreams(ctx.GuildID, ownerID)
+	if err != nil {
+		return err
+	}
+	stream, err := pickStream(streams, args[0])
+	if err != nil {
+		ctx.Reply(err.Error())
+		return nil
+	}
+	err = ctx.App.deleteStream(stream)
+	if err != nil {
+		return err
+	}
+
+	log.Notice(ctx.Author.Username, "Removed stream", stream.URL(), "owned by", stream.OwnerTag())
+	if ownerID != ctx.Author.ID {
+		ctx.Reply(fmt.Sprintf("Removed %s's URL: %s", ownerName, stream.URL()))
+		return nil
+	}
+	ctx.Reply("Removed the URL: " + stream.URL())
+	return nil
+}
+
+// mentionUserID returns the user id from a <@id> or <@!id> mention
+func mentionUserID(arg string) (string, bool) {
+	if !strings.HasPrefix(arg, "<@") || !strings.HasSuffix(arg, ">") {
+		return "", false
+	}
+	id := strings.TrimPrefix(strings.TrimSuffix(arg[2:], ">"), "!")
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return "", false
+	}
+	return id, true
+}
+
+// streamOwner works out whose streams a command is about. Anyone can manage their
+// own, mentioning another member needs the Manage Server permission.
+// The mention is taken out of the returned args.
+func streamOwner(ctx *commandContext) (ownerID string, ownerName string, args []string, ok bool) {
+	ownerID = ctx.Author.ID
+	ownerName = ctx.Author.Username
+	args = []string{}
+
+	for _, arg := range ctx.Args {
+		if id, isMention := mentionUserID(arg); isMention {
+			ownerID = id
+			ownerName = arg
+			continue
+		}
+		args = append(args, arg)
+	}
+
+	if ownerID == ctx.Author.ID {
+		return ownerID, ctx.Author.Username, args, true
+	}
+	if !ctx.CanManageGuild() {
+		ctx.Reply("You need the Manage Server permission to manage someone else's streams")
+		return "", "", nil, false
+	}
+	for _, user := range ctx.Mentions {
+		if user.ID == ownerID {
+			ownerName = user.Username
+		}
+	}
+	return ownerID, ownerName, args, true
+}
+
+func liveCommand(ctx *commandContext) error {
+	streams, err := ctx.App.Store.LiveStreams(ctx.GuildID)
+	if err != nil {
+		return err
+	}
+	if len(streams) == 0 {
+		ctx.Reply("Nobody is live right now")
+		return nil
+	}
+	lines := []string{"Live right now:"}
+	for _, stream := range streams {
+		lines = append(lines, fmt.Sprintf("%s <%s>", stream.OwnerDisplayName(), stream.URL()))
+	}
+	ctx.ReplyEmbed(liveListEmbed(streams), strings.Join(lines, "\n"))
+	return nil
+}
+
+// deleteStream removes a stream and stops tracking it if nothing else needs it.
+// A live stream is wrapped up first the same way as when it goes offline.
+func (a *App) deleteStream(stream Stream) error {
+	endedAt := time.Now()
+	if stream.Live {
+		a.endSession(&stream, endedAt)
+	}
+	err := a.Store.DeleteStream(stream.ID)
+	if err != nil {
+		return err
+	}
+	if stream.Live {
+		a.syncLiveRole(stream.GuildID, stream.OwnerID)
+		a.endAnnouncement(stream, endedAt)
+	}
+	if stream.Type == StreamTwitch {
+		a.untrackTwitchUser(stream.StreamUserID)
+	}
+	return nil
+}
+
+// formatStreamList numbers the streams so they can be picked with pickStream,
+// addUsage is how to add one from wherever the list was asked for
+func formatStreamList(streams []Stream, whose string, addUsage string) string {
+	if len(streams) == 0 {
+		return "No streams have been added yet, use " + addUsage
+	}
+	lines := []string{whose + " streams:"}
+	for idx, stream := range streams {
+		lines = append(lines, fmt.Sprintf("%d. %s <%s>", idx+1, stream.Type, stream.URL()))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// pickStream finds a stream by its number from formatStreamList or by its url
+func pickStream(streams []Stream, input string) (Stream, error) {
+	input = strings.TrimSpace(input)
+
+	if idx, err := strconv.Atoi(input); err == nil {
+		if idx < 1 || idx > len(streams) {
+			return Stream{}, fmt.Errorf("There is no stream number %d", idx)
+		}
+		return streams[idx-1], nil
+	}
+
+	streamType, streamUsername, err := streamFromText(input)
+	if err != nil {
+		return Stream{}, err
+	}
+	for _, stream := range streams {
+		if stream.Type == streamType && strings.EqualFold(stream.StreamUsername, streamUsername) {
+			return stream, nil
+		}
+	}
+	return Stream{}, fmt.Errorf("No stream matches %s", input)
+}
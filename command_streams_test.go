@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestPickStream(t *testing.T) {
+	streams := []Stream{
+		Stream{ID: 10, Type: StreamTwitch, StreamUsername: "halkeye"},
+		Stream{ID: 11, Type: StreamYouTube, StreamUsername: "@halkeye"},
+	}
+
+	items := [][]interface{}{
+		[]interface{}{"1", int64(10)},
+		[]interface{}{" 2 ", int64(11)},
+		[]interface{}{"https://www.twitch.tv/HalkEye", int64(10)},
+		[]interface{}{"https://www.youtube.com/@halkeye", int64(11)},
+	}
+
+	for _, item := range items {
+		got, err := pickStream(streams, item[0].(string))
+		if err != nil {
+			t.Errorf("pickStream(\"%s\") got an error: %s", item[0].(string), err)
+		}
+		if got.ID != item[1].(int64) {
+			t.Errorf("pickStream(\"%s\") = %d; want %d", item[0].(string), got.ID, item[1].(int64))
+		}
+	}
+
+	for _, input := range []string{"0", "3", "https://www.twitch.tv/someoneelse", "nonsense"} {
+		_, err := pickStream(streams, input)
+		if err == nil {
+			t.Errorf("pickStream(\"%s\") should have returned an error", input)
+		}
+	}
+}
+
+func TestStreamOwner(t *testing.T) {
+	items := [][]interface{}{
+		// args, permissions, ok, owner id, remaining args
+		[]interface{}{[]string{"1"}, int64(0), true, "456", "1"},
+		[]interface{}{[]string{"<@456>", "1"}, int64(0), true, "456", "1"},
+		[]interface{}{[]string{"<@!123>", "1"}, int64(0), false, "", ""},
+		[]interface{}{[]string{"2", "<@!123>"}, int64(discordgo.PermissionManageServer), true, "123", "2"},
+		[]interface{}{[]string{"<@&123>"}, int64(0), true, "456", "<@&123>"},
+	}
+
+	for _, item := range items {
+		session := &fakeSession{permissions: item[1].(int64)}
+		ctx := newTestContext(session, "guild")
+		ctx.Author.ID = "456"
+		ctx.Args = item[0].([]string)
+
+		ownerID, _, args, ok := streamOwner(ctx)
+		if ok != item[2].(bool) {
+			t.Errorf("streamOwner(%q) ok = %t; want %t", item[0].([]string), ok, item[2].(bool))
+		}
+		if ownerID != item[3].(string) || strings.Join(args, " ") != item[4].(string) {
+			t.Errorf("streamOwner(%q) = %s %q; want %s %s", item[0].([]string), ownerID, args, item[3].(string), item[4].(string))
+		}
+	}
+}
+
+func TestDeleteLiveStream(t *testing.T) {
+	app, discord := newTestApp(t, nil)
+	if err := app.Store.SaveGuild(&Guild{ID: "guild", Name: "Streamers", OwnerID: "owner"}); err != nil {
+		t.Fatalf("SaveGuild() got an error: %s", err)
+	}
+	for column, value := range map[string]interface{}{"live_role_id": "live", "announce_end_action": announceEndDelete} {
+		if _, err := app.Store.UpdateGuildSetting("guild", column, value); err != nil {
+			t.Fatalf("UpdateGuildSetting(%s) got an error: %s", column, err)
+		}
+	}
+
+	now := time.Now()
+	stream := mustAddStream(t, app.Store, Stream{GuildID: "guild", OwnerID: "member", OwnerName: "streamer", Type: streamFake, StreamUsername: "streamer"})
+	stream.Live = true
+	stream.LiveSince = now.Add(-2 * time.Hour)
+	if _, err := app.Store.SetLive(&stream); err != nil {
+		t.Fatalf("SetLive() got an error: %s", err)
+	}
+	stream.AnnounceChannelID = "announce"
+	stream.AnnounceMessageID = "announced"
+	if err := app.Store.SaveAnnouncement(&stream); err != nil {
+		t.Fatalf("SaveAnnouncement() got an error: %s", err)
+	}
+	app.startSession(&stream)
+
+	if err := app.deleteStream(stream); err != nil {
+		t.Fatalf("deleteStream() got an error: %s", err)
+	}
+	if strings.Join(discord.roles, ",") != "-member live" || strings.Join(discord.deleted, ",") != "announced" {
+		t.Errorf("deleteStream() changed roles %v and deleted %v; want the live role and announcement gone", discord.roles, discord.deleted)
+	}
+
+	// an open session would keep counting up to the end of the week
+	board, err := app.loadLeaderboard("guild", now.Add(-24*time.Hour), now.Add(24*time.Hour))
+	if err != nil || len(board.ByHours) != 1 || board.ByHours[0].Live > 3*time.Hour {
+		t.Errorf("loadLeaderboard() after deleting a live stream = %+v, %v; want its 2 hours", board.ByHours, err)
+	}
+}
@@ -3,128 +3,229 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"strings"
 
-	twitch "github.com/Onestay/go-new-twitch"
 	"github.com/bwmarrin/discordgo"
 	"github.com/getsentry/raven-go"
-	"github.com/spf13/viper"
 )
 
-func saveGuild(guild *discordgo.Guild) {
+func (a *App) saveGuild(guild *discordgo.Guild) {
+	if guild.OwnerID == "" {
+		return
+	}
+	owner := ""
 	for _, member := range guild.Members {
 		if member.User.ID == guild.OwnerID {
-			guild := &Guild{
-				ID:      guild.ID,
-				Owner:   member.User.Username,
-				OwnerID: guild.OwnerID,
-			}
-			allGuilds[guild.ID] = guild
-			_, err := db.Model(guild).OnConflict("(id) DO UPDATE").Set("owner=EXCLUDED.owner, owner_id=EXCLUDED.owner_id").Insert()
-			if err != nil {
-				raven.CaptureErrorAndWait(err, nil)
-				log.Error("Error saving guild", err)
-			}
+			owner = member.User.Username
 			break
 		}
 	}
+	if owner == "" {
+		// the gateway only sends members when discord.member_events is on
+		member, err := a.Discord.GuildMember(guild.ID, guild.OwnerID)
+		if err != nil {
+			log.Warning("Error looking up the owner of "+guild.ID, err)
+		} else {
+			owner = member.User.Username
+		}
+	}
+
+	saved := &Guild{
+		ID:      guild.ID,
+		Name:    guild.Name,
+		Owner:   owner,
+		OwnerID: guild.OwnerID,
+	}
+	err := a.Store.SaveGuild(saved)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("Error saving guild", err)
+	}
+	a.Guilds.Set(saved)
+}
+
+func (a *App) guildCreate(_ *discordgo.Session, m *discordgo.GuildCreate) {
+	a.saveGuild(m.Guild)
+	go a.reconcileMembers(m.Guild)
+}
+
+// guildMembers returns everyone in the guild, fetching the list if the gateway only sent part of it
+func guildMembers(s discordClient, guild *discordgo.Guild) (map[string]*discordgo.Member, error) {
+	members := map[string]*discordgo.Member{}
+	for _, member := range guild.Members {
+		members[member.User.ID] = member
+	}
+	if !guild.Large && len(members) >= guild.MemberCount {
+		return members, nil
+	}
+
+	after := ""
+	for {
+		page, err := s.GuildMembers(guild.ID, after, 1000)
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range page {
+			members[member.User.ID] = member
+			after = member.User.ID
+		}
+		if len(page) < 1000 {
+			return members, nil
+		}
+	}
+}
+
+// departedStreams returns the streams whose owner isn't in members
+func departedStreams(streams []Stream, members map[string]*discordgo.Member) []Stream {
+	departed := []Stream{}
+	for _, stream := range streams {
+		if _, ok := members[stream.OwnerID]; !ok {
+			departed = append(departed, stream)
+		}
+	}
+	return departed
 }
 
-func guildCreate(s *discordgo.Session, m *discordgo.GuildCreate) {
-	saveGuild(m.Guild)
+// reconcileMembers catches up on what happened while the bot wasn't watching,
+// streams of members who left are removed and renamed members get their new names
+func (a *App) reconcileMembers(guild *discordgo.Guild) {
+	members, err := guildMembers(a.Discord, guild)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("Error listing members of "+guild.ID, err)
+		return
+	}
+	if len(members) == 0 {
+		// never prune everything because of a bad member list
+		return
+	}
+
+	streams, err := a.Store.GuildStreams(guild.ID)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("Error loading streams for "+guild.ID, err)
+		return
+	}
+
+	for _, stream := range departedStreams(streams, members) {
+		err = a.deleteStream(stream)
+		if err != nil {
+			raven.CaptureErrorAndWait(err, nil)
+			log.Error("Error removing "+stream.String(), err)
+			continue
+		}
+		log.Notice("Removed stream of departed member", stream.String())
+	}
+
+	a.reconcileLiveRole(guild.ID, members, streams)
+
+	synced := map[string]bool{}
+	for _, stream := range streams {
+		member, ok := members[stream.OwnerID]
+		if !ok || synced[stream.OwnerID] || !ownerNamesChanged(stream, member) {
+			continue
+		}
+		synced[stream.OwnerID] = true
+		err = a.syncOwnerNames(guild.ID, member)
+		if err != nil {
+			raven.CaptureErrorAndWait(err, nil)
+			log.Error("Error updating names for "+stream.OwnerID, err)
+		}
+	}
 }
 
-func guildUpdate(s *discordgo.Session, m *discordgo.GuildUpdate) {
-	saveGuild(m.Guild)
+func (a *App) guildUpdate(_ *discordgo.Session, m *discordgo.GuildUpdate) {
+	a.saveGuild(m.Guild)
 }
 
-func guildDelete(s *discordgo.Session, m *discordgo.GuildDelete) {
-	delete(allGuilds, m.Guild.ID)
-	_, err := db.Exec(`DELETE FROM guilds WHERE id=?=`, m.ID)
+func (a *App) guildDelete(_ *discordgo.Session, m *discordgo.GuildDelete) {
+	if m.Unavailable {
+		// discord is having an outage, the bot is still in the guild
+		return
+	}
+	a.Guilds.Delete(m.ID)
+	err := a.Store.DeleteGuild(m.ID)
 	if err != nil {
 		raven.CaptureErrorAndWait(err, nil)
 		log.Error("Error saving guild", err)
 	}
 }
 
-func guildMemberAdd(s *discordgo.Session, m *discordgo.GuildMemberAdd) {
+func guildMemberAdd(_ *discordgo.Session, m *discordgo.GuildMemberAdd) {
 	j, _ := json.Marshal(m)
 	fmt.Println("guildMemberAdd", string(j))
 }
 
-func guildMemberRemove(s *discordgo.Session, m *discordgo.GuildMemberRemove) {
-	j, _ := json.Marshal(m)
-	fmt.Println("guildMemberRemove", string(j))
+func (a *App) guildMemberRemove(_ *discordgo.Session, m *discordgo.GuildMemberRemove) {
+	err := a.Store.DeleteOwnerAPITokens(m.GuildID, m.User.ID)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("Error revoking api tokens of departed member", err)
+	}
+
+	streams, err := a.Store.OwnerStreams(m.GuildID, m.User.ID)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("Error loading streams for departed member", err)
+		return
+	}
+	for _, stream := range streams {
+		err = a.deleteStream(stream)
+		if err != nil {
+			raven.CaptureErrorAndWait(err, nil)
+			log.Error("Error removing "+stream.String(), err)
+			continue
+		}
+		log.Notice("Removed stream of departed member", stream.String())
+	}
 }
 
-func guildMemberUpdate(s *discordgo.Session, m *discordgo.GuildMemberUpdate) {
-	j, _ := json.Marshal(m)
-	fmt.Println("guildMemberUpdate", string(j))
+func (a *App) guildMemberUpdate(_ *discordgo.Session, m *discordgo.GuildMemberUpdate) {
+	err := a.syncOwnerNames(m.GuildID, m.Member)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("Error updating names for "+m.User.ID, err)
+	}
+}
+
+// syncOwnerNames copies a member's current names onto all their streams in the guild
+func (a *App) syncOwnerNames(guildID string, member *discordgo.Member) error {
+	stream := &Stream{}
+	stream.SetOwner(member.User, member.Nick)
+	return a.Store.UpdateOwnerNames(guildID, stream)
+}
+
+// ownerNamesChanged is true when the stream has stale names for the member
+func ownerNamesChanged(stream Stream, member *discordgo.Member) bool {
+	updated := stream
+	updated.SetOwner(member.User, member.Nick)
+	return updated != stream
 }
 
 // This function will be called (due to AddHandler above) every time a new
 // message is created on any channel that the autenticated bot has access to.
-func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
-	var err error
-	var streamUserID string
-	var streamUsername string
-	var streamType StreamType
-
+func (a *App) messageCreate(_ *discordgo.Session, m *discordgo.MessageCreate) {
 	// {"id":"574301262057832479","channel_id":"110893872388825088","guild_id":"110893872388825088","content":"test test","timestamp":"2019-05-04T18:28:10.876000+00:00","edited_timestamp":"","mention_roles":[],"tts":false,"mention_everyone":false,"author":{"id":"105880217595211776","email":"","username":"halkeye","avatar":"26ed135d310388b8985b0b4af91bf9d5","locale":"","discriminator":"1337","token":"","verified":false,"mfa_enabled":false,"bot":false},"attachments":[],"embeds":[],"mentions":[],"reactions":null,"type":0,"webhook_id":""}
 
 	// messageCreate {"id":"574427767161225216","channel_id":"574047051608883214","content":"this is my private message","timestamp":"2019-05-05T02:50:52.043000+00:00","edited_timestamp":"","mention_roles":[],"tts":false,"mention_everyone":false,"author":{"id":"105880217595211776","email":"","username":"halkeye","avatar":"26ed135d310388b8985b0b4af91bf9d5","locale":"","discriminator":"1337","token":"","verified":false,"mfa_enabled":false,"bot":false},"attachments":[],"embeds":[],"mentions":[],"reactions":null,"type":0,"webhook_id":""}
 
 	// Ignore all messages created by the bot itself
 	// This isn't required in this specific example but it's a good practice.
-	if m.Author.ID == s.State.User.ID {
+	if m.Author.ID == a.Discord.BotUserID() {
 		return
 	}
 
-	if strings.HasPrefix(strings.ToLower(m.Content), "!addtwitch ") {
-		if m.GuildID == "" {
-			s.ChannelMessageSend(m.ChannelID, "Private messages are not currently supported")
-			return
-		}
-		streamType, streamUsername, err = streamFromText(strings.TrimSpace(m.Content[len("!addTwitch "):len(m.Content)]))
-		if err != nil {
-			s.ChannelMessageSend(m.ChannelID, "Error processing text")
-			raven.CaptureErrorAndWait(err, nil)
-			log.Error("Error processing message: "+m.Content, err)
-			return
-		}
-
-		if streamType == StreamTwitch {
-			twitchClient := twitch.NewClient(viper.GetString("twitch.client_id"))
-			twitchUsers, err := twitchClient.GetUsersByLogin(streamUsername)
-			if err != nil {
-				s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("User does not exist, or twitch is having errors: %s", err))
-				raven.CaptureErrorAndWait(err, nil)
-				log.Error("Looking up username: "+m.Content, err)
-				return
-			}
-			streamUserID = twitchUsers[0].ID
-		}
-
-		stream := &Stream{
-			GuildID:            m.GuildID,
-			OwnerID:            m.Author.ID,
-			OwnerName:          m.Author.Username,
-			OwnerDiscriminator: m.Author.Discriminator,
-			Type:               streamType,
-			StreamUsername:     streamUsername,
-			StreamUserID:       streamUserID,
-		}
-		j, _ := json.Marshal(stream)
-		fmt.Println("stream", string(j))
-
-		_, err = db.Model(stream).OnConflict("(guild_id, owner_id) DO UPDATE").Set("owner_name=EXCLUDED.owner_name, owner_discriminator=EXCLUDED.owner_discriminator, type=EXCLUDED.type, stream_username=EXCLUDED.stream_username, stream_user_id=EXCLUDED.stream_user_id").Insert()
-		if err != nil {
-			raven.CaptureErrorAndWait(err, nil)
-			log.Error("Error saving guild", err)
-			return
-		}
-		log.Notice(m.Author.Username, "Added new twitch", stream.URL())
-		s.ChannelMessageSend(m.ChannelID, "Added the URL: "+stream.URL())
+	ctx := &commandContext{
+		App:       a,
+		Session:   a.Discord,
+		GuildID:   m.GuildID,
+		ChannelID: m.ChannelID,
+		Author:    m.Author,
+		Member:    m.Member,
+		Mentions:  m.Mentions,
+		BotUserID: a.Discord.BotUserID(),
+		Prefix:    a.Guilds.Prefix(m.GuildID),
+	}
+	if commands.Dispatch(ctx, m.Content) {
 		return
 	}
 
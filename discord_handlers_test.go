@@ -0,0 +1,161 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestDepartedStreams(t *testing.T) {
+	streams := []Stream{
+		Stream{ID: 1, OwnerID: "stayed"},
+		Stream{ID: 2, OwnerID: "left"},
+		Stream{ID: 3, OwnerID: "stayed"},
+		Stream{ID: 4, OwnerID: "kicked"},
+	}
+	members := map[string]*discordgo.Member{"stayed": &discordgo.Member{}, "someone": &discordgo.Member{}}
+
+	departed := departedStreams(streams, members)
+	if len(departed) != 2 || departed[0].ID != 2 || departed[1].ID != 4 {
+		t.Errorf("departedStreams() = %v; want streams 2 and 4", departed)
+	}
+}
+
+func TestOwnerNamesChanged(t *testing.T) {
+	stream := Stream{ID: 1, OwnerID: "1", OwnerName: "halkeye", OwnerDiscriminator: "1337"}
+
+	items := [][]interface{}{
+		[]interface{}{&discordgo.Member{User: &discordgo.User{ID: "1", Username: "halkeye", Discriminator: "1337"}}, false},
+		[]interface{}{&discordgo.Member{Nick: "Gavin", User: &discordgo.User{ID: "1", Username: "halkeye", Discriminator: "1337"}}, true},
+		[]interface{}{&discordgo.Member{User: &discordgo.User{ID: "1", Username: "halkeye", Discriminator: "0", GlobalName: "Halkeye"}}, true},
+	}
+
+	for _, item := range items {
+		member := item[0].(*discordgo.Member)
+		if got := ownerNamesChanged(stream, member); got != item[1].(bool) {
+			t.Errorf("ownerNamesChanged(%+v) = %t; want %t", member.User, got, item[1].(bool))
+		}
+	}
+}
+
+func TestMessageCreate(t *testing.T) {
+	app, discord := newTestApp(t, nil)
+	app.Guilds.Set(&Guild{ID: "guild", Prefix: "?"})
+
+	items := [][]interface{}{
+		// content, author, reply, streams saved
+		[]interface{}{"?addTwitch https://fake.example.com/halkeye", "author", "Added the URL: https://fake.example.com/halkeye", 1},
+		[]interface{}{"!addTwitch https://fake.example.com/wrongprefix", "author", "", 1},
+		[]interface{}{"?addTwitch https://fake.example.com/itself", "bot", "", 1},
+		[]interface{}{"just chatting", "author", "", 1},
+		[]interface{}{"?addTwitch", "author", "Usage: ?addStream <url>", 1},
+		[]interface{}{"?myStreams", "newcomer", "No streams have been added yet, use ?addStream <url>", 1},
+	}
+
+	for _, item := range items {
+		sent := len(discord.sent)
+		app.messageCreate(nil, &discordgo.MessageCreate{Message: &discordgo.Message{
+			GuildID:   "guild",
+			ChannelID: "channel",
+			Content:   item[0].(string),
+			Author:    &discordgo.User{ID: item[1].(string), Username: "halkeye"},
+		}})
+
+		reply := ""
+		if len(discord.sent) > sent {
+			reply = discord.sent[len(discord.sent)-1]
+		}
+		if reply != item[2].(string) {
+			t.Errorf("messageCreate(%q) replied %q; want %q", item[0].(string), reply, item[2].(string))
+		}
+		streams, _ := app.Store.GuildStreams("guild")
+		if len(streams) != item[3].(int) {
+			t.Errorf("messageCreate(%q) left %d streams; want %d", item[0].(string), len(streams), item[3].(int))
+		}
+	}
+}
+
+func TestGuildHandlers(t *testing.T) {
+	app, discord := newTestApp(t, nil)
+	owner := &discordgo.User{ID: "owner", Username: "halkeye"}
+	member := &discordgo.User{ID: "member", Username: "streamer"}
+
+	app.guildUpdate(nil, &discordgo.GuildUpdate{Guild: &discordgo.Guild{
+		ID:      "1",
+		Name:    "Streamers",
+		OwnerID: "owner",
+		Members: []*discordgo.Member{&discordgo.Member{User: owner}},
+	}})
+	guild, err := app.Store.GetGuild("1")
+	if err != nil || guild.Owner != "halkeye" || !app.Guilds.Has("1") {
+		t.Fatalf("guildUpdate() saved %v, %v", guild, err)
+	}
+
+	// without member events the owner isn't in the guild's members
+	discord.members["2"] = []*discordgo.Member{&discordgo.Member{User: &discordgo.User{ID: "other", Username: "someone"}}}
+	app.guildUpdate(nil, &discordgo.GuildUpdate{Guild: &discordgo.Guild{ID: "2", Name: "Others", OwnerID: "other"}})
+	guild, err = app.Store.GetGuild("2")
+	if err != nil || guild.Owner != "someone" || !app.Guilds.Has("2") {
+		t.Errorf("guildUpdate() without members saved %v, %v", guild, err)
+	}
+
+	mustAddStream(t, app.Store, Stream{GuildID: "1", OwnerID: "member", OwnerName: "streamer", Type: streamFake, StreamUsername: "streamer"})
+	app.guildMemberUpdate(nil, &discordgo.GuildMemberUpdate{Member: &discordgo.Member{GuildID: "1", Nick: "Renamed", User: member}})
+	streams, _ := app.Store.GuildStreams("1")
+	if len(streams) != 1 || streams[0].OwnerNick != "Renamed" {
+		t.Errorf("guildMemberUpdate() left %v; want the new nick saved", streams)
+	}
+
+	err = app.Store.AddAPIToken(&APIToken{GuildID: "1", OwnerID: "member", Name: "script", TokenHash: hashAPIToken("secret"), Scope: apiScopeRead})
+	if err != nil {
+		t.Fatalf("AddAPIToken() got an error: %s", err)
+	}
+	app.guildMemberRemove(nil, &discordgo.GuildMemberRemove{Member: &discordgo.Member{GuildID: "1", User: member}})
+	if streams, _ := app.Store.GuildStreams("1"); len(streams) != 0 {
+		t.Errorf("guildMemberRemove() left %v", streams)
+	}
+	if _, err := app.Store.FindAPIToken(hashAPIToken("secret")); err != errNotFound {
+		t.Errorf("guildMemberRemove() left the member's api token: %v", err)
+	}
+
+	app.guildDelete(nil, &discordgo.GuildDelete{Guild: &discordgo.Guild{ID: "1", Unavailable: true}})
+	if _, err := app.Store.GetGuild("1"); err != nil || !app.Guilds.Has("1") {
+		t.Errorf("guildDelete() during an outage removed the guild: %v", err)
+	}
+	app.guildDelete(nil, &discordgo.GuildDelete{Guild: &discordgo.Guild{ID: "1"}})
+	if _, err := app.Store.GetGuild("1"); err != errNotFound || app.Guilds.Has("1") {
+		t.Errorf("guildDelete() kept the guild: %v", err)
+	}
+}
+
+func TestReconcileMembers(t *testing.T) {
+	app, discord := newTestApp(t, nil)
+	err := app.Store.SaveGuild(&Guild{ID: "1", Name: "Streamers"})
+	if err != nil {
+		t.Fatalf("SaveGuild() got an error: %s", err)
+	}
+	_, err = app.Store.UpdateGuildSetting("1", "live_role_id", "role")
+	if err != nil {
+		t.Fatalf("UpdateGuildSetting() got an error: %s", err)
+	}
+	stayed := mustAddStream(t, app.Store, Stream{GuildID: "1", OwnerID: "stayed", OwnerName: "old name", Type: streamFake, StreamUsername: "stayed"})
+	stayed.Live = true
+	app.Store.SetLive(&stayed)
+	mustAddStream(t, app.Store, Stream{GuildID: "1", OwnerID: "left", OwnerName: "left", Type: streamFake, StreamUsername: "left"})
+
+	// large guilds only send part of the member list, the rest comes from GuildMembers
+	discord.members["1"] = []*discordgo.Member{
+		&discordgo.Member{User: &discordgo.User{ID: "stayed", Username: "new name"}},
+		&discordgo.Member{User: &discordgo.User{ID: "unrelated", Username: "someone"}, Roles: []string{"role"}},
+	}
+	app.reconcileMembers(&discordgo.Guild{ID: "1", Large: true})
+
+	streams, _ := app.Store.GuildStreams("1")
+	if len(streams) != 1 || streams[0].OwnerID != "stayed" || streams[0].OwnerName != "new name" {
+		t.Errorf("reconcileMembers() left %v; want only the renamed stream of the member who stayed", streams)
+	}
+	if strings.Join(discord.roles, ",") != "+stayed role,-unrelated role" {
+		t.Errorf("reconcileMembers() changed roles %v; want stayed added and unrelated removed", discord.roles)
+	}
+}
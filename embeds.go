@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// limits discord enforces on embeds
+const (
+	discordEmbedTitleLimit       = 256
+	discordEmbedDescriptionLimit = 4096
+	discordEmbedFieldLimit       = 25
+	discordEmbedFieldNameLimit   = 256
+	discordEmbedFieldValueLimit  = 1024
+	// discordEmbedTotalLimit covers the title, description, fields, footer and author together
+	discordEmbedTotalLimit = 6000
+)
+
+// streamColors are the brand colours used down the side of embeds
+var streamColors = map[StreamType]int{
+	StreamTwitch:  0x9146ff,
+	StreamYouTube: 0xff0000,
+}
+
+// canEmbed checks if the bot is allowed to send embeds in a channel
+func canEmbed(session discordSession, botUserID string, channelID string) bool {
+	perms, err := session.UserChannelPermissions(botUserID, channelID)
+	if err != nil {
+		log.Warning("Unable to check embed permissions in", channelID, err)
+		return false
+	}
+	return perms&discordgo.PermissionEmbedLinks != 0
+}
+
+func streamEmbedAuthor(stream Stream) *discordgo.MessageEmbedAuthor {
+	return &discordgo.MessageEmbedAuthor{
+		Name:    stream.OwnerDisplayName(),
+		IconURL: stream.OwnerAvatarURL(),
+	}
+}
+
+// liveStreamEmbed shows what a live stream is doing, it is used for go-live announcements
+func liveStreamEmbed(stream Stream) *discordgo.MessageEmbed {
+	title := stream.Title
+	if title == "" {
+		title = stream.OwnerDisplayName() + " is live on " + stream.Type.String()
+	}
+	embed := &discordgo.MessageEmbed{
+		Title:  truncateText(title, discordEmbedTitleLimit),
+		URL:    stream.URL(),
+		Color:  streamColors[stream.Type],
+		Author: streamEmbedAuthor(stream),
+		Footer: &discordgo.MessageEmbedFooter{Text: stream.Type.String()},
+	}
+	if stream.Game != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Playing", Value: truncateText(stream.Game, discordEmbedFieldValueLimit), Inline: true})
+	}
+	embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Viewers", Value: fmt.Sprint(stream.ViewerCount), Inline: true})
+	if stream.ThumbnailURL != "" {
+		embed.Image = &discordgo.MessageEmbedImage{URL: stream.ThumbnailURL}
+	}
+	if !stream.LiveSince.IsZero() {
+		embed.Timestamp = stream.LiveSince.Format(time.RFC3339)
+	}
+	return embed
+}
+
+// addedStreamEmbed confirms a stream was added
+func addedStreamEmbed(stream Stream) *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Title:       "Added " + stream.Type.String() + " stream",
+		URL:         stream.URL(),
+		Description: stream.URL(),
+		Color:       streamColors[stream.Type],
+		Author:      streamEmbedAuthor(stream),
+	}
+}
+
+// streamListEmbed is the embed version of formatStreamList
+func streamListEmbed(streams []Stream, whose string) *discordgo.MessageEmbed {
+	lines := []string{}
+	for idx, stream := range streams {
+		line := fmt.Sprintf("%d. [%s](%s)", idx+1, stream.Type, stream.URL())
+		if stream.Live {
+			line += " - live now"
+		}
+		lines = append(lines, line)
+	}
+	embed := &discordgo.MessageEmbed{
+		Title:       whose + " streams",
+		Description: truncateText(strings.Join(lines, "\n"), discordEmbedDescriptionLimit),
+	}
+	if len(streams) > 0 {
+		embed.Author = streamEmbedAuthor(streams[0])
+	}
+	return embed
+}
+
+// liveListEmbed has a field for each live stream, as many as fit in an embed
+func liveListEmbed(streams []Stream) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{Title: "Live right now"}
+	// leave room for the "and N more" footer
+	size := utf8.RuneCountInString(embed.Title) + len("and 1000 more")
+	for idx, stream := range streams {
+		value := stream.URL()
+		if stream.Title != "" {
+			value = fmt.Sprintf("[%s](%s)", stream.Title, stream.URL())
+		}
+		details := []string{}
+		if stream.Game != "" {
+			details = append(details, stream.Game)
+		}
+		details = append(details, fmt.Sprintf("%d viewers", stream.ViewerCount))
+		if !stream.LiveSince.IsZero() {
+			details = append(details, fmt.Sprintf("since <t:%d:t>", stream.LiveSince.Unix()))
+		}
+		value += "\n" + strings.Join(details, " · ")
+		field := &discordgo.MessageEmbedField{
+			Name:  truncateText(stream.OwnerDisplayName(), discordEmbedFieldNameLimit),
+			Value: truncateText(value, discordEmbedFieldValueLimit),
+		}
+
+		size += utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+		if len(embed.Fields) == discordEmbedFieldLimit || size > discordEmbedTotalLimit {
+			embed.Footer = &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("and %d more", len(streams)-idx)}
+			break
+		}
+		embed.Fields = append(embed.Fields, field)
+	}
+	return embed
+}
+
+// endedStreamEmbed replaces liveStreamEmbed once the stream is over
+func endedStreamEmbed(stream Stream, endedAt time.Time) *discordgo.MessageEmbed {
+	title := stream.Title
+	if title == "" {
+		title = stream.OwnerDisplayName() + " was live on " + stream.Type.String()
+	}
+	embed := &discordgo.MessageEmbed{
+		Title:       truncateText(title, discordEmbedTitleLimit),
+		URL:         stream.URL(),
+		Description: stream.OwnerDisplayName() + " was live",
+		Author:      streamEmbedAuthor(stream),
+		Footer:      &discordgo.MessageEmbedFooter{Text: stream.Type.String()},
+		Timestamp:   endedAt.Format(time.RFC3339),
+	}
+	if !stream.LiveSince.IsZero() {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Streamed for", Value: formatDuration(endedAt.Sub(stream.LiveSince)), Inline: true})
+	}
+	embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Peak viewers", Value: fmt.Sprint(stream.PeakViewers), Inline: true})
+	if stream.Game != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Played", Value: truncateText(stream.Game, discordEmbedFieldValueLimit), Inline: true})
+	}
+	return embed
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestReplyEmbed(t *testing.T) {
+	items := [][]interface{}{
+		// permissions, embeds sent, text sent
+		[]interface{}{int64(0), 0, "fallback"},
+		[]interface{}{int64(discordgo.PermissionEmbedLinks), 1, ""},
+	}
+
+	for _, item := range items {
+		session := &fakeSession{permissions: item[0].(int64)}
+		newTestContext(session, "guild").ReplyEmbed(&discordgo.MessageEmbed{Title: "embed"}, "fallback")
+		if len(session.embeds) != item[1].(int) || strings.Join(session.sent, "\n") != item[2].(string) {
+			t.Errorf("ReplyEmbed with permissions %d sent %d embeds and %q; want %d and %q", item[0].(int64), len(session.embeds), session.sent, item[1].(int), item[2].(string))
+		}
+	}
+}
+
+func TestLiveStreamEmbed(t *testing.T) {
+	stream := Stream{
+		OwnerID:        "105880217595211776",
+		OwnerName:      "halkeye",
+		OwnerAvatar:    "26ed135d310388b8985b0b4af91bf9d5",
+		Type:           StreamTwitch,
+		StreamUsername: "halkeye",
+		Title:          strings.Repeat("a", 300),
+		Game:           "Science & Technology",
+		ViewerCount:    42,
+		ThumbnailURL:   "https://static-cdn.jtvnw.net/previews-ttv/live_user_halkeye-640x360.jpg",
+		LiveSince:      time.Date(2019, 5, 5, 2, 50, 52, 0, time.UTC),
+	}
+
+	embed := liveStreamEmbed(stream)
+	if len([]rune(embed.Title)) != discordEmbedTitleLimit {
+		t.Errorf("title is %d characters; want it cut to %d", len([]rune(embed.Title)), discordEmbedTitleLimit)
+	}
+	if embed.URL != "https://www.twitch.tv/halkeye" || embed.Image.URL != stream.ThumbnailURL || embed.Timestamp != "2019-05-05T02:50:52Z" {
+		t.Errorf("liveStreamEmbed() = %+v; want the url, thumbnail and start time", embed)
+	}
+	if !strings.Contains(embed.Author.IconURL, "26ed135d310388b8985b0b4af91bf9d5") {
+		t.Errorf("author icon = %s; want the owner's avatar", embed.Author.IconURL)
+	}
+	if len(embed.Fields) != 2 || embed.Fields[0].Value != "Science & Technology" || embed.Fields[1].Value != "42" {
+		t.Errorf("fields = %+v; want the game and viewer count", embed.Fields)
+	}
+}
+
+func TestLiveListEmbedLimit(t *testing.T) {
+	streams := []Stream{}
+	for i := 0; i < 30; i++ {
+		streams = append(streams, Stream{OwnerName: "halkeye", StreamUsername: "halkeye"})
+	}
+
+	embed := liveListEmbed(streams)
+	if len(embed.Fields) != discordEmbedFieldLimit {
+		t.Errorf("liveListEmbed() has %d fields; want %d", len(embed.Fields), discordEmbedFieldLimit)
+	}
+	if embed.Footer == nil || embed.Footer.Text != "and 5 more" {
+		t.Errorf("footer = %+v; want and 5 more", embed.Footer)
+	}
+
+	long := []Stream{}
+	for i := 0; i < 10; i++ {
+		long = append(long, Stream{OwnerName: "halkeye", StreamUsername: "halkeye", Title: strings.Repeat("a", discordEmbedFieldValueLimit)})
+	}
+	embed = liveListEmbed(long)
+	if embed.Footer == nil {
+		t.Fatalf("liveListEmbed() of long titles has no footer; want one counting the rest")
+	}
+	size := len(embed.Title) + len(embed.Footer.Text)
+	for _, field := range embed.Fields {
+		size += utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+	}
+	if size > discordEmbedTotalLimit || embed.Footer.Text != fmt.Sprintf("and %d more", len(long)-len(embed.Fields)) {
+		t.Errorf("liveListEmbed() of long titles is %d characters with footer %+v; want at most %d", size, embed.Footer, discordEmbedTotalLimit)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	fakeDiscordBotID = "100"
+	fakeDiscordAppID = "101"
+)
+
+// fakeDiscordServer is an in-process discord, the rest api the bot and the
+// dashboard logins use along with a gateway the test sends events through.
+type fakeDiscordServer struct {
+	*httptest.Server
+	t  *testing.T
+	mu sync.Mutex
+	// users are the dashboard users by access token
+	users map[string]fakeDiscordUser
+	// codes are the access tokens handed out for oauth codes
+	codes    map[string]string
+	messages []*discordgo.Message
+
+	gatewayMu sync.Mutex
+	gateway   *websocket.Conn
+	sequence  int64
+	// identified is closed once the bot has logged in to the gateway
+	identified chan struct{}
+}
+
+func newFakeDiscordServer(t *testing.T) *fakeDiscordServer {
+	f := &fakeDiscordServer{
+		t:          t,
+		users:      map[string]fakeDiscordUser{},
+		codes:      map[string]string{},
+		identified: make(chan struct{}),
+	}
+
+	r := mux.NewRouter()
+	r.PathPrefix("/gateway").HandlerFunc(f.serveGateway)
+	api := r.PathPrefix("/api/v9").Subrouter()
+	api.HandleFunc("/gateway", f.getGateway).Methods("GET")
+	api.HandleFunc("/oauth2/authorize", f.authorize).Methods("GET")
+	api.HandleFunc("/oauth2/token", f.token).Methods("POST")
+	api.HandleFunc("/users/@me", f.getUser).Methods("GET")
+	api.HandleFunc("/users/@me/guilds", f.getUserGuilds).Methods("GET")
+	api.HandleFunc("/applications/{appID}/commands", f.overwriteCommands).Methods("PUT")
+	api.HandleFunc("/channels/{channelID}/messages", f.createMessage).Methods("POST")
+	api.HandleFunc("/guilds/{guildID}/members", f.listMembers).Methods("GET")
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("fake discord doesn't handle %s %s", r.Method, r.URL)
+		http.NotFound(w, r)
+	})
+	r.MethodNotAllowedHandler = r.NotFoundHandler
+
+	f.Server = httptest.NewServer(r)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// APIURL is what discord.api_url is set to
+func (f *fakeDiscordServer) APIURL() string {
+	return f.URL + "/api/v9/"
+}
+
+// AddUser lets someone log in to the dashboard, code is what discord hands
+// back to the auth callback once they have authorized it
+func (f *fakeDiscordServer) AddUser(code string, accessToken string, user fakeDiscordUser) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.codes[code] = accessToken
+	f.users[accessToken] = user
+}
+
+// Messages are what the bot has sent to a channel
+func (f *fakeDiscordServer) Messages(channelID string) []*discordgo.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	messages := []*discordgo.Message{}
+	for _, message := range f.messages {
+		if message.ChannelID == channelID {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// Dispatch sends a gateway event to the bot once it has logged in
+func (f *fakeDiscordServer) Dispatch(event string, data interface{}) {
+	select {
+	case <-f.identified:
+	case <-time.After(5 * time.Second):
+		f.t.Fatalf("bot never logged in to the gateway to get %s", event)
+	}
+
+	f.gatewayMu.Lock()
+	defer f.gatewayMu.Unlock()
+	f.sequence++
+	err := f.gateway.WriteJSON(map[string]interface{}{"op": 0, "t": event, "s": f.sequence, "d": data})
+	if err != nil {
+		f.t.Fatalf("sending %s got an error: %s", event, err)
+	}
+}
+
+func (f *fakeDiscordServer) getGateway(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"url": "ws" + strings.TrimPrefix(f.URL, "http") + "/gateway"})
+}
+
+// serveGateway says hello, waits for the bot to identify and tells it it's
+// ready. After that heartbeats are acked and everything else is ignored.
+func (f *fakeDiscordServer) serveGateway(w http.ResponseWriter, r *http.Request) {
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		f.t.Errorf("upgrading the gateway got an error: %s", err)
+		return
+	}
+	defer conn.Close()
+
+	f.gatewayMu.Lock()
+	f.gateway = conn
+	err = conn.WriteJSON(map[string]interface{}{"op": 10, "d": map[string]int{"heartbeat_interval": 45000}})
+	f.gatewayMu.Unlock()
+	if err != nil {
+		f.t.Errorf("sending hello got an error: %s", err)
+		return
+	}
+
+	for {
+		var payload struct {
+			Op int `json:"op"`
+		}
+		err := conn.ReadJSON(&payload)
+		if err != nil {
+			// the bot disconnected
+			return
+		}
+
+		switch payload.Op {
+		case 1:
+			f.gatewayMu.Lock()
+			conn.WriteJSON(map[string]interface{}{"op": 11})
+			f.gatewayMu.Unlock()
+		case 2:
+			f.gatewayMu.Lock()
+			f.sequence++
+			conn.WriteJSON(map[string]interface{}{"op": 0, "t": "READY", "s": f.sequence, "d": map[string]interface{}{
+				"v":           9,
+				"session_id":  "fake-session",
+				"user":        map[string]interface{}{"id": fakeDiscordBotID, "username": "streamers", "bot": true},
+				"application": map[string]string{"id": fakeDiscordAppID},
+				"guilds":      []interface{}{},
+			}})
+			f.gatewayMu.Unlock()
+			close(f.identified)
+		}
+	}
+}
+
+func (f *fakeDiscordServer) authorize(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// whoever asks first is logged in
+	for code := range f.codes {
+		http.Redirect(w, r, r.URL.Query().Get("redirect_uri")+"?code="+code+"&state="+r.URL.Query().Get("state"), http.StatusFound)
+		return
+	}
+	http.Error(w, "no users", http.StatusForbidden)
+}
+
+func (f *fakeDiscordServer) token(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r.ParseForm()
+	accessToken, ok := f.codes[r.PostForm.Get("code")]
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   604800,
+		"scope":        "guilds identify",
+	})
+}
+
+// dashboardUser is the user the bearer token belongs to
+func (f *fakeDiscordServer) dashboardUser(w http.ResponseWriter, r *http.Request) (fakeDiscordUser, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	user, ok := f.users[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"code": 0, "message": "401: Unauthorized"})
+	}
+	return user, ok
+}
+
+func (f *fakeDiscordServer) getUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := f.dashboardUser(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, user.user)
+}
+
+func (f *fakeDiscordServer) getUserGuilds(w http.ResponseWriter, r *http.Request) {
+	user, ok := f.dashboardUser(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, user.guilds)
+}
+
+func (f *fakeDiscordServer) overwriteCommands(w http.ResponseWriter, r *http.Request) {
+	var commands []*discordgo.ApplicationCommand
+	err := json.NewDecoder(r.Body).Decode(&commands)
+	if err != nil {
+		f.t.Errorf("registering commands sent bad json: %s", err)
+	}
+	writeJSON(w, http.StatusOK, commands)
+}
+
+func (f *fakeDiscordServer) createMessage(w http.ResponseWriter, r *http.Request) {
+	var data discordgo.MessageSend
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		f.t.Errorf("sending a message sent bad json: %s", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	message := &discordgo.Message{
+		ID:        strconv.Itoa(len(f.messages) + 1),
+		ChannelID: mux.Vars(r)["channelID"],
+		Content:   data.Content,
+		Embeds:    data.Embeds,
+	}
+	f.messages = append(f.messages, message)
+	writeJSON(w, http.StatusOK, message)
+}
+
+// listMembers has nobody, guilds are sent with all their members
+func (f *fakeDiscordServer) listMembers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, []*discordgo.Member{})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const fakeHelixAppToken = "fake-app-token"
+
+// fakeHelix is an in-process twitch helix api along with the endpoint that
+// hands out app tokens. It only knows the users and streams a test gives it.
+type fakeHelix struct {
+	*httptest.Server
+	t  *testing.T
+	mu sync.Mutex
+	// users are twitch user ids by login
+	users map[string]string
+	// live are the live streams by user id
+	live  map[string]liveStatus
+	games map[string]string
+}
+
+func newFakeHelix(t *testing.T) *fakeHelix {
+	f := &fakeHelix{t: t, users: map[string]string{}, live: map[string]liveStatus{}, games: map[string]string{}}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/oauth2/token", f.token).Methods("POST")
+	helix := r.PathPrefix("/helix").Subrouter()
+	helix.Use(f.authenticate)
+	helix.HandleFunc("/users", f.getUsers).Methods("GET")
+	helix.HandleFunc("/streams", f.getStreams).Methods("GET")
+	helix.HandleFunc("/games", f.getGames).Methods("GET")
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("fake helix doesn't handle %s %s", r.Method, r.URL)
+		http.NotFound(w, r)
+	})
+
+	f.Server = httptest.NewServer(r)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// APIURL is what twitch.api_url is set to
+func (f *fakeHelix) APIURL() string {
+	return f.URL + "/helix"
+}
+
+// TokenURL is what twitch.token_url is set to
+func (f *fakeHelix) TokenURL() string {
+	return f.URL + "/oauth2/token"
+}
+
+func (f *fakeHelix) AddUser(login string, id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users[login] = id
+}
+
+func (f *fakeHelix) AddGame(id string, name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.games[id] = name
+}
+
+// SetLive starts a stream, a zero status ends it
+func (f *fakeHelix) SetLive(userID string, status liveStatus) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if status == (liveStatus{}) {
+		delete(f.live, userID)
+		return
+	}
+	f.live[userID] = status
+}
+
+func (f *fakeHelix) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	if r.PostForm.Get("grant_type") != "client_credentials" {
+		http.Error(w, `{"message":"invalid grant type"}`, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": fakeHelixAppToken,
+		"expires_in":   3600,
+		"token_type":   "bearer",
+	})
+}
+
+func (f *fakeHelix) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+fakeHelixAppToken || r.Header.Get("Client-Id") == "" {
+			http.Error(w, `{"message":"invalid token"}`, http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (f *fakeHelix) getUsers(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data := []map[string]interface{}{}
+	for _, login := range r.URL.Query()["login"] {
+		if id, ok := f.users[login]; ok {
+			data = append(data, map[string]interface{}{"id": id, "login": login, "display_name": login})
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": data})
+}
+
+func (f *fakeHelix) getStreams(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data := []map[string]interface{}{}
+	for _, id := range r.URL.Query()["user_id"] {
+		if status, ok := f.live[id]; ok {
+			data = append(data, map[string]interface{}{
+				"id":            "stream-" + id,
+				"user_id":       id,
+				"game_id":       status.GameID,
+				"type":          "live",
+				"title":         status.Title,
+				"viewer_count":  status.ViewerCount,
+				"started_at":    status.StartedAt.Format(time.RFC3339),
+				"thumbnail_url": status.ThumbnailURL,
+			})
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": data, "pagination": map[string]string{}})
+}
+
+func (f *fakeHelix) getGames(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data := []map[string]string{}
+	for _, id := range r.URL.Query()["id"] {
+		if name, ok := f.games[id]; ok {
+			data = append(data, map[string]string{"id": id, "name": name})
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": data})
+}
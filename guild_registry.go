@@ -0,0 +1,86 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// guildRegistry is the cached copy of every guild the bot is in. Discord events
+// update it while web requests read it, so it is guarded by a lock.
+// Guilds are replaced rather than changed in place, so callers can keep the
+// pointers Get returns.
+type guildRegistry struct {
+	mu     sync.RWMutex
+	guilds map[string]*Guild
+}
+
+func newGuildRegistry() *guildRegistry {
+	return &guildRegistry{guilds: map[string]*Guild{}}
+}
+
+// Get returns the cached guild
+func (r *guildRegistry) Get(id string) (*Guild, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	guild, ok := r.guilds[id]
+	return guild, ok
+}
+
+// Has checks if the bot is in a guild
+func (r *guildRegistry) Has(id string) bool {
+	_, ok := r.Get(id)
+	return ok
+}
+
+// Set adds or replaces a guild
+func (r *guildRegistry) Set(guild *Guild) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.guilds[guild.ID] = guild
+}
+
+// Delete forgets a guild the bot left
+func (r *guildRegistry) Delete(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.guilds, id)
+}
+
+// Prefix returns the command prefix for a guild
+func (r *guildRegistry) Prefix(guildID string) string {
+	if guild, ok := r.Get(guildID); ok {
+		return guild.CommandPrefix()
+	}
+	return defaultPrefix
+}
+
+// All returns every guild sorted by id
+func (r *guildRegistry) All() []*Guild {
+	r.mu.RLock()
+	guilds := make([]*Guild, 0, len(r.guilds))
+	for _, guild := range r.guilds {
+		guilds = append(guilds, guild)
+	}
+	r.mu.RUnlock()
+	sort.Slice(guilds, func(i, j int) bool { return guilds[i].ID < guilds[j].ID })
+	return guilds
+}
+
+// Load fills the registry from the store, so the dashboard works before
+// discord has sent every guild again after a restart. Guilds discord already
+// sent are kept since they are newer.
+func (r *guildRegistry) Load(store Store) error {
+	guilds, err := store.AllGuilds()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for idx := range guilds {
+		if _, ok := r.guilds[guilds[idx].ID]; !ok {
+			r.guilds[guilds[idx].ID] = &guilds[idx]
+		}
+	}
+	return nil
+}
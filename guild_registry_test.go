@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestGuildRegistry(t *testing.T) {
+	registry := newGuildRegistry()
+	registry.Set(&Guild{ID: "2", Name: "second"})
+	registry.Set(&Guild{ID: "1", Name: "first"})
+	registry.Set(&Guild{ID: "2", Name: "renamed"})
+	registry.Delete("3")
+
+	items := [][]interface{}{
+		[]interface{}{"1", true, "first"},
+		[]interface{}{"2", true, "renamed"},
+		[]interface{}{"3", false, ""},
+	}
+	for _, item := range items {
+		guild, ok := registry.Get(item[0].(string))
+		if ok != item[1].(bool) || registry.Has(item[0].(string)) != item[1].(bool) {
+			t.Errorf("Get(%s) found = %t; want %t", item[0].(string), ok, item[1].(bool))
+		}
+		if ok && guild.Name != item[2].(string) {
+			t.Errorf("Get(%s) = %s; want %s", item[0].(string), guild.Name, item[2].(string))
+		}
+	}
+
+	all := registry.All()
+	if len(all) != 2 || all[0].ID != "1" || all[1].ID != "2" {
+		t.Errorf("All() = %v; want guilds 1 and 2", all)
+	}
+	registry.Delete("1")
+	if registry.Has("1") || len(registry.All()) != 1 {
+		t.Errorf("Delete(1) left %v", registry.All())
+	}
+}
+
+func TestGuildRegistryLoad(t *testing.T) {
+	store := testSQLiteStore(t)
+	for _, guild := range []*Guild{&Guild{ID: "1", Name: "stored"}, &Guild{ID: "2", Name: "only stored"}} {
+		err := store.SaveGuild(guild)
+		if err != nil {
+			t.Fatalf("SaveGuild() got an error: %s", err)
+		}
+	}
+	_, err := store.UpdateGuildSetting("2", "prefix", "?")
+	if err != nil {
+		t.Fatalf("UpdateGuildSetting() got an error: %s", err)
+	}
+
+	registry := newGuildRegistry()
+	registry.Set(&Guild{ID: "1", Name: "from discord"})
+	err = registry.Load(store)
+	if err != nil {
+		t.Fatalf("Load() got an error: %s", err)
+	}
+
+	guild, _ := registry.Get("1")
+	if guild == nil || guild.Name != "from discord" {
+		t.Errorf("Load() replaced %v; want the guild discord sent kept", guild)
+	}
+	guild, _ = registry.Get("2")
+	if guild == nil || guild.Name != "only stored" || guild.CommandPrefix() != "?" {
+		t.Errorf("Load() = %v; want the stored guild with its settings", guild)
+	}
+}
+
+// TestGuildRegistryConcurrent is only useful with go test -race
+func TestGuildRegistryConcurrent(t *testing.T) {
+	store := testSQLiteStore(t)
+	err := store.SaveGuild(&Guild{ID: "stored"})
+	if err != nil {
+		t.Fatalf("SaveGuild() got an error: %s", err)
+	}
+	registry := newGuildRegistry()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				id := fmt.Sprintf("%d", j%10)
+				switch (i + j) % 5 {
+				case 0:
+					registry.Set(&Guild{ID: id, Prefix: "?"})
+				case 1:
+					registry.Delete(id)
+				case 2:
+					if guild, ok := registry.Get(id); ok {
+						_ = guild.CommandPrefix()
+					}
+				case 3:
+					for _, guild := range registry.All() {
+						_ = guild.ID
+					}
+				case 4:
+					err := registry.Load(store)
+					if err != nil {
+						t.Errorf("Load() got an error: %s", err)
+					}
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if !registry.Has("stored") {
+		t.Errorf("Load() didn't add the stored guild")
+	}
+}
@@ -8,7 +8,7 @@ import (
 	"github.com/etherlabsio/healthcheck"
 )
 
-func healthcheckHandler() http.Handler {
+func (a *App) healthcheckHandler() http.Handler {
 	return healthcheck.Handler(
 
 		// WithTimeout allows you to set a max overall timeout.
@@ -17,8 +17,7 @@ func healthcheckHandler() http.Handler {
 		healthcheck.WithChecker(
 			"database", healthcheck.CheckerFunc(
 				func(ctx context.Context) error {
-					_, err := db.ExecOneContext(ctx, "SELECT 'healthcheck check'")
-					return err
+					return a.Store.Ping(ctx)
 				},
 			),
 		),
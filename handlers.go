@@ -6,16 +6,19 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
+	"time"
 
-	twitch "github.com/Onestay/go-new-twitch"
 	"github.com/bwmarrin/discordgo"
 	"github.com/getsentry/raven-go"
+	"github.com/gorilla/mux"
 	"github.com/spf13/viper"
 	"golang.org/x/oauth2"
 )
 
-func getDiscordAccessTokenFromSession(r *http.Request) string {
-	session, err := store.Get(r, sessionStoreKey)
+func (a *App) getDiscordAccessTokenFromSession(r *http.Request) string {
+	session, err := a.Sessions.Get(r, sessionStoreKey)
 	if err != nil {
 		log.Info("error getting session,", err)
 		return ""
@@ -42,40 +45,48 @@ func validateGuildSelection(guilds []*discordgo.UserGuild, selectedGuildID strin
 	return fmt.Errorf("Selected a guildID that is not allowed")
 }
 
-func homePageHandler(w http.ResponseWriter, r *http.Request) {
-	var err error
-	var streams []Stream
+// dashboardGuilds returns the guilds the logged in user shares with the bot.
+// It writes the response itself and returns false if the user needs to log in.
+func (a *App) dashboardGuilds(w http.ResponseWriter, r *http.Request) ([]*discordgo.UserGuild, bool) {
 	var guilds []*discordgo.UserGuild
-	var selectedGuildID string
-	var twitchLogins []string
 
-	accessToken := getDiscordAccessTokenFromSession(r)
+	accessToken := a.getDiscordAccessTokenFromSession(r)
 	if accessToken == "" {
 		http.Redirect(w, r, "/start", 302)
-		return
+		return nil, false
 	}
 
-	clientDG, err := discordgo.New("Bearer " + accessToken)
+	clientDG, err := a.UserDiscord(accessToken)
 	if err != nil {
 		log.Error("error creating Discord session,", err)
 		http.Redirect(w, r, "/start", 302)
-		return
+		return nil, false
 	}
-	// Cleanly close down the Discord session.
-	defer clientDG.Close()
 
-	rawGuilds, err := clientDG.UserGuilds(100, "", "")
+	rawGuilds, err := clientDG.UserGuilds(100, "", "", false)
 	if err != nil {
 		raven.CaptureErrorAndWait(err, nil)
 		fmt.Fprintf(w, "Unable to get guilds")
 		log.Error("getting guilds", err)
-		return
+		return nil, false
 	}
 	for _, guild := range rawGuilds {
-		if _, ok := allGuilds[guild.ID]; ok {
+		if a.Guilds.Has(guild.ID) {
 			guilds = append(guilds, guild)
 		}
 	}
+	return guilds, true
+}
+
+func (a *App) homePageHandler(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var streams []Stream
+	var selectedGuildID string
+
+	guilds, ok := a.dashboardGuilds(w, r)
+	if !ok {
+		return
+	}
 	selectedGuildID = r.URL.Query().Get("guild")
 	if selectedGuildID == "" && len(guilds) > 0 {
 		selectedGuildID = guilds[0].ID
@@ -90,46 +101,44 @@ func homePageHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	err = db.Model(&streams).Where("guild_id=?", selectedGuildID).Select()
+	streams, err = a.Store.GuildStreams(selectedGuildID)
 	if err != nil {
 		raven.CaptureErrorAndWait(err, nil)
 		fmt.Fprintf(w, "Unable to get streams")
 		log.Error("getting streams", err)
 		return
 	}
-
+	sort.SliceStable(streams, func(i, j int) bool { return streams[i].OwnerName < streams[j].OwnerName })
+	liveStreams := []Stream{}
 	for _, stream := range streams {
-		twitchLogins = append(twitchLogins, stream.Channel())
-	}
-
-	streams = []Stream{}
-	twitchClient := twitch.NewClient(viper.GetString("twitch.client_id"))
-	twitchStreams, err := twitchClient.GetStreams(twitch.GetStreamsInput{
-		UserLogin: twitchLogins,
-	})
-
-	if len(twitchStreams) > 0 {
-		twitchLogins = []string{}
-		for _, stream := range twitchStreams {
-			twitchLogins = append(twitchLogins, stream.UserID)
-		}
-
-		err = db.Model(&streams).WhereIn("stream_user_id in (?)", twitchLogins).Select()
-		if err != nil {
-			raven.CaptureErrorAndWait(err, nil)
-			fmt.Fprintf(w, "Unable to get streams")
-			log.Error("getting streams", err)
-			return
+		if stream.Live {
+			liveStreams = append(liveStreams, stream)
 		}
 	}
 
 	data := map[string]interface{}{
+		"Tab":             "streams",
 		"SelectedGuildID": selectedGuildID,
-		"BotAddURL":       "https://discordapp.com/api/oauth2/authorize?client_id=" + viper.GetString("discord.client_id") + "&scope=bot&redirect_uri=" + url.QueryEscape(viper.GetString("self_url")),
-		"TwitchStreams":   streams,
+		"BotAddURL":       discordgo.EndpointOAuth2 + "authorize?client_id=" + viper.GetString("discord.client_id") + "&scope=bot&redirect_uri=" + url.QueryEscape(viper.GetString("self_url")),
+		"Streams":         liveStreams,
+		"AllStreams":      streams,
 		"Guilds":          guilds,
 		"Title":           "there",
 	}
+	if r.URL.Query().Get("tab") == "leaderboard" && selectedGuildID != "" {
+		now := time.Now()
+		for name, days := range leaderboardPeriods {
+			board, err := a.loadLeaderboard(selectedGuildID, now.AddDate(0, 0, -days), now)
+			if err != nil {
+				raven.CaptureErrorAndWait(err, nil)
+				fmt.Fprintf(w, "Unable to get the leaderboard")
+				log.Error("getting leaderboard", err)
+				return
+			}
+			data[name] = board
+		}
+		data["Tab"] = "leaderboard"
+	}
 	// j, _ := json.Marshal(data)
 	// fmt.Println("data", string(j))
 	err = indexTemplate.Execute(w, data)
@@ -140,22 +149,63 @@ func homePageHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func startHandler(w http.ResponseWriter, r *http.Request) {
+func (a *App) streamStatsHandler(w http.ResponseWriter, r *http.Request) {
+	guilds, ok := a.dashboardGuilds(w, r)
+	if !ok {
+		return
+	}
+
+	streamID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	stream, err := a.Store.GetStream(streamID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if validateGuildSelection(guilds, stream.GuildID) != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	sessions, err := a.Store.StreamSessions(stream.ID)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		fmt.Fprintf(w, "Unable to get sessions")
+		log.Error("getting sessions", err)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Stream": stream,
+		"Stats":  sessionStats(sessions, time.Now()),
+	}
+	err = streamStatsTemplate.Execute(w, data)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("error rendering template", err)
+		return
+	}
+}
+
+func (a *App) startHandler(w http.ResponseWriter, r *http.Request) {
 	b := make([]byte, 16)
 	rand.Read(b)
 
 	state := base64.URLEncoding.EncodeToString(b)
 
-	session, _ := store.Get(r, sessionStoreKey)
+	session, _ := a.Sessions.Get(r, sessionStoreKey)
 	session.Values["state"] = state
 	session.Save(r, w)
 
-	url := oauthCfg.AuthCodeURL(state)
+	url := a.OAuth.AuthCodeURL(state)
 	http.Redirect(w, r, url, 302)
 }
 
-func authCallbackHandler(w http.ResponseWriter, r *http.Request) {
-	session, err := store.Get(r, sessionStoreKey)
+func (a *App) authCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := a.Sessions.Get(r, sessionStoreKey)
 	if err != nil {
 		fmt.Fprintln(w, "aborted")
 		return
@@ -166,7 +216,7 @@ func authCallbackHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := oauthCfg.Exchange(oauth2.NoContext, r.URL.Query().Get("code"))
+	token, err := a.OAuth.Exchange(oauth2.NoContext, r.URL.Query().Get("code"))
 	if err != nil {
 		fmt.Fprintln(w, "there was an issue getting your token")
 		return
@@ -177,13 +227,11 @@ func authCallbackHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	clientDG, err := discordgo.New("Bearer " + token.AccessToken)
+	clientDG, err := a.UserDiscord(token.AccessToken)
 	if err != nil {
 		log.Info("error creating Discord session,", err)
 		return
 	}
-	// Cleanly close down the Discord session.
-	defer clientDG.Close()
 
 	user, err := clientDG.User("@me")
 	if err != nil {
@@ -199,8 +247,8 @@ func authCallbackHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", 302)
 }
 
-func sessionDestroyHandler(w http.ResponseWriter, r *http.Request) {
-	session, err := store.Get(r, sessionStoreKey)
+func (a *App) sessionDestroyHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := a.Sessions.Get(r, sessionStoreKey)
 	if err != nil {
 		fmt.Fprintln(w, "aborted")
 		return
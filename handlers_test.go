@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// loggedInRequest is a GET with the dashboard session cookie for accessToken
+func loggedInRequest(t *testing.T, app *App, target string, accessToken string) *http.Request {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", target, nil)
+	session, _ := app.Sessions.Get(r, sessionStoreKey)
+	session.Values["accessToken"] = accessToken
+	err := session.Save(r, w)
+	if err != nil {
+		t.Fatalf("Save() got an error: %s", err)
+	}
+
+	r = httptest.NewRequest("GET", target, nil)
+	for _, cookie := range w.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+	return r
+}
+
+func TestHomePageHandler(t *testing.T) {
+	app, _ := newTestApp(t, map[string]fakeDiscordUser{
+		"token": fakeDiscordUser{
+			user: &discordgo.User{ID: "viewer", Username: "viewer"},
+			guilds: []*discordgo.UserGuild{
+				&discordgo.UserGuild{ID: "1", Name: "Streamers"},
+				&discordgo.UserGuild{ID: "2", Name: "Without the bot"},
+			},
+		},
+	})
+	app.Guilds.Set(&Guild{ID: "1", Name: "Streamers"})
+	app.Guilds.Set(&Guild{ID: "3", Name: "Someone else's"})
+	live := mustAddStream(t, app.Store, Stream{GuildID: "1", OwnerID: "o1", OwnerName: "zed", Type: streamFake, StreamUsername: "zed"})
+	live.Live = true
+	app.Store.SetLive(&live)
+	mustAddStream(t, app.Store, Stream{GuildID: "1", OwnerID: "o2", OwnerName: "amy", Type: streamFake, StreamUsername: "amy"})
+	mustAddStream(t, app.Store, Stream{GuildID: "3", OwnerID: "o3", OwnerName: "hidden", Type: streamFake, StreamUsername: "hidden"})
+
+	items := [][]interface{}{
+		// target, access token, status, redirect or text in the page, text not in the page
+		[]interface{}{"/", "", 302, "/start", ""},
+		[]interface{}{"/", "expired", 302, "/start", ""},
+		[]interface{}{"/", "token", 200, "<div>zed</div>", "Without the bot"},
+		[]interface{}{"/", "token", 200, "<td>amy</td>", "<div>amy</div>"},
+		[]interface{}{"/?guild=3", "token", 302, "/", ""},
+		[]interface{}{"/?guild=1&tab=leaderboard", "token", 200, "<h1>Leaderboard</h1>", "hidden"},
+	}
+
+	for _, item := range items {
+		r := httptest.NewRequest("GET", item[0].(string), nil)
+		if item[1].(string) != "" {
+			r = loggedInRequest(t, app, item[0].(string), item[1].(string))
+		}
+		w := httptest.NewRecorder()
+		app.homePageHandler(w, r)
+
+		if w.Code != item[2].(int) {
+			t.Errorf("homePageHandler(%s) returned %d; want %d", item[0].(string), w.Code, item[2].(int))
+			continue
+		}
+		if w.Code == 302 {
+			if w.Header().Get("Location") != item[3].(string) {
+				t.Errorf("homePageHandler(%s) redirected to %s; want %s", item[0].(string), w.Header().Get("Location"), item[3].(string))
+			}
+			continue
+		}
+		body := w.Body.String()
+		if !strings.Contains(body, item[3].(string)) {
+			t.Errorf("homePageHandler(%s) is missing %s", item[0].(string), item[3].(string))
+		}
+		if item[4].(string) != "" && strings.Contains(body, item[4].(string)) {
+			t.Errorf("homePageHandler(%s) shows %s", item[0].(string), item[4].(string))
+		}
+	}
+}
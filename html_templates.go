@@ -2,10 +2,11 @@ package main
 
 import (
 	"html/template"
+	"time"
 )
 
 var (
-	indexTemplate = template.Must(template.New("htmlTemplate").Parse(`
+	indexTemplate = template.Must(template.New("htmlTemplate").Funcs(template.FuncMap{"duration": formatDuration}).Parse(`
 {{ $SelectedGuildID := .SelectedGuildID }}
 <!doctype html>
 <html lang="en">
@@ -55,13 +56,29 @@ var (
         </nav>
 
         <main role="main" class="col-md-9 ml-sm-auto col-lg-10 px-4">
+          <ul class="nav nav-tabs my-3">
+            <li class="nav-item">
+              <a class="nav-link {{ if eq .Tab "streams" }}active{{ end }}" href="?guild={{ $SelectedGuildID }}">Streamers</a>
+            </li>
+            <li class="nav-item">
+              <a class="nav-link {{ if eq .Tab "leaderboard" }}active{{ end }}" href="?guild={{ $SelectedGuildID }}&tab=leaderboard">Leaderboard</a>
+            </li>
+          </ul>
+
+          {{ if eq .Tab "leaderboard" }}
+          <h1>Leaderboard</h1>
+          <div class="row">
+            {{ template "leaderboard" .week }}
+            {{ template "leaderboard" .month }}
+          </div>
+          {{ else }}
           <h1>Streamers</h1>
           <div class="container">
             <div class="row">
-              {{range $idx, $stream := .TwitchStreams}}
+              {{range $idx, $stream := .Streams}}
               <div class="col">
-                <div id="stream{{ $idx }}"></div>
-                <div><a href="{{ $stream.URL }}">{{ $stream.Channel }}</a></div>
+                {{ $stream.EmbedHTML }}
+                <div><a href="{{ $stream.URL }}">{{ $stream.Channel }}</a> - {{ $stream.OwnerDisplayName }}</div>
               </div>
               {{ else }}
               <p>
@@ -72,11 +89,31 @@ var (
                 Make sure you've added it by running the following command in discord
                 <br />
                 <kbd>!addTwitch https://www.twitch.tv/yourusername</kbd>
+                <br />
+                or
+                <br />
+                <kbd>!addStream https://www.youtube.com/@yourhandle</kbd>
               </p>
               {{end}}
             </div>
           </div>
 
+          {{ if .AllStreams }}
+          <h2>Everyone</h2>
+          <table class="table table-sm">
+            <tbody>
+              {{range $idx, $stream := .AllStreams}}
+              <tr>
+                <td>{{ $stream.OwnerDisplayName }}</td>
+                <td><a href="{{ $stream.URL }}">{{ $stream.Type }}</a></td>
+                <td><a href="/streams/{{ $stream.ID }}/stats">Stats</a></td>
+              </tr>
+              {{ end }}
+            </tbody>
+          </table>
+          {{ end }}
+          {{ end }}
+
         </main>
       </div>
     </div>
@@ -87,19 +124,114 @@ var (
     <script src="https://cdnjs.cloudflare.com/ajax/libs/popper.js/1.12.9/umd/popper.min.js" integrity="sha384-ApNbgh9B+Y1QKtv3Rn7W3mgPxhU9K/ScQsAP7hUibX39j7fakFPskvXusvfa0b4Q" crossorigin="anonymous"></script>
     <script src="https://maxcdn.bootstrapcdn.com/bootstrap/4.0.0/js/bootstrap.min.js" integrity="sha384-JZR6Spejh4U02d8jOt6vLEHfe/JQGiRRSQQxSfFWpi1MquVdAyjUar5+76PVCmYl" crossorigin="anonymous"></script>
 
-    <!-- Load the Twitch embed script -->
-    <script src="https://embed.twitch.tv/embed/v1.js"></script>
-    <!-- Create a Twitch.Embed object that will render within the "twitch-embed" root element. -->
-    <script type="text/javascript">
-      {{range $idx, $stream := .TwitchStreams}}
-      new Twitch.Embed("stream{{ $idx}}", {
-        width: 427,
-        height: 240,
-        channel: "{{ $stream.Channel }}",
-        layout: "video"
-      });
-      {{end}}
-    </script>
+  </body>
+</html>
+{{ define "leaderboard" }}
+<div class="col-md-6">
+  <h2>{{ .Since.Format "Jan 2" }} to {{ .Until.Format "Jan 2" }}</h2>
+  <h3>Hours live</h3>
+  <ol>
+    {{ range .ByHours }}
+    <li>{{ .Name }} - {{ duration .Live }}</li>
+    {{ else }}
+    <li>Nobody has streamed</li>
+    {{ end }}
+  </ol>
+  <h3>Peak viewers</h3>
+  <ol>
+    {{ range .ByPeak }}
+    <li>{{ .Name }} - {{ .PeakViewers }}</li>
+    {{ end }}
+  </ol>
+</div>
+{{ end }}`))
+
+	streamStatsTemplate = template.Must(template.New("streamStats").Funcs(template.FuncMap{
+		"duration": formatDuration,
+		"sessionLength": func(session StreamSession) string {
+			return formatDuration(session.Duration(time.Now()))
+		},
+	}).Parse(`
+<!doctype html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1, shrink-to-fit=no">
+    <link rel="stylesheet" href="https://maxcdn.bootstrapcdn.com/bootstrap/4.0.0/css/bootstrap.min.css" integrity="sha384-Gn5384xqQ1aoWXA+058RXPxPg6fy4IWvTNh0E263XmFcJlSAwiGgFAW/dAiS6JXm" crossorigin="anonymous">
+    <title>{{ .Stream.OwnerDisplayName }}'s stats</title>
+  </head>
+  <body>
+    <main role="main" class="container">
+      <p><a href="/?guild={{ .Stream.GuildID }}">Back</a></p>
+      <h1>{{ .Stream.OwnerDisplayName }} on <a href="{{ .Stream.URL }}">{{ .Stream.Type }}</a></h1>
+
+      <div class="row">
+        <div class="col"><h2>{{ .Stats.Hours }}</h2>hours streamed</div>
+        <div class="col"><h2>{{ .Stats.Sessions }}</h2>sessions</div>
+        <div class="col"><h2>{{ duration .Stats.Average }}</h2>on average</div>
+      </div>
+
+      <h2>Most streamed</h2>
+      <ol>
+        {{range .Stats.Games}}
+        <li>{{ .Game }} - {{ duration .Duration }}</li>
+        {{ else }}
+        <li>Nothing yet</li>
+        {{ end }}
+      </ol>
+
+      <h2>Recent sessions</h2>
+      <table class="table table-sm">
+        <thead>
+          <tr><th>Started</th><th>Length</th><th>Title</th><th>Game</th><th>Peak viewers</th></tr>
+        </thead>
+        <tbody>
+          {{range .Stats.Recent}}
+          <tr>
+            <td>{{ .StartedAt.Format "2006-01-02 15:04 MST" }}</td>
+            <td>{{ sessionLength . }}{{ if .EndedAt.IsZero }} (live){{ end }}</td>
+            <td>{{ .Title }}</td>
+            <td>{{ .Game }}</td>
+            <td>{{ .PeakViewers }}</td>
+          </tr>
+          {{ else }}
+          <tr><td colspan="5">{{ .Stream.OwnerDisplayName }} hasn't streamed yet</td></tr>
+          {{ end }}
+        </tbody>
+      </table>
+    </main>
+  </body>
+</html>`))
+
+	widgetTemplate = template.Must(template.New("widget").Parse(`
+<!doctype html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>Live on {{ .Guild.Name }}</title>
+    <style>
+      body { margin: 0; font: 14px/1.4 sans-serif; background: transparent; }
+      ul { list-style: none; margin: 0; padding: 0; }
+      li { padding: 6px 8px; border-bottom: 1px solid rgba(128, 128, 128, 0.3); }
+      a { color: inherit; text-decoration: none; }
+      .name { font-weight: bold; }
+      .details { opacity: 0.7; font-size: 12px; overflow: hidden; white-space: nowrap; text-overflow: ellipsis; }
+    </style>
+  </head>
+  <body>
+    <ul>
+      {{range .Streams}}
+      <li>
+        <a href="{{ .URL }}" target="_blank" rel="noopener">
+          <div class="name">{{ .OwnerDisplayName }} <small>on {{ .Type }}</small></div>
+          <div class="details">{{ if .Game }}{{ .Game }} - {{ end }}{{ .ViewerCount }} viewers{{ if .Title }} - {{ .Title }}{{ end }}</div>
+        </a>
+      </li>
+      {{ else }}
+      <li>Nobody is live right now</li>
+      {{ end }}
+    </ul>
   </body>
 </html>`))
 )
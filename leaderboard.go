@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/getsentry/raven-go"
+)
+
+// leaderboardSize is how many streamers a leaderboard shows
+const leaderboardSize = 10
+
+// leaderboardPeriods are the periods the leaderboard command knows, in days
+var leaderboardPeriods = map[string]int{
+	"week":  7,
+	"month": 30,
+}
+
+// leaderboardEntry is one streamer's totals for the period
+type leaderboardEntry struct {
+	OwnerID     string
+	Name        string
+	Live        time.Duration
+	PeakViewers int
+}
+
+// leaderboard ranks a guild's streamers over a period
+type leaderboard struct {
+	Since   time.Time
+	Until   time.Time
+	ByHours []leaderboardEntry
+	ByPeak  []leaderboardEntry
+}
+
+// buildLeaderboard totals up sessions, only counting the part of each session inside the period
+func buildLeaderboard(sessions []StreamSession, names map[string]string, since time.Time, until time.Time) leaderboard {
+	totals := map[string]*leaderboardEntry{}
+	for _, session := range sessions {
+		start := session.StartedAt
+		if start.Before(since) {
+			start = since
+		}
+		end := session.EndedAt
+		if end.IsZero() || end.After(until) {
+			end = until
+		}
+		if !end.After(start) {
+			continue
+		}
+
+		entry, ok := totals[session.OwnerID]
+		if !ok {
+			name, ok := names[session.OwnerID]
+			if !ok {
+				name = "Unknown member"
+			}
+			entry = &leaderboardEntry{OwnerID: session.OwnerID, Name: name}
+			totals[session.OwnerID] = entry
+		}
+		entry.Live += end.Sub(start)
+		if session.PeakViewers > entry.PeakViewers {
+			entry.PeakViewers = session.PeakViewers
+		}
+	}
+
+	entries := []leaderboardEntry{}
+	for _, entry := range totals {
+		entries = append(entries, *entry)
+	}
+	board := leaderboard{Since: since, Until: until}
+	board.ByHours = rankLeaderboard(entries, func(a, b leaderboardEntry) bool { return a.Live > b.Live })
+	board.ByPeak = rankLeaderboard(entries, func(a, b leaderboardEntry) bool { return a.PeakViewers > b.PeakViewers })
+	return board
+}
+
+func rankLeaderboard(entries []leaderboardEntry, better func(a, b leaderboardEntry) bool) []leaderboardEntry {
+	ranked := append([]leaderboardEntry{}, entries...)
+	sort.Slice(ranked, func(i, j int) bool {
+		if better(ranked[i], ranked[j]) {
+			return true
+		}
+		if better(ranked[j], ranked[i]) {
+			return false
+		}
+		return ranked[i].Name < ranked[j].Name
+	})
+	if len(ranked) > leaderboardSize {
+		ranked = ranked[:leaderboardSize]
+	}
+	return ranked
+}
+
+// loadLeaderboard builds the leaderboard for a guild from its sessions
+func (a *App) loadLeaderboard(guildID string, since time.Time, until time.Time) (leaderboard, error) {
+	sessions, err := a.Store.GuildSessions(guildID, since, until)
+	if err != nil {
+		return leaderboard{}, err
+	}
+
+	streams, err := a.Store.GuildStreams(guildID)
+	if err != nil {
+		return leaderboard{}, err
+	}
+	names := map[string]string{}
+	for _, stream := range streams {
+		names[stream.OwnerID] = stream.OwnerDisplayName()
+	}
+	return buildLeaderboard(sessions, names, since, until), nil
+}
+
+// formatLeaderboard is the plain text version of leaderboardEmbed
+func formatLeaderboard(title string, board leaderboard) string {
+	if len(board.ByHours) == 0 {
+		return "Nobody has streamed in the " + strings.ToLower(title)
+	}
+	lines := []string{title + " by hours live:"}
+	for idx, entry := range board.ByHours {
+		lines = append(lines, fmt.Sprintf("%d. %s - %s", idx+1, entry.Name, formatDuration(entry.Live)))
+	}
+	lines = append(lines, "By peak viewers:")
+	for idx, entry := range board.ByPeak {
+		lines = append(lines, fmt.Sprintf("%d. %s - %d", idx+1, entry.Name, entry.PeakViewers))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func leaderboardEmbed(title string, board leaderboard) *discordgo.MessageEmbed {
+	hours := []string{}
+	for idx, entry := range board.ByHours {
+		hours = append(hours, fmt.Sprintf("%d. %s - %s", idx+1, entry.Name, formatDuration(entry.Live)))
+	}
+	peaks := []string{}
+	for idx, entry := range board.ByPeak {
+		peaks = append(peaks, fmt.Sprintf("%d. %s - %d", idx+1, entry.Name, entry.PeakViewers))
+	}
+	return &discordgo.MessageEmbed{
+		Title:       title,
+		Description: fmt.Sprintf("<t:%d:d> to <t:%d:d>", board.Since.Unix(), board.Until.Unix()),
+		Fields: []*discordgo.MessageEmbedField{
+			&discordgo.MessageEmbedField{Name: "Hours live", Value: truncateText(strings.Join(hours, "\n"), discordEmbedFieldValueLimit), Inline: true},
+			&discordgo.MessageEmbedField{Name: "Peak viewers", Value: truncateText(strings.Join(peaks, "\n"), discordEmbedFieldValueLimit), Inline: true},
+		},
+	}
+}
+
+// lastMonday is midnight UTC on the most recent monday, which is when the weekly post goes out
+func lastMonday(now time.Time) time.Time {
+	now = now.UTC()
+	daysSince := (int(now.Weekday()) + 6) % 7
+	return time.Date(now.Year(), now.Month(), now.Day()-daysSince, 0, 0, 0, 0, time.UTC)
+}
+
+// leaderboardPoster posts last week's leaderboard every monday until quit is closed
+func (a *App) leaderboardPoster(interval time.Duration, quit <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		a.postWeeklyLeaderboards(time.Now())
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// postWeeklyLeaderboards posts to every guild that hasn't had this week's post yet,
+// so restarting the bot on a monday won't post twice
+func (a *App) postWeeklyLeaderboards(now time.Time) {
+	until := lastMonday(now)
+	since := until.AddDate(0, 0, -7)
+
+	guilds, err := a.Store.LeaderboardGuildsDue(until)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("Error loading guilds for the weekly leaderboard", err)
+		return
+	}
+
+	for _, guild := range guilds {
+		claimed, err := a.Store.MarkLeaderboardPosted(guild.ID, now, until)
+		if err != nil {
+			raven.CaptureErrorAndWait(err, nil)
+			log.Error("Error saving the weekly leaderboard for "+guild.String(), err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		board, err := a.loadLeaderboard(guild.ID, since, until)
+		if err != nil {
+			raven.CaptureErrorAndWait(err, nil)
+			log.Error("Error loading the weekly leaderboard for "+guild.String(), err)
+			a.unmarkLeaderboardPosted(guild, until)
+			continue
+		}
+		if len(board.ByHours) == 0 {
+			continue
+		}
+
+		send := &discordgo.MessageSend{Content: formatLeaderboard("Last week", board)}
+		if canEmbed(a.Discord, a.Discord.BotUserID(), guild.LeaderboardChannelID) {
+			send = &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{leaderboardEmbed("Last week", board)}}
+		}
+		_, err = a.Discord.ChannelMessageSendComplex(guild.LeaderboardChannelID, send)
+		if err != nil {
+			log.Error("Error posting the weekly leaderboard for "+guild.String(), err)
+			a.unmarkLeaderboardPosted(guild, until)
+		}
+	}
+}
+
+// unmarkLeaderboardPosted lets the next run retry a weekly post that didn't go out
+func (a *App) unmarkLeaderboardPosted(guild Guild, until time.Time) {
+	err := a.Store.UnmarkLeaderboardPosted(guild.ID, until, guild.LeaderboardPostedAt)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("Error giving back the weekly leaderboard claim for "+guild.String(), err)
+	}
+}
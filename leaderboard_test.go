@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildLeaderboard(t *testing.T) {
+	until := time.Date(2019, 5, 13, 0, 0, 0, 0, time.UTC)
+	since := until.AddDate(0, 0, -7)
+	names := map[string]string{"1": "halkeye", "2": "gavin"}
+	sessions := []StreamSession{
+		// only the last hour is inside the week
+		StreamSession{OwnerID: "1", StartedAt: since.Add(-time.Hour), EndedAt: since.Add(time.Hour), PeakViewers: 100},
+		StreamSession{OwnerID: "1", StartedAt: since.Add(24 * time.Hour), EndedAt: since.Add(26 * time.Hour), PeakViewers: 5},
+		// still live, counts up to the end of the period
+		StreamSession{OwnerID: "2", StartedAt: until.Add(-4 * time.Hour), PeakViewers: 20},
+		StreamSession{OwnerID: "3", StartedAt: since.Add(time.Hour), EndedAt: since.Add(90 * time.Minute), PeakViewers: 1},
+		// outside the period entirely
+		StreamSession{OwnerID: "3", StartedAt: since.Add(-3 * time.Hour), EndedAt: since.Add(-2 * time.Hour), PeakViewers: 1000},
+	}
+
+	board := buildLeaderboard(sessions, names, since, until)
+
+	hours := []string{}
+	for _, entry := range board.ByHours {
+		hours = append(hours, entry.Name+" "+formatDuration(entry.Live))
+	}
+	if strings.Join(hours, ", ") != "gavin 4h 0m, halkeye 3h 0m, Unknown member 30m" {
+		t.Errorf("ByHours = %v; want gavin, halkeye then the unknown member", hours)
+	}
+
+	peaks := []string{}
+	for _, entry := range board.ByPeak {
+		peaks = append(peaks, entry.Name)
+	}
+	if strings.Join(peaks, ", ") != "halkeye, gavin, Unknown member" {
+		t.Errorf("ByPeak = %v; want halkeye, gavin then the unknown member", peaks)
+	}
+}
+
+func TestLastMonday(t *testing.T) {
+	items := [][]interface{}{
+		[]interface{}{time.Date(2019, 5, 13, 0, 0, 0, 0, time.UTC), time.Date(2019, 5, 13, 0, 0, 0, 0, time.UTC)},
+		[]interface{}{time.Date(2019, 5, 15, 18, 30, 0, 0, time.UTC), time.Date(2019, 5, 13, 0, 0, 0, 0, time.UTC)},
+		[]interface{}{time.Date(2019, 5, 12, 23, 59, 0, 0, time.UTC), time.Date(2019, 5, 6, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, item := range items {
+		got := lastMonday(item[0].(time.Time))
+		if !got.Equal(item[1].(time.Time)) {
+			t.Errorf("lastMonday(%s) = %s; want %s", item[0].(time.Time), got, item[1].(time.Time))
+		}
+	}
+}
+
+func TestIndexTemplateLeaderboard(t *testing.T) {
+	until := time.Date(2019, 5, 13, 0, 0, 0, 0, time.UTC)
+	board := leaderboard{
+		Since:   until.AddDate(0, 0, -7),
+		Until:   until,
+		ByHours: []leaderboardEntry{leaderboardEntry{Name: "halkeye", Live: 3 * time.Hour, PeakViewers: 42}},
+		ByPeak:  []leaderboardEntry{leaderboardEntry{Name: "halkeye", Live: 3 * time.Hour, PeakViewers: 42}},
+	}
+
+	var out bytes.Buffer
+	err := indexTemplate.Execute(&out, map[string]interface{}{"Tab": "leaderboard", "SelectedGuildID": "guild", "week": board, "month": board})
+	if err != nil {
+		t.Fatalf("indexTemplate got an error: %s", err)
+	}
+	for _, want := range []string{"May 6 to May 13", "halkeye - 3h 0m", "halkeye - 42"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("indexTemplate output is missing %q", want)
+		}
+	}
+}
+
+func TestPostWeeklyLeaderboards(t *testing.T) {
+	app, discord := newTestApp(t, nil)
+	err := app.Store.SaveGuild(&Guild{ID: "1", Name: "Streamers"})
+	if err != nil {
+		t.Fatalf("SaveGuild() got an error: %s", err)
+	}
+	_, err = app.Store.UpdateGuildSetting("1", "leaderboard_channel_id", "leaderboard")
+	if err != nil {
+		t.Fatalf("UpdateGuildSetting() got an error: %s", err)
+	}
+	now := time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC)
+	start := now.AddDate(0, 0, -3)
+	err = app.Store.StartSession(&StreamSession{StreamID: 1, GuildID: "1", OwnerID: "o1", Type: streamFake, StartedAt: start, EndedAt: start.Add(2 * time.Hour)})
+	if err != nil {
+		t.Fatalf("StartSession() got an error: %s", err)
+	}
+
+	discord.sendErr = errors.New("discord is down")
+	app.postWeeklyLeaderboards(now)
+	due, err := app.Store.LeaderboardGuildsDue(lastMonday(now))
+	if err != nil || len(due) != 1 {
+		t.Errorf("LeaderboardGuildsDue() after a failed post = %v, %v; want the guild to be retried", due, err)
+	}
+
+	discord.sendErr = nil
+	app.postWeeklyLeaderboards(now.Add(time.Hour))
+	app.postWeeklyLeaderboards(now.Add(2 * time.Hour))
+	if len(discord.complex) != 1 {
+		t.Errorf("postWeeklyLeaderboards() sent %d posts; want 1", len(discord.complex))
+	}
+}
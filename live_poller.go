@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/getsentry/raven-go"
+)
+
+// liveStatus is what we know about a stream while it is live
+type liveStatus struct {
+	Title        string
+	GameID       string
+	Game         string
+	ViewerCount  int
+	StartedAt    time.Time
+	ThumbnailURL string
+}
+
+// eventSubPollEvery is how many checks go by between asking twitch when eventsub
+// is telling us about streams, the poll then only catches missed notifications
+const eventSubPollEvery = 15
+
+// livePoller checks every stream on an interval until quit is closed
+func (a *App) livePoller(interval time.Duration, quit <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for checks := 0; ; checks++ {
+		a.checkLiveStreams(a.twitchPollDue(checks))
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// twitchPollDue is whether this check asks twitch, which is every check unless eventsub is set up
+func (a *App) twitchPollDue(checks int) bool {
+	return a.TwitchEvents == nil || checks%eventSubPollEvery == 0
+}
+
+func (a *App) checkLiveStreams(pollTwitch bool) {
+	for streamType, provider := range a.Providers {
+		if streamType == StreamTwitch && !pollTwitch {
+			continue
+		}
+		streams, err := a.Store.StreamsByType(streamType)
+		if err != nil {
+			raven.CaptureErrorAndWait(err, nil)
+			log.Error("Error loading streams to poll", err)
+			continue
+		}
+		if len(streams) == 0 {
+			continue
+		}
+
+		live, err := provider.LiveStatus(streams)
+		if err != nil {
+			raven.CaptureErrorAndWait(err, nil)
+			log.Error("Error fetching live streams from "+streamType.String(), err)
+			continue
+		}
+
+		for _, stream := range liveTransitions(streams, live) {
+			a.setStreamLive(&stream, !stream.Live, live[stream.StreamUserID])
+		}
+		for _, stream := range streams {
+			status, isLive := live[stream.StreamUserID]
+			if isLive && stream.Live && liveDetailsChanged(stream, status) {
+				a.saveLiveDetails(&stream, status)
+			}
+		}
+	}
+}
+
+// liveTransitions returns the streams whose stored live state doesn't match what the provider reported
+func liveTransitions(streams []Stream, live map[string]liveStatus) []Stream {
+	changed := []Stream{}
+	for _, stream := range streams {
+		_, isLive := live[stream.StreamUserID]
+		if isLive != stream.Live {
+			changed = append(changed, stream)
+		}
+	}
+	return changed
+}
+
+// liveDetailsChanged is true when a stream that is still live has a new title, game or viewer count
+func liveDetailsChanged(stream Stream, status liveStatus) bool {
+	return stream.Title != status.Title ||
+		stream.Game != status.Game ||
+		stream.ViewerCount != status.ViewerCount ||
+		stream.ThumbnailURL != status.ThumbnailURL ||
+		stream.PeakViewers < status.ViewerCount
+}
+
+// saveLiveDetails keeps what is shown about a live stream up to date
+func (a *App) saveLiveDetails(stream *Stream, status liveStatus) {
+	stream.Title = status.Title
+	stream.Game = status.Game
+	stream.ViewerCount = status.ViewerCount
+	stream.ThumbnailURL = status.ThumbnailURL
+	if status.ViewerCount > stream.PeakViewers {
+		stream.PeakViewers = status.ViewerCount
+	}
+	err := a.Store.SaveLiveDetails(stream)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("Error saving live details for "+stream.String(), err)
+		return
+	}
+	a.updateSession(stream)
+}
+
+// setStreamLive records a live/offline transition and announces it.
+// The update only matches when the stored state differs, so a restart or a
+// second source reporting the same transition won't announce twice.
+func (a *App) setStreamLive(stream *Stream, isLive bool, status liveStatus) {
+	liveSince := status.StartedAt
+	if isLive && liveSince.IsZero() {
+		liveSince = time.Now()
+	}
+
+	// going offline keeps the details of the last session for the ended announcement
+	updated := *stream
+	updated.Live = isLive
+	updated.ViewerCount = status.ViewerCount
+	if isLive {
+		updated.LiveSince = liveSince
+		updated.Title = status.Title
+		updated.Game = status.Game
+		updated.ThumbnailURL = status.ThumbnailURL
+		updated.PeakViewers = status.ViewerCount
+		updated.AnnounceChannelID = ""
+		updated.AnnounceMessageID = ""
+	}
+	changed, err := a.Store.SetLive(&updated)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("Error saving live state for "+stream.String(), err)
+		return
+	}
+	if !changed {
+		return
+	}
+	ended := *stream
+	*stream = updated
+	a.syncLiveRole(stream.GuildID, stream.OwnerID)
+
+	if !isLive {
+		log.Info(stream.OwnerTag(), "went offline", stream.URL())
+		endedAt := time.Now()
+		a.endSession(&ended, endedAt)
+		a.endAnnouncement(ended, endedAt)
+		return
+	}
+	log.Notice(stream.OwnerTag(), "went live", stream.URL())
+	a.startSession(stream)
+	a.announceLive(stream, status)
+}
+
+func (a *App) announceLive(stream *Stream, status liveStatus) {
+	guild, err := a.Store.GetGuild(stream.GuildID)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("Error loading guild for "+stream.String(), err)
+		return
+	}
+	if guild.AnnounceChannelID == "" {
+		return
+	}
+
+	mention := ""
+	// only the mention role may ping, a template or stream title can't reach @everyone
+	allowed := &discordgo.MessageAllowedMentions{}
+	if guild.MentionRoleID != "" {
+		mention = "<@&" + guild.MentionRoleID + "> "
+		allowed.Roles = []string{guild.MentionRoleID}
+	}
+	limit := discordMessageLimit - len(mention)
+	message, err := renderAnnounceTemplate(guild.AnnounceTemplate, newAnnounceData(stream, status), limit)
+	if err != nil {
+		log.Warning("Guild", guild.ID, "has a broken template, using the default", err)
+		message, _ = renderAnnounceTemplate(defaultAnnounceTemplate, newAnnounceData(stream, status), limit)
+	}
+	message = mention + message
+
+	send := &discordgo.MessageSend{Content: message, AllowedMentions: allowed}
+	if canEmbed(a.Discord, a.Discord.BotUserID(), guild.AnnounceChannelID) {
+		send.Embeds = []*discordgo.MessageEmbed{liveStreamEmbed(*stream)}
+	}
+	msg, err := a.Discord.ChannelMessageSendComplex(guild.AnnounceChannelID, send)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("Error announcing "+stream.String(), err)
+		return
+	}
+
+	stream.AnnounceChannelID = msg.ChannelID
+	stream.AnnounceMessageID = msg.ID
+	err = a.Store.SaveAnnouncement(stream)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("Error saving announcement for "+stream.String(), err)
+	}
+}
+
+// endAnnouncement edits or deletes the go-live announcement once the stream is over,
+// stream still has the details from while it was live
+func (a *App) endAnnouncement(stream Stream, endedAt time.Time) {
+	if stream.AnnounceMessageID == "" {
+		return
+	}
+	guild, err := a.Store.GetGuild(stream.GuildID)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("Error loading guild for "+stream.String(), err)
+		return
+	}
+
+	switch guild.AnnounceEndAction {
+	case announceEndKeep:
+		return
+	case announceEndDelete:
+		err = a.Discord.ChannelMessageDelete(stream.AnnounceChannelID, stream.AnnounceMessageID)
+	default:
+		edit := discordgo.NewMessageEdit(stream.AnnounceChannelID, stream.AnnounceMessageID).
+			SetContent(endedStreamText(stream, endedAt)).
+			SetEmbeds([]*discordgo.MessageEmbed{})
+		if canEmbed(a.Discord, a.Discord.BotUserID(), stream.AnnounceChannelID) {
+			edit.SetEmbeds([]*discordgo.MessageEmbed{endedStreamEmbed(stream, endedAt)})
+		}
+		_, err = a.Discord.ChannelMessageEditComplex(edit)
+	}
+	if err != nil {
+		// the message may have been deleted by a moderator, that's fine
+		log.Warning("Unable to update the announcement for", stream.String(), err)
+	}
+}
+
+// endedStreamText is the plain text version of endedStreamEmbed
+func endedStreamText(stream Stream, endedAt time.Time) string {
+	// streams that went live before we tracked when don't know how long they ran
+	if stream.LiveSince.IsZero() {
+		return fmt.Sprintf("%s was live at <%s>, peaking at %d viewers", stream.OwnerDisplayName(), stream.URL(), stream.PeakViewers)
+	}
+	return fmt.Sprintf("%s was live at <%s> for %s, peaking at %d viewers",
+		stream.OwnerDisplayName(), stream.URL(), formatDuration(endedAt.Sub(stream.LiveSince)), stream.PeakViewers)
+}
+
+// formatDuration rounds to the minute, like 2h 13m
+func formatDuration(d time.Duration) string {
+	minutes := int(d.Round(time.Minute).Minutes())
+	if minutes < 60 {
+		return fmt.Sprintf("%dm", minutes)
+	}
+	return fmt.Sprintf("%dh %dm", minutes/60, minutes%60)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFormatDuration(t *testing.T) {
+	items := [][]interface{}{
+		[]interface{}{40 * time.Second, "1m"},
+		[]interface{}{59 * time.Minute, "59m"},
+		[]interface{}{2*time.Hour + 13*time.Minute + 10*time.Second, "2h 13m"},
+		[]interface{}{26 * time.Hour, "26h 0m"},
+	}
+
+	for _, item := range items {
+		got := formatDuration(item[0].(time.Duration))
+		if got != item[1].(string) {
+			t.Errorf("formatDuration(%s) = %s; want %s", item[0].(time.Duration), got, item[1].(string))
+		}
+	}
+}
+
+func TestEndedStream(t *testing.T) {
+	liveSince := time.Date(2019, 5, 5, 2, 0, 0, 0, time.UTC)
+	stream := Stream{OwnerName: "halkeye", Type: StreamTwitch, StreamUsername: "halkeye", LiveSince: liveSince, PeakViewers: 42, Game: "Science & Technology"}
+	endedAt := liveSince.Add(90 * time.Minute)
+
+	want := "halkeye was live at <https://www.twitch.tv/halkeye> for 1h 30m, peaking at 42 viewers"
+	if got := endedStreamText(stream, endedAt); got != want {
+		t.Errorf("endedStreamText() = %q; want %q", got, want)
+	}
+
+	embed := endedStreamEmbed(stream, endedAt)
+	if len(embed.Fields) != 3 || embed.Fields[0].Value != "1h 30m" || embed.Fields[1].Value != "42" || embed.Image != nil {
+		t.Errorf("endedStreamEmbed() = %+v; want the duration, peak viewers and no thumbnail", embed)
+	}
+
+	stream.LiveSince = time.Time{}
+	want = "halkeye was live at <https://www.twitch.tv/halkeye>, peaking at 42 viewers"
+	if got := endedStreamText(stream, endedAt); got != want {
+		t.Errorf("endedStreamText() without a start = %q; want %q", got, want)
+	}
+	embed = endedStreamEmbed(stream, endedAt)
+	if len(embed.Fields) != 2 || embed.Fields[0].Name != "Peak viewers" {
+		t.Errorf("endedStreamEmbed() without a start = %+v; want no duration", embed)
+	}
+}
+
+func TestLiveDetailsChanged(t *testing.T) {
+	stream := Stream{Title: "Building a bot", ViewerCount: 10, PeakViewers: 12}
+
+	items := [][]interface{}{
+		[]interface{}{liveStatus{Title: "Building a bot", ViewerCount: 10}, false},
+		[]interface{}{liveStatus{Title: "Fixing the bot", ViewerCount: 10}, true},
+		[]interface{}{liveStatus{Title: "Building a bot", ViewerCount: 11}, true},
+	}
+
+	for _, item := range items {
+		if got := liveDetailsChanged(stream, item[0].(liveStatus)); got != item[1].(bool) {
+			t.Errorf("liveDetailsChanged(%+v) = %t; want %t", item[0].(liveStatus), got, item[1].(bool))
+		}
+	}
+}
+
+func TestTwitchPollDue(t *testing.T) {
+	items := [][]interface{}{
+		// eventsub set up, checks, due
+		[]interface{}{false, 0, true},
+		[]interface{}{false, 1, true},
+		[]interface{}{true, 0, true},
+		[]interface{}{true, 1, false},
+		[]interface{}{true, eventSubPollEvery - 1, false},
+		[]interface{}{true, eventSubPollEvery, true},
+	}
+
+	for _, item := range items {
+		app := &App{}
+		if item[0].(bool) {
+			app.TwitchEvents = newEventSubClient(nil, "", "")
+		}
+		if got := app.twitchPollDue(item[1].(int)); got != item[2].(bool) {
+			t.Errorf("twitchPollDue(%d) with eventsub %t = %t; want %t", item[1].(int), item[0].(bool), got, item[2].(bool))
+		}
+	}
+}
+
+func TestLiveTransitionStates(t *testing.T) {
+	items := [][]interface{}{
+		// stored live, reported live, is a transition
+		[]interface{}{false, false, false},
+		[]interface{}{false, true, true},
+		[]interface{}{true, true, false},
+		[]interface{}{true, false, true},
+	}
+
+	for _, item := range items {
+		streams := []Stream{Stream{StreamUserID: "1", Live: item[0].(bool)}}
+		live := map[string]liveStatus{}
+		if item[1].(bool) {
+			live["1"] = liveStatus{Title: "Coding"}
+		}
+		got := liveTransitions(streams, live)
+		if (len(got) == 1) != item[2].(bool) {
+			t.Errorf("liveTransitions(live=%v, reported=%v) = %v; want a transition: %v", item[0].(bool), item[1].(bool), got, item[2].(bool))
+		}
+	}
+
+	streams := []Stream{
+		Stream{ID: 1, StreamUserID: "1", Live: false},
+		Stream{ID: 2, StreamUserID: "2", Live: true},
+		Stream{ID: 3, StreamUserID: "3", Live: true},
+		Stream{ID: 4, StreamUserID: "", Live: false},
+	}
+	got := liveTransitions(streams, map[string]liveStatus{"1": liveStatus{}, "3": liveStatus{}})
+	if len(got) != 2 || got[0].ID != 1 || got[1].ID != 2 {
+		t.Errorf("liveTransitions() = %v; want streams 1 and 2", got)
+	}
+}
+
+func TestAnnounceLiveMentions(t *testing.T) {
+	app, discord := newTestApp(t, nil)
+	items := [][]interface{}{
+		// guild, mention role, allowed roles
+		[]interface{}{"quiet", "", []string(nil)},
+		[]interface{}{"pings", "role", []string{"role"}},
+	}
+
+	for _, item := range items {
+		guildID := item[0].(string)
+		if err := app.Store.SaveGuild(&Guild{ID: guildID, Name: "Streamers", OwnerID: "owner"}); err != nil {
+			t.Fatalf("SaveGuild() got an error: %s", err)
+		}
+		for column, value := range map[string]interface{}{"announce_channel_id": "announce", "mention_role_id": item[1].(string), "announce_template": "@everyone {{.OwnerName}} is live"} {
+			if _, err := app.Store.UpdateGuildSetting(guildID, column, value); err != nil {
+				t.Fatalf("UpdateGuildSetting(%s) got an error: %s", column, err)
+			}
+		}
+
+		stream := mustAddStream(t, app.Store, Stream{GuildID: guildID, OwnerID: "member", OwnerName: "streamer", Type: streamFake, StreamUsername: "streamer"})
+		sent := len(discord.complex)
+		app.announceLive(&stream, liveStatus{Title: "Coding"})
+		if len(discord.complex) != sent+1 {
+			t.Fatalf("announceLive() in %s sent %d messages; want 1", guildID, len(discord.complex)-sent)
+		}
+		allowed := discord.complex[sent].AllowedMentions
+		if allowed == nil || len(allowed.Parse) != 0 || !reflect.DeepEqual(allowed.Roles, item[2]) {
+			t.Errorf("announceLive() with mention role %q allowed %v; want only roles %v", item[1].(string), allowed, item[2])
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"github.com/getsentry/raven-go"
+)
+
+// syncLiveRole gives the owner the guild's live role while any of their streams are live
+func (a *App) syncLiveRole(guildID string, ownerID string) {
+	guild, err := a.Store.GetGuild(guildID)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("Error loading guild "+guildID, err)
+		return
+	}
+	if guild.LiveRoleID == "" {
+		return
+	}
+
+	live, err := a.Store.CountLiveStreams(guildID, ownerID)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("Error counting live streams for "+ownerID, err)
+		return
+	}
+
+	if live > 0 {
+		err = a.Discord.GuildMemberRoleAdd(guildID, ownerID, guild.LiveRoleID)
+	} else {
+		err = a.Discord.GuildMemberRoleRemove(guildID, ownerID, guild.LiveRoleID)
+	}
+	if err != nil {
+		log.Error("Error updating live role for "+ownerID+" in "+guildID, err)
+	}
+}
+
+// liveRoleChanges works out who needs the live role added or removed
+func liveRoleChanges(members map[string]*discordgo.Member, liveOwners map[string]bool, roleID string) (add []string, remove []string) {
+	for id, member := range members {
+		hasRole := false
+		for _, role := range member.Roles {
+			if role == roleID {
+				hasRole = true
+				break
+			}
+		}
+		if liveOwners[id] && !hasRole {
+			add = append(add, id)
+		}
+		if !liveOwners[id] && hasRole {
+			remove = append(remove, id)
+		}
+	}
+	return add, remove
+}
+
+// reconcileLiveRole fixes roles that got stuck while the bot was down
+func (a *App) reconcileLiveRole(guildID string, members map[string]*discordgo.Member, streams []Stream) {
+	guild, err := a.Store.GetGuild(guildID)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("Error loading guild "+guildID, err)
+		return
+	}
+	if guild.LiveRoleID == "" {
+		return
+	}
+
+	liveOwners := map[string]bool{}
+	for _, stream := range streams {
+		if stream.Live {
+			liveOwners[stream.OwnerID] = true
+		}
+	}
+
+	add, remove := liveRoleChanges(members, liveOwners, guild.LiveRoleID)
+	for _, id := range add {
+		err = a.Discord.GuildMemberRoleAdd(guildID, id, guild.LiveRoleID)
+		if err != nil {
+			log.Error("Error adding live role to "+id+" in "+guildID, err)
+		}
+	}
+	for _, id := range remove {
+		err = a.Discord.GuildMemberRoleRemove(guildID, id, guild.LiveRoleID)
+		if err != nil {
+			log.Error("Error removing live role from "+id+" in "+guildID, err)
+		}
+	}
+}
+
+// moveLiveRole takes a live role that was replaced or unset away from everyone
+// who has it, then hands the current one to whoever is live
+func (a *App) moveLiveRole(guildID string, previousRoleID string) {
+	// there is no member list from the gateway here, Large makes guildMembers fetch all of it
+	members, err := guildMembers(a.Discord, &discordgo.Guild{ID: guildID, Large: true})
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("Error listing members of "+guildID, err)
+		return
+	}
+
+	if previousRoleID != "" {
+		_, remove := liveRoleChanges(members, map[string]bool{}, previousRoleID)
+		for _, id := range remove {
+			err = a.Discord.GuildMemberRoleRemove(guildID, id, previousRoleID)
+			if err != nil {
+				log.Error("Error removing old live role from "+id+" in "+guildID, err)
+			}
+		}
+	}
+
+	streams, err := a.Store.GuildStreams(guildID)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("Error loading streams for "+guildID, err)
+		return
+	}
+	a.reconcileLiveRole(guildID, members, streams)
+}
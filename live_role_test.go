@@ -0,0 +1,73 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestLiveRoleChanges(t *testing.T) {
+	members := map[string]*discordgo.Member{
+		"live-with-role":    &discordgo.Member{Roles: []string{"other", "live"}},
+		"live-without-role": &discordgo.Member{Roles: []string{"other"}},
+		"offline-with-role": &discordgo.Member{Roles: []string{"live"}},
+		"offline":           &discordgo.Member{},
+	}
+	liveOwners := map[string]bool{"live-with-role": true, "live-without-role": true, "not-a-member": true}
+
+	add, remove := liveRoleChanges(members, liveOwners, "live")
+	sort.Strings(add)
+	sort.Strings(remove)
+	if strings.Join(add, ",") != "live-without-role" {
+		t.Errorf("add = %v; want [live-without-role]", add)
+	}
+	if strings.Join(remove, ",") != "offline-with-role" {
+		t.Errorf("remove = %v; want [offline-with-role]", remove)
+	}
+}
+
+func TestMoveLiveRole(t *testing.T) {
+	app, discord := newTestApp(t, nil)
+	err := app.Store.SaveGuild(&Guild{ID: "1", Name: "Streamers"})
+	if err != nil {
+		t.Fatalf("SaveGuild() got an error: %s", err)
+	}
+	live := mustAddStream(t, app.Store, Stream{GuildID: "1", OwnerID: "live", OwnerName: "live", Type: streamFake, StreamUsername: "live"})
+	live.Live = true
+	app.Store.SetLive(&live)
+	discord.members["1"] = []*discordgo.Member{
+		&discordgo.Member{User: &discordgo.User{ID: "live"}},
+		&discordgo.Member{User: &discordgo.User{ID: "offline"}},
+	}
+
+	ctx := newTestContext(&discord.fakeSession, "1")
+	ctx.App = app
+	items := [][]interface{}{
+		// value, role changes
+		[]interface{}{"<@&111>", "+live 111"},
+		[]interface{}{"<@&222>", "-live 111,+live 222"},
+		[]interface{}{"none", "-live 222"},
+	}
+
+	for _, item := range items {
+		discord.roles = nil
+		err := setGuildSetting(ctx, lookupGuildSetting("liveRole"), item[0].(string))
+		if err != nil {
+			t.Errorf("setting liveRole to %s got an error: %s", item[0].(string), err)
+		}
+		if strings.Join(discord.roles, ",") != item[1].(string) {
+			t.Errorf("setting liveRole to %s changed roles %v; want %s", item[0].(string), discord.roles, item[1].(string))
+		}
+		// the fake doesn't apply role changes, so give the members what discord would have
+		for _, member := range discord.members["1"] {
+			if member.User.ID == "live" {
+				member.Roles = []string{}
+				if role, ok := snowflake(item[0].(string), "<@&"); ok {
+					member.Roles = []string{role}
+				}
+			}
+		}
+	}
+}
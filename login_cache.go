@@ -0,0 +1,52 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// loginCacheTTL is how long a dashboard login's user and guilds are reused
+const loginCacheTTL = 5 * time.Minute
+
+// cachedLogin is what discord said about a dashboard login
+type cachedLogin struct {
+	User    *discordgo.User
+	Guilds  []*discordgo.UserGuild
+	expires time.Time
+}
+
+// loginCache holds cachedLogins by access token, it is safe to use from every request
+type loginCache struct {
+	mu     sync.Mutex
+	logins map[string]cachedLogin
+}
+
+func newLoginCache() *loginCache {
+	return &loginCache{logins: map[string]cachedLogin{}}
+}
+
+// Get returns the login for an access token if it hasn't expired by now
+func (c *loginCache) Get(accessToken string, now time.Time) (cachedLogin, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	login, ok := c.logins[accessToken]
+	if !ok || !now.Before(login.expires) {
+		return cachedLogin{}, false
+	}
+	return login, true
+}
+
+// Set caches a login, dropping any that have expired so logins that are never used again don't pile up
+func (c *loginCache) Set(accessToken string, login cachedLogin, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for token, cached := range c.logins {
+		if !now.Before(cached.expires) {
+			delete(c.logins, token)
+		}
+	}
+	login.expires = now.Add(loginCacheTTL)
+	c.logins[accessToken] = login
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestLoginCache(t *testing.T) {
+	cache := newLoginCache()
+	now := time.Date(2019, 5, 13, 0, 0, 0, 0, time.UTC)
+	cache.Set("old", cachedLogin{User: &discordgo.User{ID: "old"}}, now)
+	cache.Set("token", cachedLogin{User: &discordgo.User{ID: "owner"}}, now.Add(loginCacheTTL-time.Minute))
+
+	items := [][]interface{}{
+		// token, at, found
+		[]interface{}{"token", now.Add(loginCacheTTL), true},
+		[]interface{}{"old", now.Add(loginCacheTTL - time.Second), true},
+		[]interface{}{"old", now.Add(loginCacheTTL), false},
+		[]interface{}{"unknown", now, false},
+	}
+
+	for _, item := range items {
+		_, found := cache.Get(item[0].(string), item[1].(time.Time))
+		if found != item[2].(bool) {
+			t.Errorf("Get(%s, %s) found %t; want %t", item[0].(string), item[1].(time.Time), found, item[2].(bool))
+		}
+	}
+
+	cache.Set("new", cachedLogin{}, now.Add(2*loginCacheTTL))
+	if len(cache.logins) != 1 {
+		t.Errorf("Set() kept %d logins; want the expired ones dropped", len(cache.logins))
+	}
+}
@@ -2,127 +2,229 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/getsentry/raven-go"
-	"github.com/go-pg/pg"
-	"github.com/go-pg/pg/orm"
-	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
 	"github.com/spf13/viper"
 	"golang.org/x/oauth2"
 )
 
 var log = GetLogger()
-var (
-	db        *pg.DB
-	oauthCfg  *oauth2.Config
-	store     *sessions.CookieStore
-	allGuilds map[string]*Guild
-)
 
 const (
 	sessionStoreKey = "sess"
 )
 
-func init() {
-	var err error
-	log.Notice("Version: " + Version + ", GitCommit: " + GitCommit + ", GitState: " + GitState + ", BuildDate: " + BuildDate)
+// setConfigDefaults is everything that works without being configured
+func setConfigDefaults() {
+	viper.SetDefault("poller.interval", time.Minute)
+	viper.SetDefault("discord.text_commands", true)
+	viper.SetDefault("discord.member_events", true)
+	viper.SetDefault("discord.api_url", "https://discord.com/api/v"+discordgo.APIVersion+"/")
+	viper.SetDefault("twitch.api_url", "https://api.twitch.tv/helix")
+	viper.SetDefault("twitch.token_url", "https://id.twitch.tv/oauth2/token")
+	viper.SetDefault("database.driver", "postgres")
+	viper.SetDefault("database.path", "discord-streamers.db")
+	viper.SetDefault("database.auto_migrate", true)
+}
 
-	allGuilds = map[string]*Guild{}
-	viper.AutomaticEnv()                            // Any time viper.Get is called, check env
-	viper.SetEnvPrefix("DISCORD_STREAMERS")         // prefix any env variables with this
-	viper.SetConfigType("yaml")                     // configfile is yaml
-	viper.SetConfigName(".discord-streamers")       // name of config file (without extension)
-	viper.AddConfigPath("/etc/discord-streamers/")  // path to look for the config file in
-	viper.AddConfigPath("$HOME/.discord-streamers") // call multiple times to add many search paths
-	viper.AddConfigPath(".")                        // optionally look for config in the working directory
-	err = viper.ReadInConfig()                      // Find and read the config file
-	if err != nil {                                 // Handle errors reading the config file
-		panic(fmt.Errorf("fatal error config file: %s", err))
+// loadConfig reads the config file and env vars. The config file is optional
+// since every setting can also come from an env var, eg discord.bot.token is
+// DISCORD_STREAMERS_DISCORD_BOT_TOKEN.
+func loadConfig() error {
+	viper.AutomaticEnv()                                   // Any time viper.Get is called, check env
+	viper.SetEnvPrefix("DISCORD_STREAMERS")                // prefix any env variables with this
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_")) // nested keys use _ in env variables
+	viper.SetConfigType("yaml")                            // configfile is yaml
+	viper.SetConfigName(".discord-streamers")              // name of config file (without extension)
+	viper.AddConfigPath("/etc/discord-streamers/")         // path to look for the config file in
+	viper.AddConfigPath("$HOME/.discord-streamers")        // call multiple times to add many search paths
+	viper.AddConfigPath(".")                               // optionally look for config in the working directory
+	setConfigDefaults()
+
+	err := viper.ReadInConfig() // Find and read the config file
+	if _, ok := err.(viper.ConfigFileNotFoundError); ok {
+		log.Warning("No config file found, using env vars only")
+		return nil
 	}
-
-	raven.SetDSN(viper.GetString("sentry.dsn"))
-	// raven.SetEnvironment("staging")
-	// raven.SetRelease("h3ll0w0rld")
+	if err != nil {
+		return fmt.Errorf("fatal error config file: %s", err)
+	}
+	return nil
 }
 
-func main() {
-	var err error
+// startApp opens the store, connects to discord and starts the pollers, all
+// from the config. stop disconnects and waits for the pollers to finish.
+func startApp() (app *App, stop func(), err error) {
+	storage, err := openStore()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if viper.GetBool("database.auto_migrate") {
+		_, err = migrateUp(storage, latestMigration(storage.Migrations()))
+		if err != nil {
+			storage.Close()
+			return nil, nil, err
+		}
+	}
 
-	store = sessions.NewCookieStore([]byte(viper.GetString("cookies.secret")))
-	oauthCfg = &oauth2.Config{
+	setDiscordAPIURL(viper.GetString("discord.api_url"))
+	app = newApp(storage)
+	app.Sessions = sessions.NewCookieStore([]byte(viper.GetString("cookies.secret")))
+	app.OAuth = &oauth2.Config{
 		ClientID:     viper.GetString("discord.client_id"),
 		ClientSecret: viper.GetString("discord.secret_id"),
 		Endpoint: oauth2.Endpoint{
-			AuthURL:  "https://discordapp.com/api/oauth2/authorize",
-			TokenURL: "https://discordapp.com/api/oauth2/token",
+			AuthURL:  discordgo.EndpointOAuth2 + "authorize",
+			TokenURL: discordgo.EndpointOAuth2 + "token",
 		},
 		RedirectURL: viper.GetString("self_url") + "auth-callback",
 		Scopes:      []string{"guilds", "identify"},
 	}
+	if viper.GetString("twitch.client_secret") != "" {
+		helix := newHelixClient(
+			viper.GetString("twitch.client_id"),
+			viper.GetString("twitch.client_secret"),
+			viper.GetString("twitch.api_url"),
+			viper.GetString("twitch.token_url"),
+		)
+		app.Providers[StreamTwitch] = twitchProvider{api: helix, games: helix}
+		app.EventSubSecret = viper.GetString("twitch.eventsub.secret")
+		if app.EventSubSecret != "" {
+			app.TwitchEvents = newEventSubClient(
+				helix,
+				viper.GetString("self_url")+"eventsub/twitch",
+				app.EventSubSecret,
+			)
+		}
+	}
 
-	r := mux.NewRouter()
-	r.HandleFunc("/", raven.RecoveryHandler(homePageHandler))
-	r.HandleFunc("/start", raven.RecoveryHandler(startHandler))
-	r.HandleFunc("/auth-callback", raven.RecoveryHandler(authCallbackHandler))
-	r.HandleFunc("/destroy-session", raven.RecoveryHandler(sessionDestroyHandler))
-	r.Handle("/healthcheck", healthcheckHandler())
-	r.PathPrefix("/").Handler(http.FileServer(http.Dir("./static/")))
+	err = app.Guilds.Load(storage)
+	if err != nil {
+		// discord sends every guild again once connected, so carry on without them
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("Error loading guilds", err)
+	}
 
-	http.Handle("/", r)
+	dg, err := discordgo.New("Bot " + viper.GetString("discord.bot.token"))
+	if err != nil {
+		storage.Close()
+		return nil, nil, err
+	}
+	app.Discord = botSession{dg}
 
-	log.Info("Listening...")
+	// Register the messageCreate func as a callback for MessageCreate events.
+	dg.AddHandler(app.messageCreate)
+	dg.AddHandler(app.guildCreate)
+	dg.AddHandler(app.guildUpdate)
+	dg.AddHandler(app.guildDelete)
+	dg.AddHandler(guildMemberAdd)
+	dg.AddHandler(app.guildMemberRemove)
+	dg.AddHandler(app.guildMemberUpdate)
+	dg.AddHandler(registerSlashCommands)
+	dg.AddHandler(app.interactionCreate)
+
+	dg.Identify.Intents = discordgo.IntentsAllWithoutPrivileged
+	if viper.GetBool("discord.text_commands") {
+		// reading !commands needs the privileged message content intent
+		dg.Identify.Intents |= discordgo.IntentMessageContent
+	}
+	if viper.GetBool("discord.member_events") {
+		// member joins, leaves and the member lists need the privileged server members intent
+		dg.Identify.Intents |= discordgo.IntentsGuildMembers
+	}
+
+	// Open a websocket connection to Discord and begin listening.
+	err = dg.Open()
+	if err != nil {
+		storage.Close()
+		return nil, nil, err
+	}
+
+	quitPoller := make(chan struct{})
+	var pollers sync.WaitGroup
+	pollers.Add(2)
 	go func() {
-		err := http.ListenAndServe(":3000", nil)
-		if err != nil {
-			raven.CaptureErrorAndWait(err, nil)
-			panic(err)
-		}
+		defer pollers.Done()
+		app.livePoller(viper.GetDuration("poller.interval"), quitPoller)
+	}()
+	go func() {
+		defer pollers.Done()
+		app.leaderboardPoster(time.Hour, quitPoller)
 	}()
 
-	db = pg.Connect(&pg.Options{
-		Addr:     viper.GetString("database.addr"),
-		User:     viper.GetString("database.user"),
-		Password: viper.GetString("database.password"),
-		Database: viper.GetString("database.database"),
-	})
-	defer db.Close()
+	stop = func() {
+		close(quitPoller)
+		pollers.Wait()
+		// Cleanly close down the Discord session.
+		dg.Close()
+		storage.Close()
+	}
+	return app, stop, nil
+}
 
-	err = createSchema(db)
+func main() {
+	log.Notice("Version: " + Version + ", GitCommit: " + GitCommit + ", GitState: " + GitState + ", BuildDate: " + BuildDate)
+	err := loadConfig()
 	if err != nil {
-		raven.CaptureErrorAndWait(err, nil)
 		panic(err)
 	}
+	raven.SetDSN(viper.GetString("sentry.dsn"))
+	// raven.SetEnvironment("staging")
+	// raven.SetRelease("h3ll0w0rld")
 
-	dg, err := discordgo.New("Bot " + viper.GetString("discord.bot.token"))
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		storage, err := openStore()
+		if err == nil {
+			err = migrateCommand(storage, os.Args[2:])
+			storage.Close()
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	app, stop, err := startApp()
 	if err != nil {
-		log.Info("error creating Discord session,", err)
+		log.Info("error starting,", err)
 		raven.CaptureErrorAndWait(err, nil)
 		return
 	}
-	// Cleanly close down the Discord session.
-	defer dg.Close()
-	// Register the messageCreate func as a callback for MessageCreate events.
-	dg.AddHandler(messageCreate)
-	dg.AddHandler(guildCreate)
-	dg.AddHandler(guildUpdate)
-	dg.AddHandler(guildDelete)
-	dg.AddHandler(guildMemberAdd)
-	dg.AddHandler(guildMemberRemove)
-	dg.AddHandler(guildMemberUpdate)
+	defer stop()
 
-	// Open a websocket connection to Discord and begin listening.
-	err = dg.Open()
+	http.Handle("/", app.Router())
+
+	listener, err := net.Listen("tcp", ":3000")
 	if err != nil {
-		log.Info("error opening connection,", err)
+		log.Info("error listening,", err)
 		raven.CaptureErrorAndWait(err, nil)
 		return
 	}
+	log.Info("Listening...")
+	go func() {
+		err := http.Serve(listener, nil)
+		if err != nil {
+			raven.CaptureErrorAndWait(err, nil)
+			panic(err)
+		}
+	}()
+
+	if app.TwitchEvents != nil {
+		// twitch calls the callback as soon as a subscription is made, so only sync once it's served
+		go app.syncEventSub()
+	}
 
 	// Wait here until CTRL-C or other term signal is received.
 	log.Notice("Bot is now running.  Press CTRL-C to exit.")
@@ -133,15 +235,3 @@ func main() {
 	log.Notice("All done, quitting")
 
 }
-
-func createSchema(db *pg.DB) error {
-	for _, model := range []interface{}{(*Stream)(nil), (*Guild)(nil)} {
-		err := db.CreateTable(model, &orm.CreateTableOptions{
-			IfNotExists: true,
-		})
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
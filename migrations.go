@@ -0,0 +1,377 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// migration is one versioned change to the schema. Up and Down are run in a
+// transaction, in order. Earlier postgres migrations use IF NOT EXISTS because
+// deployments from before migrations already have some of their changes.
+type migration struct {
+	Version int
+	Name    string
+	Up      []string
+	Down    []string
+}
+
+// SchemaMigration records a migration that has been applied
+type SchemaMigration struct {
+	Version   int `sql:",pk"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (m migration) statements(up bool) []string {
+	if up {
+		return m.Up
+	}
+	return m.Down
+}
+
+// postgresMigrations and sqliteMigrations must only ever be appended to,
+// never edited once released. A model change needs a migration in both.
+var postgresMigrations = []migration{
+	migration{
+		Version: 1,
+		Name:    "initial schema",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS streams (id bigserial, guild_id text, owner_id text, owner_name text, owner_discriminator text, type bigint, stream_username text, stream_user_id text, PRIMARY KEY (id), UNIQUE (guild_id, owner_id))`,
+			`CREATE TABLE IF NOT EXISTS guilds (id text, owner text, owner_id text, PRIMARY KEY (id))`,
+		},
+		Down: []string{
+			`DROP TABLE guilds`,
+			`DROP TABLE streams`,
+		},
+	},
+	migration{
+		Version: 2,
+		Name:    "live status",
+		Up: []string{
+			`ALTER TABLE streams ADD COLUMN IF NOT EXISTS live boolean`,
+			`ALTER TABLE streams ADD COLUMN IF NOT EXISTS live_since timestamptz`,
+		},
+		Down: []string{
+			`ALTER TABLE streams DROP COLUMN live_since`,
+			`ALTER TABLE streams DROP COLUMN live`,
+		},
+	},
+	migration{
+		Version: 3,
+		Name:    "announce channel",
+		Up:      []string{`ALTER TABLE guilds ADD COLUMN IF NOT EXISTS announce_channel_id text`},
+		Down:    []string{`ALTER TABLE guilds DROP COLUMN announce_channel_id`},
+	},
+	migration{
+		Version: 4,
+		Name:    "multiple streams per member",
+		Up: []string{
+			`ALTER TABLE streams DROP CONSTRAINT IF EXISTS streams_guild_id_owner_id_key`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS streams_guild_owner_stream ON streams (guild_id, owner_id, type, stream_user_id)`,
+		},
+		Down: []string{
+			// fails if a member has added more than one stream since
+			`DROP INDEX streams_guild_owner_stream`,
+			`ALTER TABLE streams ADD CONSTRAINT streams_guild_id_owner_id_key UNIQUE (guild_id, owner_id)`,
+		},
+	},
+	migration{
+		Version: 5,
+		Name:    "command prefix",
+		Up:      []string{`ALTER TABLE guilds ADD COLUMN IF NOT EXISTS prefix text`},
+		Down:    []string{`ALTER TABLE guilds DROP COLUMN prefix`},
+	},
+	migration{
+		Version: 6,
+		Name:    "owner display names",
+		Up: []string{
+			`ALTER TABLE streams ADD COLUMN IF NOT EXISTS owner_global_name text`,
+			`ALTER TABLE streams ADD COLUMN IF NOT EXISTS owner_nick text`,
+		},
+		Down: []string{
+			`ALTER TABLE streams DROP COLUMN owner_nick`,
+			`ALTER TABLE streams DROP COLUMN owner_global_name`,
+		},
+	},
+	migration{
+		Version: 7,
+		Name:    "live role",
+		Up:      []string{`ALTER TABLE guilds ADD COLUMN IF NOT EXISTS live_role_id text`},
+		Down:    []string{`ALTER TABLE guilds DROP COLUMN live_role_id`},
+	},
+	migration{
+		Version: 8,
+		Name:    "guild settings",
+		Up: []string{
+			`ALTER TABLE guilds ADD COLUMN IF NOT EXISTS mention_role_id text`,
+			`ALTER TABLE guilds ADD COLUMN IF NOT EXISTS announce_template text`,
+			`ALTER TABLE guilds ADD COLUMN IF NOT EXISTS allowed_stream_types jsonb`,
+			`ALTER TABLE guilds ADD COLUMN IF NOT EXISTS public_dashboard boolean NOT NULL DEFAULT false`,
+		},
+		Down: []string{
+			`ALTER TABLE guilds DROP COLUMN public_dashboard`,
+			`ALTER TABLE guilds DROP COLUMN allowed_stream_types`,
+			`ALTER TABLE guilds DROP COLUMN announce_template`,
+			`ALTER TABLE guilds DROP COLUMN mention_role_id`,
+		},
+	},
+	migration{
+		Version: 9,
+		Name:    "live details",
+		Up: []string{
+			`ALTER TABLE streams ADD COLUMN IF NOT EXISTS owner_avatar text`,
+			`ALTER TABLE streams ADD COLUMN IF NOT EXISTS title text`,
+			`ALTER TABLE streams ADD COLUMN IF NOT EXISTS game text`,
+			`ALTER TABLE streams ADD COLUMN IF NOT EXISTS viewer_count bigint`,
+			`ALTER TABLE streams ADD COLUMN IF NOT EXISTS thumbnail_url text`,
+		},
+		Down: []string{
+			`ALTER TABLE streams DROP COLUMN thumbnail_url`,
+			`ALTER TABLE streams DROP COLUMN viewer_count`,
+			`ALTER TABLE streams DROP COLUMN game`,
+			`ALTER TABLE streams DROP COLUMN title`,
+			`ALTER TABLE streams DROP COLUMN owner_avatar`,
+		},
+	},
+	migration{
+		Version: 10,
+		Name:    "announcement messages",
+		Up: []string{
+			`ALTER TABLE streams ADD COLUMN IF NOT EXISTS peak_viewers bigint`,
+			`ALTER TABLE streams ADD COLUMN IF NOT EXISTS announce_channel_id text`,
+			`ALTER TABLE streams ADD COLUMN IF NOT EXISTS announce_message_id text`,
+			`ALTER TABLE guilds ADD COLUMN IF NOT EXISTS announce_end_action text`,
+		},
+		Down: []string{
+			`ALTER TABLE guilds DROP COLUMN announce_end_action`,
+			`ALTER TABLE streams DROP COLUMN announce_message_id`,
+			`ALTER TABLE streams DROP COLUMN announce_channel_id`,
+			`ALTER TABLE streams DROP COLUMN peak_viewers`,
+		},
+	},
+	migration{
+		Version: 11,
+		Name:    "stream sessions",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS stream_sessions (id bigserial, stream_id bigint, guild_id text, owner_id text, type bigint, started_at timestamptz, ended_at timestamptz, title text, game text, peak_viewers bigint, PRIMARY KEY (id))`,
+			`CREATE INDEX IF NOT EXISTS stream_sessions_stream ON stream_sessions (stream_id, started_at)`,
+			`CREATE INDEX IF NOT EXISTS stream_sessions_guild_owner ON stream_sessions (guild_id, owner_id, started_at)`,
+		},
+		Down: []string{`DROP TABLE stream_sessions`},
+	},
+	migration{
+		Version: 12,
+		Name:    "weekly leaderboard",
+		Up: []string{
+			`ALTER TABLE guilds ADD COLUMN IF NOT EXISTS leaderboard_channel_id text`,
+			`ALTER TABLE guilds ADD COLUMN IF NOT EXISTS leaderboard_posted_at timestamptz`,
+		},
+		Down: []string{
+			`ALTER TABLE guilds DROP COLUMN leaderboard_posted_at`,
+			`ALTER TABLE guilds DROP COLUMN leaderboard_channel_id`,
+		},
+	},
+	migration{
+		Version: 13,
+		Name:    "api tokens",
+		Up: []string{
+			`ALTER TABLE guilds ADD COLUMN IF NOT EXISTS name text`,
+			`CREATE TABLE IF NOT EXISTS api_tokens (id bigserial, guild_id text, owner_id text, owner_name text, name text, token_hash text, created_at timestamptz, PRIMARY KEY (id), UNIQUE (token_hash))`,
+		},
+		Down: []string{
+			`DROP TABLE api_tokens`,
+			`ALTER TABLE guilds DROP COLUMN name`,
+		},
+	},
+	migration{
+		Version: 14,
+		Name:    "api token scopes",
+		Up: []string{
+			`ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS scope text`,
+			`ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS last_used_at timestamptz`,
+		},
+		Down: []string{
+			`ALTER TABLE api_tokens DROP COLUMN last_used_at`,
+			`ALTER TABLE api_tokens DROP COLUMN scope`,
+		},
+	},
+}
+
+// sqliteMigrations start from the schema postgres had when sqlite was added
+var sqliteMigrations = []migration{
+	migration{
+		Version: 1,
+		Name:    "initial schema",
+		Up: []string{
+			`CREATE TABLE streams (id INTEGER PRIMARY KEY AUTOINCREMENT, guild_id text, owner_id text, owner_name text, owner_discriminator text, owner_global_name text, owner_nick text, owner_avatar text, type integer, stream_username text, stream_user_id text, live boolean, live_since datetime, title text, game text, viewer_count integer, thumbnail_url text, peak_viewers integer, announce_channel_id text, announce_message_id text)`,
+			`CREATE UNIQUE INDEX streams_guild_owner_stream ON streams (guild_id, owner_id, type, stream_user_id)`,
+			`CREATE TABLE guilds (id text PRIMARY KEY, name text, owner text, owner_id text, announce_channel_id text, prefix text, live_role_id text, mention_role_id text, announce_template text, allowed_stream_types text, public_dashboard boolean NOT NULL DEFAULT false, announce_end_action text, leaderboard_channel_id text, leaderboard_posted_at datetime)`,
+			`CREATE TABLE stream_sessions (id INTEGER PRIMARY KEY AUTOINCREMENT, stream_id integer, guild_id text, owner_id text, type integer, started_at datetime, ended_at datetime, title text, game text, peak_viewers integer)`,
+			`CREATE INDEX stream_sessions_stream ON stream_sessions (stream_id, started_at)`,
+			`CREATE INDEX stream_sessions_guild_owner ON stream_sessions (guild_id, owner_id, started_at)`,
+			`CREATE TABLE api_tokens (id INTEGER PRIMARY KEY AUTOINCREMENT, guild_id text, owner_id text, owner_name text, name text, token_hash text UNIQUE, scope text, created_at datetime, last_used_at datetime)`,
+		},
+		Down: []string{
+			`DROP TABLE api_tokens`,
+			`DROP TABLE stream_sessions`,
+			`DROP TABLE guilds`,
+			`DROP TABLE streams`,
+		},
+	},
+}
+
+// checkMigrations makes sure versions only go up and every migration can be undone
+func checkMigrations(migrations []migration) error {
+	for idx, m := range migrations {
+		if idx > 0 && m.Version <= migrations[idx-1].Version {
+			return fmt.Errorf("migration %d %s is out of order", m.Version, m.Name)
+		}
+		if len(m.Up) == 0 || len(m.Down) == 0 {
+			return fmt.Errorf("migration %d %s needs up and down statements", m.Version, m.Name)
+		}
+	}
+	return nil
+}
+
+// pendingMigrations returns the migrations that haven't been applied, up to and including target
+func pendingMigrations(migrations []migration, applied map[int]bool, target int) []migration {
+	pending := []migration{}
+	for _, m := range migrations {
+		if !applied[m.Version] && m.Version <= target {
+			pending = append(pending, m)
+		}
+	}
+	return pending
+}
+
+// appliedVersions returns the newest applied versions first
+func appliedVersions(applied map[int]bool) []int {
+	versions := []int{}
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+	return versions
+}
+
+func findMigration(migrations []migration, version int) (migration, bool) {
+	for _, m := range migrations {
+		if m.Version == version {
+			return m, true
+		}
+	}
+	return migration{}, false
+}
+
+func latestMigration(migrations []migration) int {
+	return migrations[len(migrations)-1].Version
+}
+
+// migrateUp applies every pending migration up to and including target
+func migrateUp(store Store, target int) ([]migration, error) {
+	applied, err := store.AppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	done := []migration{}
+	for _, m := range pendingMigrations(store.Migrations(), applied, target) {
+		ran, err := store.RunMigration(m, true)
+		if err != nil {
+			return done, err
+		}
+		if ran {
+			log.Notice("Applied migration", m.Version, m.Name)
+			done = append(done, m)
+		}
+	}
+	return done, nil
+}
+
+// migrateDown undoes the newest steps applied migrations
+func migrateDown(store Store, steps int) ([]migration, error) {
+	applied, err := store.AppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	done := []migration{}
+	for _, version := range appliedVersions(applied) {
+		if len(done) == steps {
+			break
+		}
+		m, ok := findMigration(store.Migrations(), version)
+		if !ok {
+			return done, fmt.Errorf("migration %d was applied by a newer version of the bot", version)
+		}
+		ran, err := store.RunMigration(m, false)
+		if err != nil {
+			return done, err
+		}
+		if ran {
+			log.Notice("Undid migration", m.Version, m.Name)
+			done = append(done, m)
+		}
+	}
+	return done, nil
+}
+
+// formatMigrationStatus lists every migration and whether it has been applied
+func formatMigrationStatus(migrations []migration, applied map[int]bool) string {
+	out := ""
+	for _, m := range migrations {
+		state := "pending"
+		if applied[m.Version] {
+			state = "applied"
+		}
+		out += fmt.Sprintf("%4d %-8s %s\n", m.Version, state, m.Name)
+	}
+	return out
+}
+
+// migrateCommand runs `migrate up [version]`, `migrate down [steps]` or `migrate status`
+func migrateCommand(store Store, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: %s migrate <up [version] | down [steps] | status>", os.Args[0])
+	}
+	number := 0
+	if len(args) == 2 {
+		var err error
+		number, err = strconv.Atoi(args[1])
+		if err != nil || number < 1 {
+			return fmt.Errorf("%s isn't a version or number of steps", args[1])
+		}
+	}
+
+	switch args[0] {
+	case "up":
+		if number == 0 {
+			number = latestMigration(store.Migrations())
+		}
+		done, err := migrateUp(store, number)
+		for _, m := range done {
+			fmt.Printf("applied %d %s\n", m.Version, m.Name)
+		}
+		return err
+	case "down":
+		if number == 0 {
+			number = 1
+		}
+		done, err := migrateDown(store, number)
+		for _, m := range done {
+			fmt.Printf("undid %d %s\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		applied, err := store.AppliedMigrations()
+		if err != nil {
+			return err
+		}
+		fmt.Print(formatMigrationStatus(store.Migrations(), applied))
+		return nil
+	}
+	return fmt.Errorf("unknown migrate command %s", args[0])
+}
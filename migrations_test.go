@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrationsAreValid(t *testing.T) {
+	for name, list := range map[string][]migration{"postgres": postgresMigrations, "sqlite": sqliteMigrations} {
+		err := checkMigrations(list)
+		if err != nil {
+			t.Errorf("checkMigrations(%s) got an error: %s", name, err)
+		}
+	}
+}
+
+func TestCheckMigrations(t *testing.T) {
+	up := []string{"up"}
+	down := []string{"down"}
+	items := [][]interface{}{
+		[]interface{}{[]migration{{1, "a", up, down}, {2, "b", up, down}}, ""},
+		[]interface{}{[]migration{{2, "a", up, down}, {1, "b", up, down}}, "migration 1 b is out of order"},
+		[]interface{}{[]migration{{1, "a", up, down}, {1, "b", up, down}}, "migration 1 b is out of order"},
+		[]interface{}{[]migration{{1, "a", up, nil}}, "migration 1 a needs up and down statements"},
+		[]interface{}{[]migration{{1, "a", nil, down}}, "migration 1 a needs up and down statements"},
+	}
+
+	for idx, item := range items {
+		err := checkMigrations(item[0].([]migration))
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != item[1].(string) {
+			t.Errorf("%d: checkMigrations() = %q; want %q", idx, got, item[1].(string))
+		}
+	}
+}
+
+func TestPendingMigrations(t *testing.T) {
+	all := []migration{{Version: 1}, {Version: 2}, {Version: 3}, {Version: 4}}
+	items := [][]interface{}{
+		[]interface{}{map[int]bool{}, 4, []int{1, 2, 3, 4}},
+		[]interface{}{map[int]bool{1: true, 2: true}, 4, []int{3, 4}},
+		[]interface{}{map[int]bool{1: true, 3: true}, 4, []int{2, 4}},
+		[]interface{}{map[int]bool{}, 2, []int{1, 2}},
+		[]interface{}{map[int]bool{1: true, 2: true, 3: true, 4: true}, 4, []int{}},
+	}
+
+	for idx, item := range items {
+		got := []int{}
+		for _, m := range pendingMigrations(all, item[0].(map[int]bool), item[1].(int)) {
+			got = append(got, m.Version)
+		}
+		if !equalInts(got, item[2].([]int)) {
+			t.Errorf("%d: pendingMigrations() = %v; want %v", idx, got, item[2].([]int))
+		}
+	}
+}
+
+func TestAppliedVersions(t *testing.T) {
+	got := appliedVersions(map[int]bool{3: true, 1: true, 12: true})
+	if !equalInts(got, []int{12, 3, 1}) {
+		t.Errorf("appliedVersions() = %v; want [12 3 1]", got)
+	}
+}
+
+func TestFormatMigrationStatus(t *testing.T) {
+	all := []migration{{Version: 1, Name: "initial schema"}, {Version: 2, Name: "live status"}}
+	got := formatMigrationStatus(all, map[int]bool{1: true})
+	for _, want := range []string{"   1 applied  initial schema\n", "   2 pending  live status\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("formatMigrationStatus() = %q; want it to contain %q", got, want)
+		}
+	}
+}
+
+func equalInts(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
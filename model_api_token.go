@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// APIToken lets scripts use the api for one guild without a browser session.
+// Only a hash of the token is stored.
+type APIToken struct {
+	ID         int64
+	GuildID    string
+	OwnerID    string
+	OwnerName  string
+	Name       string
+	TokenHash  string `sql:",unique"`
+	Scope      string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+// api token scopes, read-write tokens can also add and remove the owner's streams
+const (
+	apiScopeRead      = "read"
+	apiScopeReadWrite = "read-write"
+)
+
+// apiTokenPrefix makes tokens easy to spot if they are pasted somewhere they shouldn't be
+const apiTokenPrefix = "dss_"
+
+// CanWrite checks if the token can change anything
+func (t APIToken) CanWrite() bool {
+	return t.Scope == apiScopeReadWrite
+}
+
+func (t APIToken) String() string {
+	return fmt.Sprintf("APIToken<%d %s %s>", t.ID, t.GuildID, t.Name)
+}
+
+// newAPIToken makes a random token, only its hash should be saved
+func newAPIToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return apiTokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashAPIToken is how tokens are looked up, tokens are random so a plain hash is enough
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// findAPIToken returns the token matching what a request sent
+func (a *App) findAPIToken(token string) (*APIToken, error) {
+	return a.Store.FindAPIToken(hashAPIToken(token))
+}
+
+// apiTokenUsedInterval limits how often last_used_at is written for busy tokens
+const apiTokenUsedInterval = time.Minute
+
+// touchAPIToken records that a token was just used
+func (a *App) touchAPIToken(token *APIToken, now time.Time) {
+	if now.Sub(token.LastUsedAt) < apiTokenUsedInterval {
+		return
+	}
+	token.LastUsedAt = now
+	err := a.Store.TouchAPIToken(token)
+	if err != nil {
+		log.Warning("Unable to record that", token.String(), "was used", err)
+	}
+}
@@ -2,15 +2,56 @@ package main
 
 import (
 	"fmt"
+	"time"
 )
 
 // Guild contains all the guilds that have been signed up
 type Guild struct {
-	ID      string
-	Owner   string
-	OwnerID string
+	ID                   string
+	Name                 string
+	Owner                string
+	OwnerID              string
+	AnnounceChannelID    string
+	Prefix               string
+	LiveRoleID           string
+	MentionRoleID        string
+	AnnounceTemplate     string
+	AllowedStreamTypes   []StreamType
+	PublicDashboard      bool `sql:",notnull"`
+	AnnounceEndAction    string
+	LeaderboardChannelID string
+	LeaderboardPostedAt  time.Time
 }
 
+// what happens to go-live announcements when the stream ends
+const (
+	announceEndEdit   = "edit"
+	announceEndDelete = "delete"
+	announceEndKeep   = "keep"
+)
+
 func (g Guild) String() string {
 	return fmt.Sprintf("Guild<%s %s>", g.ID, g.Owner)
 }
+
+// CommandPrefix is what commands start with in this guild
+func (g Guild) CommandPrefix() string {
+	if g.Prefix == "" {
+		return defaultPrefix
+	}
+	return g.Prefix
+}
+
+// AllowsStreamType checks if members can add streams of this type,
+// guilds that haven't picked any allow every type
+func (g Guild) AllowsStreamType(streamType StreamType) bool {
+	if len(g.AllowedStreamTypes) == 0 {
+		return true
+	}
+	for _, allowed := range g.AllowedStreamTypes {
+		if allowed == streamType {
+			return true
+		}
+	}
+	return false
+}
@@ -2,47 +2,64 @@ package main
 
 import (
 	"fmt"
+	"html/template"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
 )
 
-// StreamType for twitch/etc
+// StreamType for twitch/etc, each one is declared next to its StreamProvider
 type StreamType int
 
-const (
-	// StreamTwitch is enum
-	StreamTwitch StreamType = 0
-)
-
 func (s StreamType) String() string {
-	names := [...]string{
-		"Twitch",
+	if provider, ok := streamProviders[s]; ok {
+		return provider.Name()
 	}
-	return names[s]
+	return fmt.Sprintf("StreamType(%d)", s)
 }
 
-// URL will return the url prefix for this stream type
-func (s StreamType) URL() string {
-	if s == StreamTwitch {
-		return "https://www.twitch.tv/"
+// Provider returns the platform for this stream type
+func (s StreamType) Provider() StreamProvider {
+	if provider, ok := streamProviders[s]; ok {
+		return provider
 	}
 	panic(fmt.Errorf("Not handling: %d", s))
 }
 
-// Stream contains each streamer on each guild
+// URL will return the url prefix for this stream type
+func (s StreamType) URL() string {
+	return s.Provider().URL()
+}
+
+// Stream contains each streamer on each guild, a member can have several
+// as long as they point at different channels
 type Stream struct {
 	// Guild              *Guild `sql:"composite:guilds"`
 	ID                 int64
-	GuildID            string `sql:"unique:guild_user"`
-	OwnerID            string `sql:"unique:guild_user"`
+	GuildID            string
+	OwnerID            string
 	OwnerName          string
 	OwnerDiscriminator string
+	OwnerGlobalName    string
+	OwnerNick          string
+	OwnerAvatar        string
 	Type               StreamType
 	StreamUsername     string
 	StreamUserID       string
+	Live               bool
+	LiveSince          time.Time
+	Title              string
+	Game               string
+	ViewerCount        int
+	ThumbnailURL       string
+	PeakViewers        int
+	AnnounceChannelID  string
+	AnnounceMessageID  string
 }
 
 // String returns a stringified version of the object
 func (s Stream) String() string {
-	return fmt.Sprintf("Stream<%d %s %s %s %s %s>", s.ID, s.GuildID, s.Type, s.StreamUsername, s.OwnerID, s.OwnerName)
+	return fmt.Sprintf("Stream<%d %s %s %s %s %s>", s.ID, s.GuildID, s.Type, s.StreamUsername, s.OwnerID, s.OwnerTag())
 }
 
 // Channel returns the channel part of the url
@@ -54,3 +71,45 @@ func (s Stream) Channel() string {
 func (s Stream) URL() string {
 	return fmt.Sprintf("%s%s", s.Type.URL(), s.StreamUsername)
 }
+
+// EmbedHTML returns the player for the dashboard
+func (s Stream) EmbedHTML() template.HTML {
+	return s.Type.Provider().EmbedHTML(s)
+}
+
+// SetOwner copies the names of the discord member who owns the stream
+func (s *Stream) SetOwner(user *discordgo.User, nick string) {
+	s.OwnerID = user.ID
+	s.OwnerName = user.Username
+	s.OwnerDiscriminator = user.Discriminator
+	s.OwnerGlobalName = user.GlobalName
+	s.OwnerNick = nick
+	s.OwnerAvatar = user.Avatar
+}
+
+// OwnerAvatarURL is the owner's discord avatar, or the default one if they haven't set it
+func (s Stream) OwnerAvatarURL() string {
+	user := discordgo.User{ID: s.OwnerID, Avatar: s.OwnerAvatar, Discriminator: s.OwnerDiscriminator}
+	return user.AvatarURL("128")
+}
+
+// OwnerDisplayName is how the owner shows up in the guild,
+// their nickname, then their display name and finally their username
+func (s Stream) OwnerDisplayName() string {
+	if s.OwnerNick != "" {
+		return s.OwnerNick
+	}
+	if s.OwnerGlobalName != "" {
+		return s.OwnerGlobalName
+	}
+	return s.OwnerName
+}
+
+// OwnerTag is the owner's unique name. Users that moved to unique usernames
+// have a discriminator of 0 and are just their username.
+func (s Stream) OwnerTag() string {
+	if s.OwnerDiscriminator == "" || s.OwnerDiscriminator == "0" {
+		return s.OwnerName
+	}
+	return s.OwnerName + "#" + s.OwnerDiscriminator
+}
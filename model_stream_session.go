@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// StreamSession is one time a stream was live
+type StreamSession struct {
+	ID          int64
+	StreamID    int64
+	GuildID     string
+	OwnerID     string
+	Type        StreamType
+	StartedAt   time.Time
+	EndedAt     time.Time
+	Title       string
+	Game        string
+	PeakViewers int
+}
+
+func (s StreamSession) String() string {
+	return fmt.Sprintf("StreamSession<%d %d %s>", s.ID, s.StreamID, s.StartedAt)
+}
+
+// Duration is how long the session lasted, sessions that are still going count up to now
+func (s StreamSession) Duration(now time.Time) time.Duration {
+	if s.EndedAt.IsZero() {
+		return now.Sub(s.StartedAt)
+	}
+	return s.EndedAt.Sub(s.StartedAt)
+}
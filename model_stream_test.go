@@ -7,6 +7,7 @@ import (
 func TestStreamType(t *testing.T) {
 	items := [][]interface{}{
 		[]interface{}{StreamTwitch, "https://www.twitch.tv/"},
+		[]interface{}{StreamYouTube, "https://www.youtube.com/"},
 	}
 
 	for _, item := range items {
@@ -20,6 +21,8 @@ func TestStreamType(t *testing.T) {
 func TestStream(t *testing.T) {
 	items := [][]interface{}{
 		[]interface{}{Stream{Type: StreamTwitch, StreamUsername: "halkeye"}, "https://www.twitch.tv/halkeye"},
+		[]interface{}{Stream{Type: StreamYouTube, StreamUsername: "@halkeye"}, "https://www.youtube.com/@halkeye"},
+		[]interface{}{Stream{Type: StreamYouTube, StreamUsername: "channel/UCabc"}, "https://www.youtube.com/channel/UCabc"},
 	}
 
 	for _, item := range items {
@@ -29,3 +32,22 @@ func TestStream(t *testing.T) {
 		}
 	}
 }
+
+func TestStreamOwnerNames(t *testing.T) {
+	items := [][]interface{}{
+		// stream, display name, tag
+		[]interface{}{Stream{OwnerName: "halkeye", OwnerDiscriminator: "1337"}, "halkeye", "halkeye#1337"},
+		[]interface{}{Stream{OwnerName: "halkeye", OwnerDiscriminator: "0", OwnerGlobalName: "Halkeye"}, "Halkeye", "halkeye"},
+		[]interface{}{Stream{OwnerName: "halkeye", OwnerGlobalName: "Halkeye", OwnerNick: "Gavin"}, "Gavin", "halkeye"},
+	}
+
+	for _, item := range items {
+		stream := item[0].(Stream)
+		if got := stream.OwnerDisplayName(); got != item[1].(string) {
+			t.Errorf("OwnerDisplayName() = %s; want %s", got, item[1].(string))
+		}
+		if got := stream.OwnerTag(); got != item[2].(string) {
+			t.Errorf("OwnerTag() = %s; want %s", got, item[2].(string))
+		}
+	}
+}
@@ -13,13 +13,13 @@ func streamFromText(input string) (streamType StreamType, streamUsername string,
 	if err != nil {
 		return
 	}
-	if strings.HasSuffix(u.Host, "twitch.tv") {
-		if !strings.HasPrefix(u.Path, "/") {
-			err = errors.New("Url's path doesn't start with a slash")
-			return
+	for _, t := range streamTypes() {
+		provider := streamProviders[t]
+		if !provider.Handles(u) {
+			continue
 		}
-		streamType = StreamTwitch
-		streamUsername = strings.Split(u.Path, "/")[1]
+		streamType = t
+		streamUsername, err = provider.ParseURL(u)
 		return
 	}
 	err = errors.New("Unable to handle url type: " + input)
@@ -9,6 +9,10 @@ func TestRealUrl(t *testing.T) {
 		[]interface{}{"http://www.twitch.tv/kaitlyn", StreamTwitch, "kaitlyn"},
 		[]interface{}{"https://www.twitch.tv/allyqtea", StreamTwitch, "allyqtea"},
 		[]interface{}{"https://twitch.tv/threeternity", StreamTwitch, "threeternity"},
+		[]interface{}{"https://www.youtube.com/@LinusTechTips", StreamYouTube, "@LinusTechTips"},
+		[]interface{}{"https://youtube.com/@LinusTechTips/streams", StreamYouTube, "@LinusTechTips"},
+		[]interface{}{"https://www.youtube.com/channel/UCXuqSBlHAE6Xw-yeJA0Tunw", StreamYouTube, "channel/UCXuqSBlHAE6Xw-yeJA0Tunw"},
+		[]interface{}{"https://m.youtube.com/c/LinusTechTips", StreamYouTube, "c/LinusTechTips"},
 	}
 
 	for _, item := range items {
@@ -24,3 +28,19 @@ func TestRealUrl(t *testing.T) {
 		}
 	}
 }
+
+func TestBadUrl(t *testing.T) {
+	items := []string{
+		"https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+		"https://www.youtube.com/channel/",
+		"https://notyoutube.com/@LinusTechTips",
+		"https://example.com/halkeye",
+	}
+
+	for _, item := range items {
+		_, _, err := streamFromText(item)
+		if err == nil {
+			t.Errorf("streamFromText(\"%s\") should have returned an error", item)
+		}
+	}
+}
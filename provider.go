@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"html/template"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+var errUnknownStreamUser = errors.New("User does not exist")
+
+// StreamProvider is everything the bot needs to know about one streaming platform.
+// Each platform lives in its own provider_*.go file and registers itself in init.
+type StreamProvider interface {
+	// Name is shown to users, eg Twitch
+	Name() string
+	// URL is the prefix a StreamUsername is added to
+	URL() string
+	// Handles is true when the url belongs to this platform
+	Handles(u *url.URL) bool
+	// ParseURL returns the StreamUsername from a url this platform Handles
+	ParseURL(u *url.URL) (string, error)
+	// ResolveUserID turns the StreamUsername into the platform's stable id
+	ResolveUserID(streamUsername string) (string, error)
+	// LiveStatus returns the live streams keyed by StreamUserID
+	LiveStatus(streams []Stream) (map[string]liveStatus, error)
+	// EmbedHTML renders the player for a live stream on the dashboard
+	EmbedHTML(stream Stream) template.HTML
+}
+
+var streamProviders = map[StreamType]StreamProvider{}
+
+// registerStreamProvider makes a platform available to the commands, poller and dashboard
+func registerStreamProvider(streamType StreamType, provider StreamProvider) {
+	if _, ok := streamProviders[streamType]; ok {
+		panic("stream provider registered twice: " + provider.Name())
+	}
+	streamProviders[streamType] = provider
+}
+
+// streamTypes returns the registered stream types in order
+func streamTypes() []StreamType {
+	types := []StreamType{}
+	for streamType := range streamProviders {
+		types = append(types, streamType)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// streamTypeByName finds a stream type from its provider name, ignoring case
+func streamTypeByName(name string) (StreamType, bool) {
+	for streamType, provider := range streamProviders {
+		if strings.EqualFold(provider.Name(), name) {
+			return streamType, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"html/template"
+	"net/url"
+	"testing"
+)
+
+const streamFake StreamType = 99
+
+type fakeProvider struct {
+	live map[string]liveStatus
+}
+
+func (fakeProvider) Name() string                        { return "Fake" }
+func (fakeProvider) URL() string                         { return "https://fake.example.com/" }
+func (fakeProvider) Handles(u *url.URL) bool             { return u.Host == "fake.example.com" }
+func (fakeProvider) ParseURL(u *url.URL) (string, error) { return u.Path[1:], nil }
+func (fakeProvider) ResolveUserID(streamUsername string) (string, error) {
+	return "id-" + streamUsername, nil
+}
+func (p fakeProvider) LiveStatus(streams []Stream) (map[string]liveStatus, error) {
+	return p.live, nil
+}
+func (fakeProvider) EmbedHTML(stream Stream) template.HTML {
+	return template.HTML("<div>" + stream.StreamUsername + "</div>")
+}
+
+// withFakeProvider registers a fake platform for the length of a test
+func withFakeProvider(t *testing.T, provider fakeProvider) {
+	registerStreamProvider(streamFake, provider)
+	t.Cleanup(func() {
+		delete(streamProviders, streamFake)
+	})
+}
+
+func TestStreamProviderRegistry(t *testing.T) {
+	withFakeProvider(t, fakeProvider{})
+
+	gotType, gotUsername, err := streamFromText("https://fake.example.com/halkeye")
+	if err != nil {
+		t.Fatalf("streamFromText() got an error: %s", err)
+	}
+	if gotType != streamFake || gotUsername != "halkeye" {
+		t.Errorf("streamFromText() = %s %s; want Fake halkeye", gotType, gotUsername)
+	}
+
+	stream := Stream{Type: gotType, StreamUsername: gotUsername}
+	if stream.URL() != "https://fake.example.com/halkeye" {
+		t.Errorf("URL() = %s; want https://fake.example.com/halkeye", stream.URL())
+	}
+	if stream.EmbedHTML() != "<div>halkeye</div>" {
+		t.Errorf("EmbedHTML() = %s; want <div>halkeye</div>", stream.EmbedHTML())
+	}
+}
+
+func TestLiveTransitions(t *testing.T) {
+	provider := fakeProvider{live: map[string]liveStatus{"1": liveStatus{Title: "now live"}, "2": liveStatus{}}}
+	streams := []Stream{
+		Stream{ID: 1, Type: streamFake, StreamUserID: "1"},
+		Stream{ID: 2, Type: streamFake, StreamUserID: "2", Live: true},
+		Stream{ID: 3, Type: streamFake, StreamUserID: "3", Live: true},
+		Stream{ID: 4, Type: streamFake, StreamUserID: "4"},
+	}
+
+	live, _ := provider.LiveStatus(streams)
+	changed := liveTransitions(streams, live)
+	if len(changed) != 2 || changed[0].ID != 1 || changed[1].ID != 3 {
+		t.Errorf("liveTransitions() = %v; want streams 1 and 3", changed)
+	}
+}
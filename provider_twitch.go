@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+
+	twitch "github.com/Onestay/go-new-twitch"
+	"github.com/spf13/viper"
+)
+
+// StreamTwitch is enum
+const StreamTwitch StreamType = 0
+
+// twitchStreamsPageSize is the most user ids helix will take in one GetStreams call
+const twitchStreamsPageSize = 100
+
+func init() {
+	registerStreamProvider(StreamTwitch, twitchProvider{})
+}
+
+// twitchAPI is the part of the helix client the provider uses
+type twitchAPI interface {
+	GetUsersByLogin(login ...string) ([]twitch.UserData, error)
+	GetStreams(input twitch.GetStreamsInput) ([]twitch.StreamData, error)
+}
+
+// twitchGames looks up category names, helixClient is the real one
+type twitchGames interface {
+	GameNames(gameIDs []string) (map[string]string, error)
+}
+
+// twitchProvider talks to helix through api, or a client made from the config
+// when it isn't set. Game names need games, they are skipped without it.
+type twitchProvider struct {
+	api   twitchAPI
+	games twitchGames
+}
+
+func (p twitchProvider) client() twitchAPI {
+	if p.api != nil {
+		return p.api
+	}
+	return twitch.NewClient(viper.GetString("twitch.client_id"))
+}
+
+func (twitchProvider) Name() string {
+	return "Twitch"
+}
+
+func (twitchProvider) URL() string {
+	return "https://www.twitch.tv/"
+}
+
+func (twitchProvider) Handles(u *url.URL) bool {
+	return strings.HasSuffix(u.Host, "twitch.tv")
+}
+
+func (twitchProvider) ParseURL(u *url.URL) (string, error) {
+	if !strings.HasPrefix(u.Path, "/") {
+		return "", errors.New("Url's path doesn't start with a slash")
+	}
+	return strings.Split(u.Path, "/")[1], nil
+}
+
+func (p twitchProvider) ResolveUserID(streamUsername string) (string, error) {
+	twitchUsers, err := p.client().GetUsersByLogin(streamUsername)
+	if err != nil {
+		return "", err
+	}
+	if len(twitchUsers) == 0 {
+		return "", errUnknownStreamUser
+	}
+	return twitchUsers[0].ID, nil
+}
+
+func (p twitchProvider) LiveStatus(streams []Stream) (map[string]liveStatus, error) {
+	live := map[string]liveStatus{}
+	twitchClient := p.client()
+
+	for start := 0; start < len(streams); start += twitchStreamsPageSize {
+		end := start + twitchStreamsPageSize
+		if end > len(streams) {
+			end = len(streams)
+		}
+
+		userIDs := []string{}
+		for _, stream := range streams[start:end] {
+			if stream.StreamUserID != "" {
+				userIDs = append(userIDs, stream.StreamUserID)
+			}
+		}
+		if len(userIDs) == 0 {
+			continue
+		}
+
+		twitchStreams, err := twitchClient.GetStreams(twitch.GetStreamsInput{
+			UserID: userIDs,
+			First:  twitchStreamsPageSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, twitchStream := range twitchStreams {
+			live[twitchStream.UserID] = liveStatus{
+				Title:        twitchStream.Title,
+				GameID:       twitchStream.GameID,
+				ViewerCount:  twitchStream.ViewerCount,
+				StartedAt:    twitchStream.StartedAt,
+				ThumbnailURL: strings.NewReplacer("{width}", "640", "{height}", "360").Replace(twitchStream.ThumbnailURL),
+			}
+		}
+	}
+	addTwitchGameNames(p.games, live)
+	return live, nil
+}
+
+// addTwitchGameNames fills in Game, it needs an app token so it is skipped
+// when twitch.client_secret isn't configured
+func addTwitchGameNames(games twitchGames, live map[string]liveStatus) {
+	if games == nil {
+		return
+	}
+	gameIDs := []string{}
+	for _, status := range live {
+		if status.GameID != "" {
+			gameIDs = append(gameIDs, status.GameID)
+		}
+	}
+	if len(gameIDs) == 0 {
+		return
+	}
+	names, err := games.GameNames(gameIDs)
+	if err != nil {
+		log.Warning("Unable to look up twitch game names", err)
+		return
+	}
+	for userID, status := range live {
+		status.Game = names[status.GameID]
+		live[userID] = status
+	}
+}
+
+// EmbedHTML uses the twitch player, which needs to know the domain it is embedded on
+func (twitchProvider) EmbedHTML(stream Stream) template.HTML {
+	parent := "localhost"
+	if selfURL, err := url.Parse(viper.GetString("self_url")); err == nil && selfURL.Hostname() != "" {
+		parent = selfURL.Hostname()
+	}
+	src := "https://player.twitch.tv/?channel=" + url.QueryEscape(stream.StreamUsername) + "&parent=" + url.QueryEscape(parent) + "&muted=true"
+	return template.HTML(fmt.Sprintf(`<iframe width="427" height="240" src="%s" frameborder="0" allowfullscreen></iframe>`, template.HTMLEscapeString(src)))
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// StreamYouTube is enum
+const StreamYouTube StreamType = 1
+
+const (
+	// youtubeVideosPageSize is the most ids videos.list will take at once
+	youtubeVideosPageSize = 50
+	// youtubeFeedVideos is how many of the newest uploads we check per channel
+	youtubeFeedVideos = 5
+)
+
+// youtubeProvider looks up youtube channels with the data api.
+// Live checks read the free uploads feed for each channel and then ask the
+// api about those videos, which costs far less quota than search.
+type youtubeProvider struct {
+	apiURL     string
+	feedURL    string
+	pageURL    string
+	apiKey     func() string
+	httpClient *http.Client
+}
+
+func init() {
+	registerStreamProvider(StreamYouTube, newYouTubeProvider())
+}
+
+func newYouTubeProvider() *youtubeProvider {
+	return &youtubeProvider{
+		apiURL:  "https://www.googleapis.com/youtube/v3",
+		feedURL: "https://www.youtube.com/feeds/videos.xml",
+		pageURL: "https://www.youtube.com",
+		apiKey: func() string {
+			return viper.GetString("youtube.api_key")
+		},
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *youtubeProvider) Name() string {
+	return "YouTube"
+}
+
+func (p *youtubeProvider) URL() string {
+	return "https://www.youtube.com/"
+}
+
+func (p *youtubeProvider) Handles(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	return host == "youtube.com" || strings.HasSuffix(host, ".youtube.com")
+}
+
+// ParseURL accepts youtube.com/@handle, youtube.com/channel/ID and youtube.com/c/name
+func (p *youtubeProvider) ParseURL(u *url.URL) (string, error) {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if strings.HasPrefix(parts[0], "@") && len(parts[0]) > 1 {
+		return parts[0], nil
+	}
+	if len(parts) >= 2 && (parts[0] == "channel" || parts[0] == "c") && parts[1] != "" {
+		return parts[0] + "/" + parts[1], nil
+	}
+	return "", errors.New("Youtube urls need to look like youtube.com/@handle, youtube.com/channel/ID or youtube.com/c/name")
+}
+
+// EmbedHTML plays whatever the channel currently has live
+func (p *youtubeProvider) EmbedHTML(stream Stream) template.HTML {
+	src := "https://www.youtube.com/embed/live_stream?channel=" + url.QueryEscape(stream.StreamUserID)
+	return template.HTML(fmt.Sprintf(`<iframe width="427" height="240" src="%s" frameborder="0" allowfullscreen></iframe>`, template.HTMLEscapeString(src)))
+}
+
+func (p *youtubeProvider) get(rawURL string, out interface{}) error {
+	resp, err := p.httpClient.Get(rawURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Youtube returned %d: %s", resp.StatusCode, string(body))
+	}
+	if strings.Contains(resp.Header.Get("Content-Type"), "xml") {
+		return xml.Unmarshal(body, out)
+	}
+	return json.Unmarshal(body, out)
+}
+
+func (p *youtubeProvider) api(endpoint string, query url.Values, out interface{}) error {
+	query.Set("key", p.apiKey())
+	return p.get(p.apiURL+"/"+endpoint+"?"+query.Encode(), out)
+}
+
+// ResolveUserID turns @handle, channel/ID or c/name into the UC... channel id
+func (p *youtubeProvider) ResolveUserID(streamUsername string) (string, error) {
+	if strings.HasPrefix(streamUsername, "channel/") {
+		return strings.TrimPrefix(streamUsername, "channel/"), nil
+	}
+	if strings.HasPrefix(streamUsername, "c/") {
+		return p.customURLChannelID(strings.TrimPrefix(streamUsername, "c/"))
+	}
+	if !strings.HasPrefix(streamUsername, "@") {
+		return "", errUnknownStreamUser
+	}
+
+	var channels struct {
+		Items []struct {
+			ID string `json:"id"`
+		} `json:"items"`
+	}
+	err := p.api("channels", url.Values{"part": {"id"}, "forHandle": {streamUsername}}, &channels)
+	if err != nil {
+		return "", err
+	}
+	if len(channels.Items) == 0 || channels.Items[0].ID == "" {
+		return "", errUnknownStreamUser
+	}
+	return channels.Items[0].ID, nil
+}
+
+// youtubeCanonicalChannel finds the channel id in the canonical link of a channel page
+var youtubeCanonicalChannel = regexp.MustCompile(`<link rel="canonical" href="[^"]*/channel/(UC[0-9A-Za-z_-]+)"`)
+
+// customURLChannelID reads the channel id off a youtube.com/c/name page. The data api
+// can't look custom urls up, and searching for the name could match another channel.
+func (p *youtubeProvider) customURLChannelID(name string) (string, error) {
+	resp, err := p.httpClient.Get(p.pageURL + "/c/" + url.PathEscape(name))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", errUnknownStreamUser
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Youtube returned %d for /c/%s", resp.StatusCode, name)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	match := youtubeCanonicalChannel.FindSubmatch(body)
+	if match == nil {
+		return "", errUnknownStreamUser
+	}
+	return string(match[1]), nil
+}
+
+// recentVideoIDs returns the newest uploads of a channel from its feed
+func (p *youtubeProvider) recentVideoIDs(channelID string) ([]string, error) {
+	var feed struct {
+		Entries []struct {
+			VideoID string `xml:"videoId"`
+		} `xml:"entry"`
+	}
+
+	err := p.get(p.feedURL+"?channel_id="+url.QueryEscape(channelID), &feed)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for i, entry := range feed.Entries {
+		if i >= youtubeFeedVideos {
+			break
+		}
+		ids = append(ids, entry.VideoID)
+	}
+	return ids, nil
+}
+
+// LiveStatus returns the live channels keyed by channel id
+func (p *youtubeProvider) LiveStatus(streams []Stream) (map[string]liveStatus, error) {
+	live := map[string]liveStatus{}
+
+	// a channel added in several guilds only needs its feed read once
+	channelIDs := map[string]bool{}
+	videoIDs := []string{}
+	for _, stream := range streams {
+		if stream.StreamUserID == "" || channelIDs[stream.StreamUserID] {
+			continue
+		}
+		channelIDs[stream.StreamUserID] = true
+		ids, err := p.recentVideoIDs(stream.StreamUserID)
+		if err != nil {
+			// a deleted channel or a feed that is down shouldn't stop everyone else's checks
+			log.Warning("Unable to read the youtube feed for "+stream.StreamUserID, err)
+			continue
+		}
+		videoIDs = append(videoIDs, ids...)
+	}
+
+	for start := 0; start < len(videoIDs); start += youtubeVideosPageSize {
+		end := start + youtubeVideosPageSize
+		if end > len(videoIDs) {
+			end = len(videoIDs)
+		}
+
+		var videos struct {
+			Items []struct {
+				ID      string `json:"id"`
+				Snippet struct {
+					ChannelID            string `json:"channelId"`
+					Title                string `json:"title"`
+					CategoryID           string `json:"categoryId"`
+					LiveBroadcastContent string `json:"liveBroadcastContent"`
+				} `json:"snippet"`
+				LiveStreamingDetails struct {
+					ActualStartTime   time.Time `json:"actualStartTime"`
+					ConcurrentViewers string    `json:"concurrentViewers"`
+				} `json:"liveStreamingDetails"`
+			} `json:"items"`
+		}
+		err := p.api("videos", url.Values{"part": {"snippet,liveStreamingDetails"}, "id": {strings.Join(videoIDs[start:end], ",")}}, &videos)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, video := range videos.Items {
+			if video.Snippet.LiveBroadcastContent != "live" {
+				continue
+			}
+			viewers := 0
+			fmt.Sscan(video.LiveStreamingDetails.ConcurrentViewers, &viewers)
+			live[video.Snippet.ChannelID] = liveStatus{
+				Title:        video.Snippet.Title,
+				GameID:       video.Snippet.CategoryID,
+				ViewerCount:  viewers,
+				StartedAt:    video.LiveStreamingDetails.ActualStartTime,
+				ThumbnailURL: "https://i.ytimg.com/vi/" + video.ID + "/hqdefault_live.jpg",
+			}
+		}
+	}
+	return live, nil
+}
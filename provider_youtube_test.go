@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func fakeYouTube(t *testing.T) (*youtubeProvider, func()) {
+	fetched := map[string]bool{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/feeds/videos.xml", func(w http.ResponseWriter, r *http.Request) {
+		channelID := r.URL.Query().Get("channel_id")
+		if fetched[channelID] {
+			t.Errorf("the feed for %s was read twice", channelID)
+		}
+		fetched[channelID] = true
+
+		w.Header().Set("Content-Type", "application/atom+xml")
+		switch channelID {
+		case "UCgone":
+			http.NotFound(w, r)
+		case "UClive":
+			w.Write([]byte(`<feed xmlns:yt="http://www.youtube.com/xml/schemas/2015"><entry><yt:videoId>livevideo</yt:videoId></entry><entry><yt:videoId>oldvideo</yt:videoId></entry></feed>`))
+		default:
+			w.Write([]byte(`<feed xmlns:yt="http://www.youtube.com/xml/schemas/2015"><entry><yt:videoId>othervideo</yt:videoId></entry></feed>`))
+		}
+	})
+	mux.HandleFunc("/v3/channels", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "apikey" {
+			t.Errorf("channels called without the api key")
+		}
+		if r.URL.Query().Get("forHandle") == "@halkeye" {
+			w.Write([]byte(`{"items":[{"id":"UChalkeye"}]}`))
+			return
+		}
+		w.Write([]byte(`{"items":[]}`))
+	})
+	mux.HandleFunc("/c/custom", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head><link rel="canonical" href="https://www.youtube.com/channel/UCcustom"></head></html>`))
+	})
+	mux.HandleFunc("/c/nochannel", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head><link rel="canonical" href="https://www.youtube.com/c/nochannel"></head></html>`))
+	})
+	mux.HandleFunc("/v3/videos", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"items":[
+			{"id":"livevideo","snippet":{"channelId":"UClive","title":"Building a bot","liveBroadcastContent":"live"},"liveStreamingDetails":{"actualStartTime":"2019-05-05T02:50:52Z","concurrentViewers":"42"}},
+			{"id":"oldvideo","snippet":{"channelId":"UClive","title":"Old upload","liveBroadcastContent":"none"}},
+			{"id":"othervideo","snippet":{"channelId":"UCoffline","title":"Upcoming","liveBroadcastContent":"upcoming"}}
+		]}`))
+	})
+	server := httptest.NewServer(mux)
+
+	provider := &youtubeProvider{
+		apiURL:     server.URL + "/v3",
+		feedURL:    server.URL + "/feeds/videos.xml",
+		pageURL:    server.URL,
+		apiKey:     func() string { return "apikey" },
+		httpClient: server.Client(),
+	}
+	return provider, server.Close
+}
+
+func TestYouTubeResolveUserID(t *testing.T) {
+	provider, done := fakeYouTube(t)
+	defer done()
+
+	items := [][]interface{}{
+		[]interface{}{"channel/UCXuqSBlHAE6Xw-yeJA0Tunw", "UCXuqSBlHAE6Xw-yeJA0Tunw"},
+		[]interface{}{"@halkeye", "UChalkeye"},
+		[]interface{}{"c/custom", "UCcustom"},
+	}
+
+	for _, item := range items {
+		got, err := provider.ResolveUserID(item[0].(string))
+		if err != nil {
+			t.Errorf("ResolveUserID(\"%s\") got an error: %s", item[0].(string), err)
+		}
+		if got != item[1].(string) {
+			t.Errorf("ResolveUserID(\"%s\") = %s; want %s", item[0].(string), got, item[1].(string))
+		}
+	}
+
+	for _, unknown := range []string{"@nobody", "c/nobody", "c/nochannel"} {
+		_, err := provider.ResolveUserID(unknown)
+		if err != errUnknownStreamUser {
+			t.Errorf("ResolveUserID(\"%s\") = %v; want %v", unknown, err, errUnknownStreamUser)
+		}
+	}
+}
+
+func TestYouTubeLiveStatus(t *testing.T) {
+	provider, done := fakeYouTube(t)
+	defer done()
+
+	streams := []Stream{
+		Stream{ID: 1, Type: StreamYouTube, StreamUserID: "UClive"},
+		Stream{ID: 2, Type: StreamYouTube, StreamUserID: "UCoffline", Live: true},
+		Stream{ID: 3, Type: StreamYouTube, StreamUserID: "UCgone"},
+		Stream{ID: 4, GuildID: "other guild", Type: StreamYouTube, StreamUserID: "UClive"},
+	}
+	live, err := provider.LiveStatus(streams)
+	if err != nil {
+		t.Fatalf("LiveStatus() got an error: %s", err)
+	}
+	if len(live) != 1 {
+		t.Errorf("LiveStatus() = %v; want only UClive", live)
+	}
+	if live["UClive"].Title != "Building a bot" || live["UClive"].ViewerCount != 42 {
+		t.Errorf("LiveStatus()[UClive] = %+v; want the live video", live["UClive"])
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/spf13/viper"
+)
+
+// waitFor polls until done is true, discord events are handled in the background
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("gave up waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// startTestBot runs the bot the way main does, only against the fake discord
+// and helix. It returns the bot and the url its dashboard is served on.
+func startTestBot(t *testing.T, discord *fakeDiscordServer, helix *fakeHelix) (*App, string) {
+	originalAPIURL := discordgo.EndpointAPI
+	t.Cleanup(func() {
+		viper.Reset()
+		setDiscordAPIURL(originalAPIURL)
+	})
+
+	mux := http.NewServeMux()
+	web := httptest.NewServer(mux)
+	t.Cleanup(web.Close)
+
+	setConfigDefaults()
+	viper.Set("self_url", web.URL+"/")
+	viper.Set("cookies.secret", "scenario secret")
+	viper.Set("database.driver", "sqlite")
+	viper.Set("database.path", filepath.Join(t.TempDir(), "streamers.db"))
+	viper.Set("poller.interval", time.Hour)
+	viper.Set("discord.api_url", discord.APIURL())
+	viper.Set("discord.bot.token", "bot-token")
+	viper.Set("discord.client_id", fakeDiscordAppID)
+	viper.Set("discord.secret_id", "discord-secret")
+	viper.Set("twitch.api_url", helix.APIURL())
+	viper.Set("twitch.token_url", helix.TokenURL())
+	viper.Set("twitch.client_id", "twitch-client")
+	viper.Set("twitch.client_secret", "twitch-secret")
+
+	app, stop, err := startApp()
+	if err != nil {
+		t.Fatalf("startApp() got an error: %s", err)
+	}
+	t.Cleanup(stop)
+	mux.Handle("/", app.Router())
+	return app, web.URL
+}
+
+// dashboard logs in through the fake discord and returns the home page
+func dashboard(t *testing.T, client *http.Client, webURL string) string {
+	resp, err := client.Get(webURL + "/start")
+	if err != nil {
+		t.Fatalf("logging in to the dashboard got an error: %s", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || resp.Request.URL.Path != "/" {
+		t.Fatalf("logging in ended on %s with %d: %s", resp.Request.URL, resp.StatusCode, body)
+	}
+	return string(body)
+}
+
+func TestScenarioStreamerLifecycle(t *testing.T) {
+	discord := newFakeDiscordServer(t)
+	helix := newFakeHelix(t)
+	helix.AddUser("halkeye", "1001")
+	helix.AddGame("509670", "Science & Technology")
+	app, webURL := startTestBot(t, discord, helix)
+
+	owner := &discordgo.User{ID: "400", Username: "halkeye"}
+	bot := &discordgo.User{ID: fakeDiscordBotID, Username: "streamers", Bot: true}
+	discord.AddUser("code", "owner-token", fakeDiscordUser{
+		user:   owner,
+		guilds: []*discordgo.UserGuild{&discordgo.UserGuild{ID: "200", Name: "Coding Cave"}},
+	})
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	// the bot is added to a server
+	discord.Dispatch("GUILD_CREATE", &discordgo.Guild{
+		ID:          "200",
+		Name:        "Coding Cave",
+		OwnerID:     owner.ID,
+		MemberCount: 2,
+		Channels:    []*discordgo.Channel{&discordgo.Channel{ID: "300", GuildID: "200", Name: "general", Type: discordgo.ChannelTypeGuildText}},
+		Roles: []*discordgo.Role{&discordgo.Role{
+			ID:          "200",
+			Name:        "@everyone",
+			Permissions: discordgo.PermissionViewChannel | discordgo.PermissionSendMessages | discordgo.PermissionEmbedLinks,
+		}},
+		Members: []*discordgo.Member{
+			&discordgo.Member{GuildID: "200", User: owner, Roles: []string{}},
+			&discordgo.Member{GuildID: "200", User: bot, Roles: []string{}},
+		},
+	})
+	waitFor(t, "the guild to be saved", func() bool {
+		guilds, err := app.Store.AllGuilds()
+		return err == nil && len(guilds) == 1 && guilds[0].Owner == "halkeye"
+	})
+
+	// the owner sets up announcements and adds their stream
+	discord.Dispatch("MESSAGE_CREATE", &discordgo.Message{ID: "501", ChannelID: "300", GuildID: "200", Content: "!announceHere", Author: owner})
+	waitFor(t, "the announce channel to be set", func() bool {
+		guild, err := app.Store.GetGuild("200")
+		return err == nil && guild != nil && guild.AnnounceChannelID == "300"
+	})
+	discord.Dispatch("MESSAGE_CREATE", &discordgo.Message{ID: "502", ChannelID: "300", GuildID: "200", Content: "!addTwitch https://www.twitch.tv/halkeye", Author: owner})
+	waitFor(t, "the stream to be added", func() bool {
+		streams, err := app.Store.GuildStreams("200")
+		return err == nil && len(streams) == 1
+	})
+	streams, _ := app.Store.GuildStreams("200")
+	if streams[0].StreamUserID != "1001" || streams[0].OwnerID != owner.ID {
+		t.Errorf("!addTwitch saved %+v; want halkeye's twitch user owned by %s", streams[0], owner.ID)
+	}
+	waitFor(t, "the bot to reply to !addTwitch", func() bool {
+		for _, message := range discord.Messages("300") {
+			if len(message.Embeds) == 1 && strings.Contains(message.Embeds[0].URL+message.Embeds[0].Description, "twitch.tv/halkeye") {
+				return true
+			}
+		}
+		return false
+	})
+
+	// nobody is live yet
+	body := dashboard(t, client, webURL)
+	for _, want := range []string{"Coding Cave", "<td>halkeye</td>", "None of the streamers for this server are active."} {
+		if !strings.Contains(body, want) {
+			t.Errorf("dashboard before going live is missing %s", want)
+		}
+	}
+
+	// they go live and the poller notices
+	sent := len(discord.Messages("300"))
+	helix.SetLive("1001", liveStatus{Title: "Coding", GameID: "509670", ViewerCount: 3, StartedAt: time.Now().Add(-time.Minute)})
+	app.checkLiveStreams(true)
+	messages := discord.Messages("300")
+	if len(messages) != sent+1 || len(messages[sent].Embeds) != 1 || messages[sent].Embeds[0].Title != "Coding" {
+		t.Errorf("going live sent %v; want an announcement titled Coding", messages[sent:])
+	}
+	body = dashboard(t, client, webURL)
+	if !strings.Contains(body, "https://player.twitch.tv/?channel=halkeye") {
+		t.Errorf("dashboard is missing the live player for halkeye")
+	}
+
+	// the bot is kicked from the server
+	discord.Dispatch("GUILD_DELETE", &discordgo.Guild{ID: "200"})
+	waitFor(t, "the guild to be removed", func() bool {
+		return !app.Guilds.Has("200")
+	})
+	guilds, err := app.Store.AllGuilds()
+	if err != nil || len(guilds) != 0 {
+		t.Errorf("AllGuilds() after leaving = %v, %v; want none", guilds, err)
+	}
+	body = dashboard(t, client, webURL)
+	if strings.Contains(body, "Coding Cave") || strings.Contains(body, "player.twitch.tv") {
+		t.Errorf("dashboard still shows the server the bot left")
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/getsentry/raven-go"
+)
+
+// streamSlashCommand is /stream, each subcommand runs the text command it is mapped to
+var streamSlashCommand = &discordgo.ApplicationCommand{
+	Name:        "stream",
+	Description: "Manage the streams shown for this server",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "add",
+			Description: "Add your stream",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "url",
+					Description: "Link to your channel, eg https://www.twitch.tv/yourusername",
+					Required:    true,
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "remove",
+			Description: "Remove one of your streams",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "stream",
+					Description: "The number from /stream list or the url",
+					Required:    true,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionUser,
+					Name:        "member",
+					Description: "Remove someone else's stream, needs Manage Server",
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "list",
+			Description: "List the streams you have added",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionUser,
+					Name:        "member",
+					Description: "List someone else's streams, needs Manage Server",
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "live",
+			Description: "List who is streaming right now",
+		},
+	},
+}
+
+// streamSubcommands maps /stream subcommands to the text commands they share code with
+var streamSubcommands = map[string]string{
+	"add":    "addStream",
+	"remove": "removeStream",
+	"list":   "myStreams",
+	"live":   "live",
+}
+
+// streamSubcommandName is the /stream subcommand for a text command, or the name itself if there isn't one
+func streamSubcommandName(name string) string {
+	for subcommand, text := range streamSubcommands {
+		if text == name {
+			return subcommand
+		}
+	}
+	return name
+}
+
+// registerSlashCommands replaces the bot's application commands once the gateway is ready
+func registerSlashCommands(s *discordgo.Session, r *discordgo.Ready) {
+	appID := r.User.ID
+	if r.Application != nil && r.Application.ID != "" {
+		appID = r.Application.ID
+	}
+
+	_, err := s.ApplicationCommandBulkOverwrite(appID, "", []*discordgo.ApplicationCommand{streamSlashCommand})
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("Error registering slash commands", err)
+	}
+}
+
+// slashCommandArgs turns the options of a subcommand into command arguments
+func slashCommandArgs(options []*discordgo.ApplicationCommandInteractionDataOption) []string {
+	args := []string{}
+	for _, option := range options {
+		if option.Type == discordgo.ApplicationCommandOptionUser {
+			// written as a mention so commands see the same thing as a text message
+			args = append(args, "<@"+option.Value.(string)+">")
+			continue
+		}
+		args = append(args, option.StringValue())
+	}
+	return args
+}
+
+func (a *App) interactionCreate(_ *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+	data := i.ApplicationCommandData()
+	if data.Name != streamSlashCommand.Name || len(data.Options) == 0 {
+		return
+	}
+
+	cmd := commands.Lookup(streamSubcommands[data.Options[0].Name])
+	if cmd == nil {
+		return
+	}
+
+	author := i.User
+	if i.Member != nil {
+		author = i.Member.User
+	}
+
+	// looking up streams can take longer than the 3 seconds discord gives us to respond
+	err := a.Discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+	})
+	if err != nil {
+		log.Error("Error responding to interaction", err)
+		return
+	}
+
+	mentions := []*discordgo.User{}
+	if data.Resolved != nil {
+		for _, user := range data.Resolved.Users {
+			mentions = append(mentions, user)
+		}
+	}
+
+	replies := []string{}
+	embeds := []*discordgo.MessageEmbed{}
+	ctx := &commandContext{
+		App:       a,
+		Session:   a.Discord,
+		GuildID:   i.GuildID,
+		ChannelID: i.ChannelID,
+		Author:    author,
+		Member:    i.Member,
+		Mentions:  mentions,
+		Prefix:    "/" + streamSlashCommand.Name + " ",
+		Args:      slashCommandArgs(data.Options[0].Options),
+		// usage hints need to name the subcommands, not the text commands
+		CommandName: streamSubcommandName,
+		Responder: func(message string, embed *discordgo.MessageEmbed) {
+			if embed != nil {
+				embeds = append(embeds, embed)
+				return
+			}
+			replies = append(replies, message)
+		},
+	}
+	runCommand(ctx, cmd)
+
+	content := strings.Join(replies, "\n")
+	if content == "" && len(embeds) == 0 {
+		content = "Done"
+	}
+	_, err = a.Discord.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content, Embeds: &embeds, AllowedMentions: noMentions})
+	if err != nil {
+		log.Error("Error editing interaction response", err)
+	}
+}
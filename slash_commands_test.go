@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestStreamSubcommands(t *testing.T) {
+	for _, option := range streamSlashCommand.Options {
+		name, ok := streamSubcommands[option.Name]
+		if !ok {
+			t.Errorf("/stream %s isn't mapped to a command", option.Name)
+			continue
+		}
+		cmd := commands.Lookup(name)
+		if cmd == nil {
+			t.Errorf("/stream %s is mapped to %s which doesn't exist", option.Name, name)
+			continue
+		}
+		required := 0
+		for _, arg := range option.Options {
+			if arg.Required {
+				required++
+			}
+		}
+		if required < cmd.MinArgs {
+			t.Errorf("/stream %s requires %d options; %s needs %d", option.Name, required, name, cmd.MinArgs)
+		}
+	}
+}
+
+func TestSlashCommandArgs(t *testing.T) {
+	options := []*discordgo.ApplicationCommandInteractionDataOption{
+		&discordgo.ApplicationCommandInteractionDataOption{Name: "url", Type: discordgo.ApplicationCommandOptionString, Value: "https://www.twitch.tv/halkeye"},
+	}
+	args := slashCommandArgs(options)
+	if len(args) != 1 || args[0] != "https://www.twitch.tv/halkeye" {
+		t.Errorf("slashCommandArgs() = %q; want [https://www.twitch.tv/halkeye]", args)
+	}
+}
+
+func TestSlashCommandUsage(t *testing.T) {
+	ctx := &commandContext{Prefix: "/stream ", CommandName: streamSubcommandName}
+	items := [][]interface{}{
+		[]interface{}{ctx.Usage(commands.Lookup("removeStream")), "/stream remove <number or url> [@member]"},
+		[]interface{}{ctx.Usage(commands.Lookup("myStreams")), "/stream list [@member]"},
+		[]interface{}{formatStreamList(nil, "Your", ctx.Usage(commands.Lookup("addStream"))), "No streams have been added yet, use /stream add <url>"},
+	}
+
+	for _, item := range items {
+		if item[0].(string) != item[1].(string) {
+			t.Errorf("got %q; want %q", item[0], item[1])
+		}
+	}
+}
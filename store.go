@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// errNotFound is returned by a Store when the row asked for doesn't exist
+var errNotFound = errors.New("not found")
+
+// Store is everything the bot saves. Postgres is used by default, small
+// deployments can use an embedded sqlite file instead.
+type Store interface {
+	// AddStream saves a stream, or updates its owner's names if it was already added.
+	// The stream is filled in with what was saved.
+	AddStream(stream *Stream) error
+	GetStream(id int64) (*Stream, error)
+	// GuildStreams returns a guild's streams in the order they were added
+	GuildStreams(guildID string) ([]Stream, error)
+	// LiveStreams returns a guild's live streams, longest live first
+	LiveStreams(guildID string) ([]Stream, error)
+	// OwnerStreams returns a member's streams in a guild in the order they were added
+	OwnerStreams(guildID string, ownerID string) ([]Stream, error)
+	StreamsByType(streamType StreamType) ([]Stream, error)
+	StreamsByUser(streamType StreamType, streamUserID string) ([]Stream, error)
+	// StreamUserIDs returns each platform user id of a type once
+	StreamUserIDs(streamType StreamType) ([]string, error)
+	CountLiveStreams(guildID string, ownerID string) (int, error)
+	DeleteStream(id int64) error
+	// UpdateOwnerNames copies owner's names onto all of owner.OwnerID's streams in the guild
+	UpdateOwnerNames(guildID string, owner *Stream) error
+	// SaveLiveDetails saves the title, game, viewers and thumbnail of a live stream
+	SaveLiveDetails(stream *Stream) error
+	// SetLive saves a live/offline transition, going live also saves the details and
+	// clears the old announcement. It returns false when the stored state already matched.
+	SetLive(stream *Stream) (bool, error)
+	SaveAnnouncement(stream *Stream) error
+
+	// SaveGuild saves a guild's name and owner, keeping its settings.
+	// The guild is filled in with what was saved.
+	SaveGuild(guild *Guild) error
+	GetGuild(id string) (*Guild, error)
+	// AllGuilds returns every guild sorted by id
+	AllGuilds() ([]Guild, error)
+	// DeleteGuild removes the guild along with its api tokens
+	DeleteGuild(id string) error
+	// UpdateGuildSetting saves one column of a guild's settings and returns the updated guild
+	UpdateGuildSetting(guildID string, column string, value interface{}) (*Guild, error)
+	// LeaderboardGuildsDue returns the guilds with a leaderboard channel that haven't had a post since until
+	LeaderboardGuildsDue(until time.Time) ([]Guild, error)
+	// MarkLeaderboardPosted claims a guild's weekly post, only one caller gets true
+	MarkLeaderboardPosted(guildID string, now time.Time, until time.Time) (bool, error)
+	// UnmarkLeaderboardPosted gives back the claim on the post for the week ending until
+	// when it failed, putting back when the guild last had a post
+	UnmarkLeaderboardPosted(guildID string, until time.Time, postedAt time.Time) error
+
+	StartSession(session *StreamSession) error
+	// UpdateSession copies the stream's title, game and peak onto its open session
+	UpdateSession(stream *Stream) error
+	EndSession(stream *Stream, endedAt time.Time) error
+	// StreamSessions returns a stream's sessions, newest first
+	StreamSessions(streamID int64) ([]StreamSession, error)
+	// OwnerSessions returns a member's sessions in a guild, newest first
+	OwnerSessions(guildID string, ownerID string) ([]StreamSession, error)
+	// GuildSessions returns the sessions in a guild that overlap since to until
+	GuildSessions(guildID string, since time.Time, until time.Time) ([]StreamSession, error)
+
+	AddAPIToken(token *APIToken) error
+	FindAPIToken(tokenHash string) (*APIToken, error)
+	GuildAPITokens(guildID string) ([]APIToken, error)
+	// DeleteAPIToken returns false if the guild has no token with that id
+	DeleteAPIToken(guildID string, id int64) (bool, error)
+	// DeleteOwnerAPITokens removes every token a member made in a guild
+	DeleteOwnerAPITokens(guildID string, ownerID string) error
+	TouchAPIToken(token *APIToken) error
+
+	// Migrations is the schema history for this kind of store
+	Migrations() []migration
+	AppliedMigrations() (map[int]bool, error)
+	// RunMigration applies or undoes one migration, it returns false if another
+	// copy of the bot already did
+	RunMigration(m migration, up bool) (bool, error)
+
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// openStore opens the store picked by database.driver
+func openStore() (Store, error) {
+	switch viper.GetString("database.driver") {
+	case "postgres":
+		return newPostgresStore(
+			viper.GetString("database.addr"),
+			viper.GetString("database.user"),
+			viper.GetString("database.password"),
+			viper.GetString("database.database"),
+		), nil
+	case "sqlite":
+		return newSQLiteStore(viper.GetString("database.path"))
+	}
+	return nil, fmt.Errorf("unknown database.driver %s, use postgres or sqlite", viper.GetString("database.driver"))
+}
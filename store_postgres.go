@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+)
+
+// postgresStore keeps everything in postgres with go-pg
+type postgresStore struct {
+	db *pg.DB
+}
+
+func newPostgresStore(addr string, user string, password string, database string) *postgresStore {
+	return &postgresStore{db: pg.Connect(&pg.Options{
+		Addr:     addr,
+		User:     user,
+		Password: password,
+		Database: database,
+	})}
+}
+
+// notFound turns go-pg's missing row error into errNotFound
+func notFound(err error) error {
+	if err == pg.ErrNoRows {
+		return errNotFound
+	}
+	return err
+}
+
+func (s *postgresStore) AddStream(stream *Stream) error {
+	_, err := s.db.Model(stream).OnConflict("(guild_id, owner_id, type, stream_user_id) DO UPDATE").Set("owner_name=EXCLUDED.owner_name, owner_discriminator=EXCLUDED.owner_discriminator, owner_global_name=EXCLUDED.owner_global_name, owner_nick=EXCLUDED.owner_nick, owner_avatar=EXCLUDED.owner_avatar, stream_username=EXCLUDED.stream_username").Returning("*").Insert()
+	return err
+}
+
+func (s *postgresStore) GetStream(id int64) (*Stream, error) {
+	stream := &Stream{ID: id}
+	err := s.db.Select(stream)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return stream, nil
+}
+
+func (s *postgresStore) GuildStreams(guildID string) ([]Stream, error) {
+	var streams []Stream
+	err := s.db.Model(&streams).Where("guild_id = ?", guildID).Order("id ASC").Select()
+	return streams, err
+}
+
+func (s *postgresStore) LiveStreams(guildID string) ([]Stream, error) {
+	var streams []Stream
+	err := s.db.Model(&streams).Where("guild_id = ?", guildID).Where("live").Order("live_since ASC").Select()
+	return streams, err
+}
+
+func (s *postgresStore) OwnerStreams(guildID string, ownerID string) ([]Stream, error) {
+	var streams []Stream
+	err := s.db.Model(&streams).Where("guild_id = ?", guildID).Where("owner_id = ?", ownerID).Order("id ASC").Select()
+	return streams, err
+}
+
+func (s *postgresStore) StreamsByType(streamType StreamType) ([]Stream, error) {
+	var streams []Stream
+	err := s.db.Model(&streams).Where("type = ?", streamType).Order("id ASC").Select()
+	return streams, err
+}
+
+func (s *postgresStore) StreamsByUser(streamType StreamType, streamUserID string) ([]Stream, error) {
+	var streams []Stream
+	err := s.db.Model(&streams).Where("type = ?", streamType).Where("stream_user_id = ?", streamUserID).Order("id ASC").Select()
+	return streams, err
+}
+
+func (s *postgresStore) StreamUserIDs(streamType StreamType) ([]string, error) {
+	var userIDs []string
+	err := s.db.Model(&Stream{}).ColumnExpr("DISTINCT stream_user_id").Where("type = ?", streamType).Where("stream_user_id <> ''").Select(&userIDs)
+	return userIDs, err
+}
+
+func (s *postgresStore) CountLiveStreams(guildID string, ownerID string) (int, error) {
+	return s.db.Model(&Stream{}).Where("guild_id = ?", guildID).Where("owner_id = ?", ownerID).Where("live").Count()
+}
+
+func (s *postgresStore) DeleteStream(id int64) error {
+	_, err := s.db.Model(&Stream{}).Where("id = ?", id).Delete()
+	return err
+}
+
+func (s *postgresStore) UpdateOwnerNames(guildID string, owner *Stream) error {
+	_, err := s.db.Model(owner).
+		Column("owner_name", "owner_discriminator", "owner_global_name", "owner_nick", "owner_avatar").
+		Where("guild_id = ?", guildID).
+		Where("owner_id = ?", owner.OwnerID).
+		Update()
+	return err
+}
+
+func (s *postgresStore) SaveLiveDetails(stream *Stream) error {
+	_, err := s.db.Model(stream).Column("title", "game", "viewer_count", "thumbnail_url", "peak_viewers").WherePK().Update()
+	return err
+}
+
+func (s *postgresStore) SetLive(stream *Stream) (bool, error) {
+	query := s.db.Model(stream).Set("live = ?", stream.Live).Set("viewer_count = ?", stream.ViewerCount)
+	if stream.Live {
+		query = query.
+			Set("live_since = ?", stream.LiveSince).
+			Set("title = ?", stream.Title).
+			Set("game = ?", stream.Game).
+			Set("thumbnail_url = ?", stream.ThumbnailURL).
+			Set("peak_viewers = ?", stream.PeakViewers).
+			Set("announce_channel_id = NULL").
+			Set("announce_message_id = NULL")
+	}
+	res, err := query.
+		Where("id = ?", stream.ID).
+		Where("live IS DISTINCT FROM ?", stream.Live).
+		Update()
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+func (s *postgresStore) SaveAnnouncement(stream *Stream) error {
+	_, err := s.db.Model(stream).Column("announce_channel_id", "announce_message_id").WherePK().Update()
+	return err
+}
+
+func (s *postgresStore) SaveGuild(guild *Guild) error {
+	_, err := s.db.Model(guild).OnConflict("(id) DO UPDATE").Set("name=EXCLUDED.name, owner=EXCLUDED.owner, owner_id=EXCLUDED.owner_id").Returning("*").Insert()
+	return err
+}
+
+func (s *postgresStore) GetGuild(id string) (*Guild, error) {
+	guild := &Guild{ID: id}
+	err := s.db.Select(guild)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return guild, nil
+}
+
+func (s *postgresStore) AllGuilds() ([]Guild, error) {
+	var guilds []Guild
+	err := s.db.Model(&guilds).Order("id ASC").Select()
+	return guilds, err
+}
+
+func (s *postgresStore) DeleteGuild(id string) error {
+	_, err := s.db.Model(&APIToken{}).Where("guild_id = ?", id).Delete()
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Model(&Guild{}).Where("id = ?", id).Delete()
+	return err
+}
+
+func (s *postgresStore) UpdateGuildSetting(guildID string, column string, value interface{}) (*Guild, error) {
+	guild := &Guild{ID: guildID}
+	res, err := s.db.Model(guild).Set(column+" = ?", value).Where("id = ?", guildID).Returning("*").Update()
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if res.RowsAffected() == 0 {
+		return nil, errNotFound
+	}
+	return guild, nil
+}
+
+func (s *postgresStore) LeaderboardGuildsDue(until time.Time) ([]Guild, error) {
+	var guilds []Guild
+	err := s.db.Model(&guilds).
+		Where("leaderboard_channel_id IS NOT NULL AND leaderboard_channel_id != ''").
+		Where("leaderboard_posted_at IS NULL OR leaderboard_posted_at < ?", until).
+		Order("id ASC").
+		Select()
+	return guilds, err
+}
+
+func (s *postgresStore) MarkLeaderboardPosted(guildID string, now time.Time, until time.Time) (bool, error) {
+	res, err := s.db.Model(&Guild{}).
+		Set("leaderboard_posted_at = ?", now).
+		Where("id = ?", guildID).
+		Where("leaderboard_posted_at IS NULL OR leaderboard_posted_at < ?", until).
+		Update()
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+func (s *postgresStore) UnmarkLeaderboardPosted(guildID string, until time.Time, postedAt time.Time) error {
+	_, err := s.db.Model(&Guild{}).
+		Set("leaderboard_posted_at = ?", pg.NullTime{Time: postedAt}).
+		Where("id = ?", guildID).
+		Where("leaderboard_posted_at >= ?", until).
+		Update()
+	return err
+}
+
+func (s *postgresStore) StartSession(session *StreamSession) error {
+	return s.db.Insert(session)
+}
+
+func (s *postgresStore) UpdateSession(stream *Stream) error {
+	_, err := s.db.Model(&StreamSession{}).
+		Set("title = ?", stream.Title).
+		Set("game = ?", stream.Game).
+		Set("peak_viewers = ?", stream.PeakViewers).
+		Where("stream_id = ?", stream.ID).
+		Where("ended_at IS NULL").
+		Update()
+	return err
+}
+
+func (s *postgresStore) EndSession(stream *Stream, endedAt time.Time) error {
+	_, err := s.db.Model(&StreamSession{}).
+		Set("ended_at = ?", endedAt).
+		Set("peak_viewers = ?", stream.PeakViewers).
+		Where("stream_id = ?", stream.ID).
+		Where("ended_at IS NULL").
+		Update()
+	return err
+}
+
+func (s *postgresStore) StreamSessions(streamID int64) ([]StreamSession, error) {
+	var sessions []StreamSession
+	err := s.db.Model(&sessions).Where("stream_id = ?", streamID).Order("started_at DESC").Select()
+	return sessions, err
+}
+
+func (s *postgresStore) OwnerSessions(guildID string, ownerID string) ([]StreamSession, error) {
+	var sessions []StreamSession
+	err := s.db.Model(&sessions).Where("guild_id = ?", guildID).Where("owner_id = ?", ownerID).Order("started_at DESC").Select()
+	return sessions, err
+}
+
+func (s *postgresStore) GuildSessions(guildID string, since time.Time, until time.Time) ([]StreamSession, error) {
+	var sessions []StreamSession
+	err := s.db.Model(&sessions).
+		Where("guild_id = ?", guildID).
+		Where("started_at < ?", until).
+		Where("ended_at IS NULL OR ended_at > ?", since).
+		Order("started_at ASC").
+		Select()
+	return sessions, err
+}
+
+func (s *postgresStore) AddAPIToken(token *APIToken) error {
+	return s.db.Insert(token)
+}
+
+func (s *postgresStore) FindAPIToken(tokenHash string) (*APIToken, error) {
+	token := &APIToken{}
+	err := s.db.Model(token).Where("token_hash = ?", tokenHash).Select()
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return token, nil
+}
+
+func (s *postgresStore) GuildAPITokens(guildID string) ([]APIToken, error) {
+	var tokens []APIToken
+	err := s.db.Model(&tokens).Where("guild_id = ?", guildID).Order("id ASC").Select()
+	return tokens, err
+}
+
+func (s *postgresStore) DeleteAPIToken(guildID string, id int64) (bool, error) {
+	res, err := s.db.Model(&APIToken{}).Where("id = ?", id).Where("guild_id = ?", guildID).Delete()
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+func (s *postgresStore) DeleteOwnerAPITokens(guildID string, ownerID string) error {
+	_, err := s.db.Model(&APIToken{}).Where("guild_id = ?", guildID).Where("owner_id = ?", ownerID).Delete()
+	return err
+}
+
+func (s *postgresStore) TouchAPIToken(token *APIToken) error {
+	_, err := s.db.Model(token).Column("last_used_at").WherePK().Update()
+	return err
+}
+
+func (s *postgresStore) Migrations() []migration {
+	return postgresMigrations
+}
+
+func (s *postgresStore) AppliedMigrations() (map[int]bool, error) {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version bigint, name text, applied_at timestamptz, PRIMARY KEY (version))`)
+	if err != nil {
+		return nil, err
+	}
+	return loadAppliedMigrations(s.db)
+}
+
+func loadAppliedMigrations(db orm.DB) (map[int]bool, error) {
+	var rows []SchemaMigration
+	err := db.Model(&rows).Select()
+	if err != nil {
+		return nil, err
+	}
+	applied := map[int]bool{}
+	for _, row := range rows {
+		applied[row.Version] = true
+	}
+	return applied, nil
+}
+
+// migrationsLockID keeps two copies of the bot from migrating at the same time
+const migrationsLockID = 7316029384
+
+// RunMigration takes a lock and checks again, so another copy of the bot that
+// is migrating at the same time can't apply it twice
+func (s *postgresStore) RunMigration(m migration, up bool) (bool, error) {
+	ran := false
+	err := s.db.RunInTransaction(func(tx *pg.Tx) error {
+		_, err := tx.Exec(`SELECT pg_advisory_xact_lock(?)`, migrationsLockID)
+		if err != nil {
+			return err
+		}
+		applied, err := loadAppliedMigrations(tx)
+		if err != nil {
+			return err
+		}
+		if applied[m.Version] == up {
+			return nil
+		}
+
+		for _, statement := range m.statements(up) {
+			_, err = tx.Exec(statement)
+			if err != nil {
+				return fmt.Errorf("migration %d %s: %s", m.Version, m.Name, err)
+			}
+		}
+
+		if up {
+			err = tx.Insert(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()})
+		} else {
+			_, err = tx.Model(&SchemaMigration{}).Where("version = ?", m.Version).Delete()
+		}
+		ran = err == nil
+		return err
+	})
+	return ran, err
+}
+
+func (s *postgresStore) Ping(ctx context.Context) error {
+	_, err := s.db.ExecOneContext(ctx, "SELECT 'healthcheck check'")
+	return err
+}
+
+func (s *postgresStore) Close() error {
+	return s.db.Close()
+}
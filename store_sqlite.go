@@ -0,0 +1,562 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	// registers the pure go "sqlite" driver, so builds don't need cgo
+	_ "modernc.org/sqlite"
+)
+
+// sqliteStore keeps everything in a single sqlite file, for deployments without a postgres server.
+// Like go-pg, empty strings and zero times are saved as NULL.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// sqliteTimeFormat is fixed width UTC, so times compare correctly as text
+const sqliteTimeFormat = "2006-01-02 15:04:05.000000000-07:00"
+
+func newSQLiteStore(path string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	// sqlite only allows one writer, sharing a connection avoids "database is locked"
+	db.SetMaxOpenConns(1)
+	return &sqliteStore{db: db}, nil
+}
+
+var (
+	streamColumns  = []string{"id", "guild_id", "owner_id", "owner_name", "owner_discriminator", "owner_global_name", "owner_nick", "owner_avatar", "type", "stream_username", "stream_user_id", "live", "live_since", "title", "game", "viewer_count", "thumbnail_url", "peak_viewers", "announce_channel_id", "announce_message_id"}
+	guildColumns   = []string{"id", "name", "owner", "owner_id", "announce_channel_id", "prefix", "live_role_id", "mention_role_id", "announce_template", "allowed_stream_types", "public_dashboard", "announce_end_action", "leaderboard_channel_id", "leaderboard_posted_at"}
+	sessionColumns = []string{"id", "stream_id", "guild_id", "owner_id", "type", "started_at", "ended_at", "title", "game", "peak_viewers"}
+	tokenColumns   = []string{"id", "guild_id", "owner_id", "owner_name", "name", "token_hash", "scope", "created_at", "last_used_at"}
+)
+
+func streamFields(s *Stream) []interface{} {
+	return []interface{}{&s.ID, &s.GuildID, &s.OwnerID, &s.OwnerName, &s.OwnerDiscriminator, &s.OwnerGlobalName, &s.OwnerNick, &s.OwnerAvatar, &s.Type, &s.StreamUsername, &s.StreamUserID, &s.Live, &s.LiveSince, &s.Title, &s.Game, &s.ViewerCount, &s.ThumbnailURL, &s.PeakViewers, &s.AnnounceChannelID, &s.AnnounceMessageID}
+}
+
+func guildFields(g *Guild) []interface{} {
+	return []interface{}{&g.ID, &g.Name, &g.Owner, &g.OwnerID, &g.AnnounceChannelID, &g.Prefix, &g.LiveRoleID, &g.MentionRoleID, &g.AnnounceTemplate, &g.AllowedStreamTypes, &g.PublicDashboard, &g.AnnounceEndAction, &g.LeaderboardChannelID, &g.LeaderboardPostedAt}
+}
+
+func sessionFields(s *StreamSession) []interface{} {
+	return []interface{}{&s.ID, &s.StreamID, &s.GuildID, &s.OwnerID, &s.Type, &s.StartedAt, &s.EndedAt, &s.Title, &s.Game, &s.PeakViewers}
+}
+
+func tokenFields(t *APIToken) []interface{} {
+	return []interface{}{&t.ID, &t.GuildID, &t.OwnerID, &t.OwnerName, &t.Name, &t.TokenHash, &t.Scope, &t.CreatedAt, &t.LastUsedAt}
+}
+
+// sqliteNullable scans NULL as the zero value
+type sqliteNullable struct {
+	dest interface{}
+}
+
+func (n sqliteNullable) Scan(src interface{}) error {
+	switch dest := n.dest.(type) {
+	case *string:
+		var v sql.NullString
+		err := v.Scan(src)
+		*dest = v.String
+		return err
+	case *int:
+		var v sql.NullInt64
+		err := v.Scan(src)
+		*dest = int(v.Int64)
+		return err
+	case *int64:
+		var v sql.NullInt64
+		err := v.Scan(src)
+		*dest = v.Int64
+		return err
+	case *StreamType:
+		var v sql.NullInt64
+		err := v.Scan(src)
+		*dest = StreamType(v.Int64)
+		return err
+	case *bool:
+		var v sql.NullBool
+		err := v.Scan(src)
+		*dest = v.Bool
+		return err
+	case *time.Time:
+		// the driver parses datetime columns itself, but not every value has one
+		switch v := src.(type) {
+		case nil:
+			*dest = time.Time{}
+		case time.Time:
+			*dest = v
+		case string:
+			t, err := time.Parse(sqliteTimeFormat, v)
+			*dest = t
+			return err
+		default:
+			return fmt.Errorf("can't scan %T into a time", src)
+		}
+		return nil
+	case *[]StreamType:
+		var v sql.NullString
+		err := v.Scan(src)
+		if err != nil || !v.Valid {
+			*dest = nil
+			return err
+		}
+		return json.Unmarshal([]byte(v.String), dest)
+	}
+	return fmt.Errorf("can't scan into %T", n.dest)
+}
+
+// sqliteScanFields wraps every field so NULL columns can be scanned
+func sqliteScanFields(fields []interface{}) []interface{} {
+	wrapped := make([]interface{}, len(fields))
+	for idx, field := range fields {
+		wrapped[idx] = sqliteNullable{field}
+	}
+	return wrapped
+}
+
+// sqliteValue converts a value to how it is saved
+func sqliteValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return nil, nil
+		}
+	case time.Time:
+		if v.IsZero() {
+			return nil, nil
+		}
+		return v.UTC().Format(sqliteTimeFormat), nil
+	case StreamType:
+		return int64(v), nil
+	case []StreamType:
+		if v == nil {
+			return nil, nil
+		}
+		b, err := json.Marshal(v)
+		return string(b), err
+	}
+	return value, nil
+}
+
+// sqliteArgs converts each query argument with sqliteValue
+func sqliteArgs(values ...interface{}) ([]interface{}, error) {
+	out := make([]interface{}, len(values))
+	for idx, value := range values {
+		var err error
+		out[idx], err = sqliteValue(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// sqliteFieldValues dereferences the pointers from streamFields and friends, skipping the id
+func sqliteFieldValues(fields []interface{}) []interface{} {
+	values := []interface{}{}
+	for _, field := range fields[1:] {
+		switch f := field.(type) {
+		case *string:
+			values = append(values, *f)
+		case *int:
+			values = append(values, *f)
+		case *int64:
+			values = append(values, *f)
+		case *StreamType:
+			values = append(values, *f)
+		case *bool:
+			values = append(values, *f)
+		case *time.Time:
+			values = append(values, *f)
+		case *[]StreamType:
+			values = append(values, *f)
+		}
+	}
+	return values
+}
+
+func sqlitePlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func (s *sqliteStore) exec(query string, values ...interface{}) (sql.Result, error) {
+	converted, err := sqliteArgs(values...)
+	if err != nil {
+		return nil, err
+	}
+	return s.db.Exec(query, converted...)
+}
+
+// query runs a select and calls scan for each row
+func (s *sqliteStore) query(scan func(rows *sql.Rows) error, query string, values ...interface{}) error {
+	converted, err := sqliteArgs(values...)
+	if err != nil {
+		return err
+	}
+	rows, err := s.db.Query(query, converted...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		err = scan(rows)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *sqliteStore) selectStreams(where string, values ...interface{}) ([]Stream, error) {
+	streams := []Stream{}
+	err := s.query(func(rows *sql.Rows) error {
+		stream := Stream{}
+		err := rows.Scan(sqliteScanFields(streamFields(&stream))...)
+		streams = append(streams, stream)
+		return err
+	}, "SELECT "+strings.Join(streamColumns, ", ")+" FROM streams WHERE "+where, values...)
+	return streams, err
+}
+
+func (s *sqliteStore) selectGuilds(where string, values ...interface{}) ([]Guild, error) {
+	guilds := []Guild{}
+	err := s.query(func(rows *sql.Rows) error {
+		guild := Guild{}
+		err := rows.Scan(sqliteScanFields(guildFields(&guild))...)
+		guilds = append(guilds, guild)
+		return err
+	}, "SELECT "+strings.Join(guildColumns, ", ")+" FROM guilds WHERE "+where, values...)
+	return guilds, err
+}
+
+func (s *sqliteStore) selectSessions(where string, values ...interface{}) ([]StreamSession, error) {
+	sessions := []StreamSession{}
+	err := s.query(func(rows *sql.Rows) error {
+		session := StreamSession{}
+		err := rows.Scan(sqliteScanFields(sessionFields(&session))...)
+		sessions = append(sessions, session)
+		return err
+	}, "SELECT "+strings.Join(sessionColumns, ", ")+" FROM stream_sessions WHERE "+where, values...)
+	return sessions, err
+}
+
+func (s *sqliteStore) selectTokens(where string, values ...interface{}) ([]APIToken, error) {
+	tokens := []APIToken{}
+	err := s.query(func(rows *sql.Rows) error {
+		token := APIToken{}
+		err := rows.Scan(sqliteScanFields(tokenFields(&token))...)
+		tokens = append(tokens, token)
+		return err
+	}, "SELECT "+strings.Join(tokenColumns, ", ")+" FROM api_tokens WHERE "+where, values...)
+	return tokens, err
+}
+
+// insert saves every column but the id and returns the new row
+func (s *sqliteStore) insert(table string, columns []string, fields []interface{}, onConflict string) error {
+	values, err := sqliteArgs(sqliteFieldValues(fields)...)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) %s RETURNING %s",
+		table, strings.Join(columns[1:], ", "), sqlitePlaceholders(len(columns)-1), onConflict, strings.Join(columns, ", "))
+	return s.db.QueryRow(query, values...).Scan(sqliteScanFields(fields)...)
+}
+
+func (s *sqliteStore) AddStream(stream *Stream) error {
+	return s.insert("streams", streamColumns, streamFields(stream), "ON CONFLICT (guild_id, owner_id, type, stream_user_id) DO UPDATE SET owner_name=excluded.owner_name, owner_discriminator=excluded.owner_discriminator, owner_global_name=excluded.owner_global_name, owner_nick=excluded.owner_nick, owner_avatar=excluded.owner_avatar, stream_username=excluded.stream_username")
+}
+
+func (s *sqliteStore) GetStream(id int64) (*Stream, error) {
+	streams, err := s.selectStreams("id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(streams) == 0 {
+		return nil, errNotFound
+	}
+	return &streams[0], nil
+}
+
+func (s *sqliteStore) GuildStreams(guildID string) ([]Stream, error) {
+	return s.selectStreams("guild_id = ? ORDER BY id ASC", guildID)
+}
+
+func (s *sqliteStore) LiveStreams(guildID string) ([]Stream, error) {
+	return s.selectStreams("guild_id = ? AND live ORDER BY live_since ASC", guildID)
+}
+
+func (s *sqliteStore) OwnerStreams(guildID string, ownerID string) ([]Stream, error) {
+	return s.selectStreams("guild_id = ? AND owner_id = ? ORDER BY id ASC", guildID, ownerID)
+}
+
+func (s *sqliteStore) StreamsByType(streamType StreamType) ([]Stream, error) {
+	return s.selectStreams("type = ? ORDER BY id ASC", streamType)
+}
+
+func (s *sqliteStore) StreamsByUser(streamType StreamType, streamUserID string) ([]Stream, error) {
+	return s.selectStreams("type = ? AND stream_user_id = ? ORDER BY id ASC", streamType, streamUserID)
+}
+
+func (s *sqliteStore) StreamUserIDs(streamType StreamType) ([]string, error) {
+	userIDs := []string{}
+	err := s.query(func(rows *sql.Rows) error {
+		var userID string
+		err := rows.Scan(&userID)
+		userIDs = append(userIDs, userID)
+		return err
+	}, "SELECT DISTINCT stream_user_id FROM streams WHERE type = ? AND stream_user_id <> ''", streamType)
+	return userIDs, err
+}
+
+func (s *sqliteStore) CountLiveStreams(guildID string, ownerID string) (int, error) {
+	var count int
+	err := s.db.QueryRow("SELECT count(*) FROM streams WHERE guild_id = ? AND owner_id = ? AND live", guildID, ownerID).Scan(&count)
+	return count, err
+}
+
+func (s *sqliteStore) DeleteStream(id int64) error {
+	_, err := s.exec("DELETE FROM streams WHERE id = ?", id)
+	return err
+}
+
+func (s *sqliteStore) UpdateOwnerNames(guildID string, owner *Stream) error {
+	_, err := s.exec("UPDATE streams SET owner_name = ?, owner_discriminator = ?, owner_global_name = ?, owner_nick = ?, owner_avatar = ? WHERE guild_id = ? AND owner_id = ?",
+		owner.OwnerName, owner.OwnerDiscriminator, owner.OwnerGlobalName, owner.OwnerNick, owner.OwnerAvatar, guildID, owner.OwnerID)
+	return err
+}
+
+func (s *sqliteStore) SaveLiveDetails(stream *Stream) error {
+	_, err := s.exec("UPDATE streams SET title = ?, game = ?, viewer_count = ?, thumbnail_url = ?, peak_viewers = ? WHERE id = ?",
+		stream.Title, stream.Game, stream.ViewerCount, stream.ThumbnailURL, stream.PeakViewers, stream.ID)
+	return err
+}
+
+func (s *sqliteStore) SetLive(stream *Stream) (bool, error) {
+	var res sql.Result
+	var err error
+	if stream.Live {
+		res, err = s.exec("UPDATE streams SET live = ?, viewer_count = ?, live_since = ?, title = ?, game = ?, thumbnail_url = ?, peak_viewers = ?, announce_channel_id = NULL, announce_message_id = NULL WHERE id = ? AND live IS NOT ?",
+			stream.Live, stream.ViewerCount, stream.LiveSince, stream.Title, stream.Game, stream.ThumbnailURL, stream.PeakViewers, stream.ID, stream.Live)
+	} else {
+		res, err = s.exec("UPDATE streams SET live = ?, viewer_count = ? WHERE id = ? AND live IS NOT ?",
+			stream.Live, stream.ViewerCount, stream.ID, stream.Live)
+	}
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+func (s *sqliteStore) SaveAnnouncement(stream *Stream) error {
+	_, err := s.exec("UPDATE streams SET announce_channel_id = ?, announce_message_id = ? WHERE id = ?",
+		stream.AnnounceChannelID, stream.AnnounceMessageID, stream.ID)
+	return err
+}
+
+func (s *sqliteStore) SaveGuild(guild *Guild) error {
+	values, err := sqliteArgs(sqliteFieldValues(guildFields(guild))...)
+	if err != nil {
+		return err
+	}
+	// guilds have their own id so it is saved too
+	query := fmt.Sprintf("INSERT INTO guilds (%s) VALUES (%s) ON CONFLICT (id) DO UPDATE SET name=excluded.name, owner=excluded.owner, owner_id=excluded.owner_id RETURNING %s",
+		strings.Join(guildColumns, ", "), sqlitePlaceholders(len(guildColumns)), strings.Join(guildColumns, ", "))
+	return s.db.QueryRow(query, append([]interface{}{guild.ID}, values...)...).Scan(sqliteScanFields(guildFields(guild))...)
+}
+
+func (s *sqliteStore) GetGuild(id string) (*Guild, error) {
+	guilds, err := s.selectGuilds("id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(guilds) == 0 {
+		return nil, errNotFound
+	}
+	return &guilds[0], nil
+}
+
+func (s *sqliteStore) AllGuilds() ([]Guild, error) {
+	return s.selectGuilds("1 = 1 ORDER BY id ASC")
+}
+
+func (s *sqliteStore) DeleteGuild(id string) error {
+	_, err := s.exec("DELETE FROM api_tokens WHERE guild_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = s.exec("DELETE FROM guilds WHERE id = ?", id)
+	return err
+}
+
+func (s *sqliteStore) UpdateGuildSetting(guildID string, column string, value interface{}) (*Guild, error) {
+	known := false
+	for _, name := range guildColumns[1:] {
+		known = known || name == column
+	}
+	if !known {
+		return nil, fmt.Errorf("guilds has no column %s", column)
+	}
+
+	res, err := s.exec("UPDATE guilds SET "+column+" = ? WHERE id = ?", value, guildID)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, errNotFound
+	}
+	return s.GetGuild(guildID)
+}
+
+func (s *sqliteStore) LeaderboardGuildsDue(until time.Time) ([]Guild, error) {
+	return s.selectGuilds("leaderboard_channel_id IS NOT NULL AND leaderboard_channel_id != '' AND (leaderboard_posted_at IS NULL OR leaderboard_posted_at < ?) ORDER BY id ASC", until)
+}
+
+func (s *sqliteStore) MarkLeaderboardPosted(guildID string, now time.Time, until time.Time) (bool, error) {
+	res, err := s.exec("UPDATE guilds SET leaderboard_posted_at = ? WHERE id = ? AND (leaderboard_posted_at IS NULL OR leaderboard_posted_at < ?)", now, guildID, until)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+func (s *sqliteStore) UnmarkLeaderboardPosted(guildID string, until time.Time, postedAt time.Time) error {
+	_, err := s.exec("UPDATE guilds SET leaderboard_posted_at = ? WHERE id = ? AND leaderboard_posted_at >= ?", postedAt, guildID, until)
+	return err
+}
+
+func (s *sqliteStore) StartSession(session *StreamSession) error {
+	return s.insert("stream_sessions", sessionColumns, sessionFields(session), "")
+}
+
+func (s *sqliteStore) UpdateSession(stream *Stream) error {
+	_, err := s.exec("UPDATE stream_sessions SET title = ?, game = ?, peak_viewers = ? WHERE stream_id = ? AND ended_at IS NULL",
+		stream.Title, stream.Game, stream.PeakViewers, stream.ID)
+	return err
+}
+
+func (s *sqliteStore) EndSession(stream *Stream, endedAt time.Time) error {
+	_, err := s.exec("UPDATE stream_sessions SET ended_at = ?, peak_viewers = ? WHERE stream_id = ? AND ended_at IS NULL",
+		endedAt, stream.PeakViewers, stream.ID)
+	return err
+}
+
+func (s *sqliteStore) StreamSessions(streamID int64) ([]StreamSession, error) {
+	return s.selectSessions("stream_id = ? ORDER BY started_at DESC", streamID)
+}
+
+func (s *sqliteStore) OwnerSessions(guildID string, ownerID string) ([]StreamSession, error) {
+	return s.selectSessions("guild_id = ? AND owner_id = ? ORDER BY started_at DESC", guildID, ownerID)
+}
+
+func (s *sqliteStore) GuildSessions(guildID string, since time.Time, until time.Time) ([]StreamSession, error) {
+	return s.selectSessions("guild_id = ? AND started_at < ? AND (ended_at IS NULL OR ended_at > ?) ORDER BY started_at ASC", guildID, until, since)
+}
+
+func (s *sqliteStore) AddAPIToken(token *APIToken) error {
+	return s.insert("api_tokens", tokenColumns, tokenFields(token), "")
+}
+
+func (s *sqliteStore) FindAPIToken(tokenHash string) (*APIToken, error) {
+	tokens, err := s.selectTokens("token_hash = ?", tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errNotFound
+	}
+	return &tokens[0], nil
+}
+
+func (s *sqliteStore) GuildAPITokens(guildID string) ([]APIToken, error) {
+	return s.selectTokens("guild_id = ? ORDER BY id ASC", guildID)
+}
+
+func (s *sqliteStore) DeleteAPIToken(guildID string, id int64) (bool, error) {
+	res, err := s.exec("DELETE FROM api_tokens WHERE id = ? AND guild_id = ?", id, guildID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+func (s *sqliteStore) DeleteOwnerAPITokens(guildID string, ownerID string) error {
+	_, err := s.exec("DELETE FROM api_tokens WHERE guild_id = ? AND owner_id = ?", guildID, ownerID)
+	return err
+}
+
+func (s *sqliteStore) TouchAPIToken(token *APIToken) error {
+	_, err := s.exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ?", token.LastUsedAt, token.ID)
+	return err
+}
+
+func (s *sqliteStore) Migrations() []migration {
+	return sqliteMigrations
+}
+
+func (s *sqliteStore) AppliedMigrations() (map[int]bool, error) {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version integer PRIMARY KEY, name text, applied_at datetime)`)
+	if err != nil {
+		return nil, err
+	}
+	applied := map[int]bool{}
+	err = s.query(func(rows *sql.Rows) error {
+		var version int
+		err := rows.Scan(&version)
+		applied[version] = true
+		return err
+	}, "SELECT version FROM schema_migrations")
+	return applied, err
+}
+
+// RunMigration doesn't need a lock like postgres, a sqlite file has only one writer
+func (s *sqliteStore) RunMigration(m migration, up bool) (bool, error) {
+	applied, err := s.AppliedMigrations()
+	if err != nil || applied[m.Version] == up {
+		return false, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range m.statements(up) {
+		_, err = tx.Exec(statement)
+		if err != nil {
+			return false, fmt.Errorf("migration %d %s: %s", m.Version, m.Name, err)
+		}
+	}
+	if up {
+		_, err = tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", m.Version, m.Name, time.Now().UTC().Format(sqliteTimeFormat))
+	} else {
+		_, err = tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version)
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (s *sqliteStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	store, err := newSQLiteStore(filepath.Join(t.TempDir(), "streamers.db"))
+	if err != nil {
+		t.Fatalf("newSQLiteStore() got an error: %s", err)
+	}
+	defer store.Close()
+	testStore(t, store)
+}
+
+// TestPostgresStore needs an empty database it can drop tables in, like
+// TEST_DATABASE_ADDR=localhost:5432 TEST_DATABASE_USER=postgres TEST_DATABASE_NAME=streamers_test
+func TestPostgresStore(t *testing.T) {
+	if os.Getenv("TEST_DATABASE_ADDR") == "" {
+		t.Skip("TEST_DATABASE_ADDR isn't set")
+	}
+	store := newPostgresStore(os.Getenv("TEST_DATABASE_ADDR"), os.Getenv("TEST_DATABASE_USER"), os.Getenv("TEST_DATABASE_PASSWORD"), os.Getenv("TEST_DATABASE_NAME"))
+	defer store.Close()
+	testStore(t, store)
+}
+
+// testStore is the conformance suite every Store has to pass
+func testStore(t *testing.T, store Store) {
+	applied, err := store.AppliedMigrations()
+	if err != nil {
+		t.Fatalf("AppliedMigrations() got an error: %s", err)
+	}
+	_, err = migrateDown(store, len(applied))
+	if err != nil {
+		t.Fatalf("migrateDown() got an error: %s", err)
+	}
+	done, err := migrateUp(store, latestMigration(store.Migrations()))
+	if err != nil {
+		t.Fatalf("migrateUp() got an error: %s", err)
+	}
+	if len(done) != len(store.Migrations()) {
+		t.Fatalf("migrateUp() applied %d migrations; want %d", len(done), len(store.Migrations()))
+	}
+	done, err = migrateUp(store, latestMigration(store.Migrations()))
+	if err != nil || len(done) != 0 {
+		t.Fatalf("migrateUp() a second time = %v, %v; want nothing applied", done, err)
+	}
+
+	t.Run("streams", func(t *testing.T) { testStoreStreams(t, store) })
+	t.Run("live", func(t *testing.T) { testStoreLive(t, store) })
+	t.Run("guilds", func(t *testing.T) { testStoreGuilds(t, store) })
+	t.Run("sessions", func(t *testing.T) { testStoreSessions(t, store) })
+	t.Run("api tokens", func(t *testing.T) { testStoreAPITokens(t, store) })
+}
+
+func mustAddStream(t *testing.T, store Store, stream Stream) Stream {
+	err := store.AddStream(&stream)
+	if err != nil {
+		t.Fatalf("AddStream(%s) got an error: %s", stream, err)
+	}
+	return stream
+}
+
+func streamIDs(streams []Stream) []int {
+	ids := []int{}
+	for _, stream := range streams {
+		ids = append(ids, int(stream.ID))
+	}
+	return ids
+}
+
+func testStoreStreams(t *testing.T, store Store) {
+	first := mustAddStream(t, store, Stream{GuildID: "g1", OwnerID: "o1", OwnerName: "halkeye", Type: StreamTwitch, StreamUsername: "halkeye", StreamUserID: "t1"})
+	if first.ID == 0 {
+		t.Fatalf("AddStream() didn't set the id")
+	}
+	second := mustAddStream(t, store, Stream{GuildID: "g1", OwnerID: "o1", OwnerName: "halkeye", Type: StreamYouTube, StreamUsername: "@halkeye", StreamUserID: "UC1"})
+	other := mustAddStream(t, store, Stream{GuildID: "g1", OwnerID: "o2", OwnerName: "gavin", Type: StreamTwitch, StreamUsername: "gavin", StreamUserID: "t2"})
+	mustAddStream(t, store, Stream{GuildID: "g2", OwnerID: "o1", OwnerName: "halkeye", Type: StreamTwitch, StreamUsername: "halkeye", StreamUserID: "t1"})
+
+	readded := mustAddStream(t, store, Stream{GuildID: "g1", OwnerID: "o1", OwnerName: "renamed", OwnerNick: "nick", Type: StreamTwitch, StreamUsername: "Halkeye", StreamUserID: "t1"})
+	if readded.ID != first.ID || readded.OwnerName != "renamed" || readded.OwnerNick != "nick" || readded.StreamUsername != "Halkeye" {
+		t.Errorf("AddStream() again = %+v; want stream %d with the new names", readded, first.ID)
+	}
+
+	got, err := store.GetStream(first.ID)
+	if err != nil || got.OwnerName != "renamed" || got.Type != StreamTwitch || got.GuildID != "g1" {
+		t.Errorf("GetStream(%d) = %+v, %v; want the renamed stream", first.ID, got, err)
+	}
+	_, err = store.GetStream(999999)
+	if err != errNotFound {
+		t.Errorf("GetStream(999999) error = %v; want %v", err, errNotFound)
+	}
+
+	items := [][]interface{}{
+		[]interface{}{"GuildStreams(g1)", func() ([]Stream, error) { return store.GuildStreams("g1") }, []int{int(first.ID), int(second.ID), int(other.ID)}},
+		[]interface{}{"GuildStreams(none)", func() ([]Stream, error) { return store.GuildStreams("none") }, []int{}},
+		[]interface{}{"OwnerStreams(g1, o1)", func() ([]Stream, error) { return store.OwnerStreams("g1", "o1") }, []int{int(first.ID), int(second.ID)}},
+		[]interface{}{"StreamsByType(YouTube)", func() ([]Stream, error) { return store.StreamsByType(StreamYouTube) }, []int{int(second.ID)}},
+		[]interface{}{"StreamsByUser(Twitch, t2)", func() ([]Stream, error) { return store.StreamsByUser(StreamTwitch, "t2") }, []int{int(other.ID)}},
+	}
+	for _, item := range items {
+		streams, err := item[1].(func() ([]Stream, error))()
+		if err != nil {
+			t.Errorf("%s got an error: %s", item[0].(string), err)
+		}
+		if !equalInts(streamIDs(streams), item[2].([]int)) {
+			t.Errorf("%s = %v; want %v", item[0].(string), streamIDs(streams), item[2].([]int))
+		}
+	}
+
+	userIDs, err := store.StreamUserIDs(StreamTwitch)
+	if err != nil || len(userIDs) != 2 {
+		t.Errorf("StreamUserIDs(Twitch) = %v, %v; want t1 and t2 once each", userIDs, err)
+	}
+
+	owner := &Stream{OwnerID: "o1", OwnerName: "halkeye", OwnerGlobalName: "Gavin", OwnerAvatar: "abc"}
+	err = store.UpdateOwnerNames("g1", owner)
+	if err != nil {
+		t.Fatalf("UpdateOwnerNames() got an error: %s", err)
+	}
+	streams, _ := store.OwnerStreams("g1", "o1")
+	for _, stream := range streams {
+		if stream.OwnerName != "halkeye" || stream.OwnerGlobalName != "Gavin" || stream.OwnerNick != "" || stream.OwnerAvatar != "abc" {
+			t.Errorf("UpdateOwnerNames() left %+v", stream)
+		}
+	}
+	streams, _ = store.OwnerStreams("g2", "o1")
+	if len(streams) != 1 || streams[0].OwnerGlobalName != "" {
+		t.Errorf("UpdateOwnerNames() changed another guild: %+v", streams)
+	}
+
+	err = store.DeleteStream(second.ID)
+	if err != nil {
+		t.Fatalf("DeleteStream() got an error: %s", err)
+	}
+	streams, _ = store.StreamsByType(StreamYouTube)
+	if len(streams) != 0 {
+		t.Errorf("DeleteStream() left %v", streams)
+	}
+}
+
+func testStoreLive(t *testing.T, store Store) {
+	stream := mustAddStream(t, store, Stream{GuildID: "live", OwnerID: "o1", Type: StreamTwitch, StreamUsername: "a", StreamUserID: "l1"})
+	later := mustAddStream(t, store, Stream{GuildID: "live", OwnerID: "o2", Type: StreamTwitch, StreamUsername: "b", StreamUserID: "l2"})
+	liveSince := time.Date(2019, 5, 5, 2, 50, 52, 0, time.UTC)
+
+	for _, s := range []*Stream{&later, &stream} {
+		s.Live = true
+		s.LiveSince = liveSince
+		if s.ID == later.ID {
+			s.LiveSince = liveSince.Add(time.Hour)
+		}
+		s.Title = "Building a bot"
+		s.Game = "Software and Game Development"
+		s.ViewerCount = 10
+		s.PeakViewers = 10
+		changed, err := store.SetLive(s)
+		if err != nil || !changed {
+			t.Errorf("SetLive(%s) = %t, %v; want it changed", s, changed, err)
+		}
+	}
+	changed, err := store.SetLive(&stream)
+	if err != nil || changed {
+		t.Errorf("SetLive() when already live = %t, %v; want no change", changed, err)
+	}
+
+	live, err := store.LiveStreams("live")
+	if err != nil || !equalInts(streamIDs(live), []int{int(stream.ID), int(later.ID)}) {
+		t.Fatalf("LiveStreams() = %v, %v; want longest live first", streamIDs(live), err)
+	}
+	if !live[0].LiveSince.Equal(liveSince) || live[0].Title != "Building a bot" || live[0].ViewerCount != 10 {
+		t.Errorf("LiveStreams()[0] = %+v; want the saved details", live[0])
+	}
+	count, err := store.CountLiveStreams("live", "o1")
+	if err != nil || count != 1 {
+		t.Errorf("CountLiveStreams() = %d, %v; want 1", count, err)
+	}
+
+	stream.AnnounceChannelID = "channel"
+	stream.AnnounceMessageID = "message"
+	err = store.SaveAnnouncement(&stream)
+	if err != nil {
+		t.Errorf("SaveAnnouncement() got an error: %s", err)
+	}
+	stream.Game = "Just Chatting"
+	stream.ViewerCount = 5
+	err = store.SaveLiveDetails(&stream)
+	if err != nil {
+		t.Errorf("SaveLiveDetails() got an error: %s", err)
+	}
+
+	stream.Live = false
+	stream.ViewerCount = 0
+	changed, err = store.SetLive(&stream)
+	if err != nil || !changed {
+		t.Errorf("SetLive(offline) = %t, %v; want it changed", changed, err)
+	}
+	got, _ := store.GetStream(stream.ID)
+	if got.Live || got.Game != "Just Chatting" || got.PeakViewers != 10 || got.AnnounceMessageID != "message" {
+		t.Errorf("after going offline = %+v; want the last session's details kept", got)
+	}
+
+	stream.Live = true
+	changed, err = store.SetLive(&stream)
+	got, _ = store.GetStream(stream.ID)
+	if err != nil || !changed || got.AnnounceChannelID != "" || got.AnnounceMessageID != "" {
+		t.Errorf("going live again = %+v, %v; want the old announcement cleared", got, err)
+	}
+}
+
+func testStoreGuilds(t *testing.T, store Store) {
+	guild := &Guild{ID: "guild", Name: "Streamers", Owner: "halkeye", OwnerID: "o1"}
+	err := store.SaveGuild(guild)
+	if err != nil {
+		t.Fatalf("SaveGuild() got an error: %s", err)
+	}
+
+	items := [][]interface{}{
+		[]interface{}{"prefix", "?"},
+		[]interface{}{"allowed_stream_types", []StreamType{StreamTwitch}},
+		[]interface{}{"public_dashboard", true},
+		[]interface{}{"leaderboard_channel_id", "leaderboards"},
+	}
+	for _, item := range items {
+		_, err := store.UpdateGuildSetting("guild", item[0].(string), item[1])
+		if err != nil {
+			t.Errorf("UpdateGuildSetting(%s) got an error: %s", item[0].(string), err)
+		}
+	}
+	_, err = store.UpdateGuildSetting("missing", "prefix", "?")
+	if err != errNotFound {
+		t.Errorf("UpdateGuildSetting(missing) error = %v; want %v", err, errNotFound)
+	}
+
+	// saving it again from discord keeps the settings
+	guild = &Guild{ID: "guild", Name: "Renamed", Owner: "halkeye", OwnerID: "o1"}
+	err = store.SaveGuild(guild)
+	if err != nil {
+		t.Fatalf("SaveGuild() again got an error: %s", err)
+	}
+	if guild.Name != "Renamed" || guild.Prefix != "?" || !guild.PublicDashboard || !guild.AllowsStreamType(StreamTwitch) || guild.AllowsStreamType(StreamYouTube) {
+		t.Errorf("SaveGuild() = %+v; want the new name and the old settings", guild)
+	}
+
+	got, err := store.UpdateGuildSetting("guild", "allowed_stream_types", []StreamType{})
+	if err != nil || len(got.AllowedStreamTypes) != 0 {
+		t.Errorf("UpdateGuildSetting(allowed_stream_types, []) = %+v, %v; want no types", got, err)
+	}
+	got, err = store.UpdateGuildSetting("guild", "prefix", "")
+	if err != nil || got.Prefix != "" || got.CommandPrefix() != defaultPrefix {
+		t.Errorf("UpdateGuildSetting(prefix, \"\") = %+v, %v; want it reset", got, err)
+	}
+
+	until := time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)
+	due, err := store.LeaderboardGuildsDue(until)
+	if err != nil || len(due) != 1 || due[0].ID != "guild" {
+		t.Errorf("LeaderboardGuildsDue() = %v, %v; want guild", due, err)
+	}
+	claimed, err := store.MarkLeaderboardPosted("guild", until.Add(time.Hour), until)
+	if err != nil || !claimed {
+		t.Errorf("MarkLeaderboardPosted() = %t, %v; want it claimed", claimed, err)
+	}
+	claimed, err = store.MarkLeaderboardPosted("guild", until.Add(2*time.Hour), until)
+	if err != nil || claimed {
+		t.Errorf("MarkLeaderboardPosted() twice = %t, %v; want it already claimed", claimed, err)
+	}
+	err = store.UnmarkLeaderboardPosted("guild", until, time.Time{})
+	if err != nil {
+		t.Errorf("UnmarkLeaderboardPosted() got an error: %s", err)
+	}
+	claimed, err = store.MarkLeaderboardPosted("guild", until.Add(time.Hour), until)
+	if err != nil || !claimed {
+		t.Errorf("MarkLeaderboardPosted() after giving it back = %t, %v; want it claimed", claimed, err)
+	}
+	due, err = store.LeaderboardGuildsDue(until)
+	if err != nil || len(due) != 0 {
+		t.Errorf("LeaderboardGuildsDue() after posting = %v, %v; want none", due, err)
+	}
+	due, _ = store.LeaderboardGuildsDue(until.AddDate(0, 0, 7))
+	if len(due) != 1 || !due[0].LeaderboardPostedAt.Equal(until.Add(time.Hour)) {
+		t.Errorf("LeaderboardGuildsDue() next week = %v; want guild posted at %s", due, until.Add(time.Hour))
+	}
+
+	err = store.SaveGuild(&Guild{ID: "another", Name: "Another"})
+	if err != nil {
+		t.Fatalf("SaveGuild(another) got an error: %s", err)
+	}
+	guilds, err := store.AllGuilds()
+	if err != nil || len(guilds) != 2 || guilds[0].ID != "another" || guilds[1].ID != "guild" || guilds[1].Prefix != "" || !guilds[1].PublicDashboard {
+		t.Errorf("AllGuilds() = %+v, %v; want another and guild", guilds, err)
+	}
+
+	err = store.DeleteGuild("guild")
+	if err != nil {
+		t.Fatalf("DeleteGuild() got an error: %s", err)
+	}
+	guilds, _ = store.AllGuilds()
+	if len(guilds) != 1 {
+		t.Errorf("AllGuilds() after DeleteGuild() = %+v; want only another", guilds)
+	}
+	_, err = store.GetGuild("guild")
+	if err != errNotFound {
+		t.Errorf("GetGuild() after DeleteGuild() error = %v; want %v", err, errNotFound)
+	}
+}
+
+func testStoreSessions(t *testing.T, store Store) {
+	start := time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC)
+	stream := &Stream{ID: 42, GuildID: "sessions", OwnerID: "o1", Type: StreamTwitch, Title: "first", PeakViewers: 3}
+
+	ended := &StreamSession{StreamID: stream.ID, GuildID: "sessions", OwnerID: "o1", Type: StreamTwitch, StartedAt: start, EndedAt: start.Add(2 * time.Hour), Title: "old"}
+	err := store.StartSession(ended)
+	if err != nil || ended.ID == 0 {
+		t.Fatalf("StartSession() = %d, %v; want an id", ended.ID, err)
+	}
+	open := &StreamSession{StreamID: stream.ID, GuildID: "sessions", OwnerID: "o1", Type: StreamTwitch, StartedAt: start.AddDate(0, 0, 2), Title: "first"}
+	err = store.StartSession(open)
+	if err != nil {
+		t.Fatalf("StartSession() got an error: %s", err)
+	}
+
+	stream.Title = "second"
+	stream.Game = "Chess"
+	stream.PeakViewers = 8
+	err = store.UpdateSession(stream)
+	if err != nil {
+		t.Fatalf("UpdateSession() got an error: %s", err)
+	}
+	sessions, err := store.StreamSessions(stream.ID)
+	if err != nil || len(sessions) != 2 {
+		t.Fatalf("StreamSessions() = %v, %v; want 2 sessions", sessions, err)
+	}
+	if sessions[0].ID != open.ID || sessions[0].Title != "second" || sessions[0].PeakViewers != 8 || !sessions[0].EndedAt.IsZero() {
+		t.Errorf("StreamSessions()[0] = %+v; want the updated open session first", sessions[0])
+	}
+	if sessions[1].Title != "old" || !sessions[1].EndedAt.Equal(start.Add(2*time.Hour)) {
+		t.Errorf("StreamSessions()[1] = %+v; want the ended session unchanged", sessions[1])
+	}
+
+	items := [][]interface{}{
+		// since, until, sessions
+		[]interface{}{start.Add(-time.Hour), start.Add(time.Hour), 1},
+		[]interface{}{start.Add(3 * time.Hour), start.AddDate(0, 0, 1), 0},
+		[]interface{}{start.Add(3 * time.Hour), start.AddDate(0, 0, 7), 1},
+		[]interface{}{start.Add(-time.Hour), start.AddDate(0, 0, 7), 2},
+	}
+	for _, item := range items {
+		sessions, err := store.GuildSessions("sessions", item[0].(time.Time), item[1].(time.Time))
+		if err != nil || len(sessions) != item[2].(int) {
+			t.Errorf("GuildSessions(%s, %s) = %d sessions, %v; want %d", item[0].(time.Time), item[1].(time.Time), len(sessions), err, item[2].(int))
+		}
+	}
+
+	endedAt := start.AddDate(0, 0, 2).Add(90 * time.Minute)
+	err = store.EndSession(stream, endedAt)
+	if err != nil {
+		t.Fatalf("EndSession() got an error: %s", err)
+	}
+	sessions, err = store.OwnerSessions("sessions", "o1")
+	if err != nil || len(sessions) != 2 || !sessions[0].EndedAt.Equal(endedAt) || sessions[0].Duration(time.Now()) != 90*time.Minute {
+		t.Errorf("OwnerSessions() after EndSession() = %+v, %v; want the session ended", sessions, err)
+	}
+}
+
+func testStoreAPITokens(t *testing.T, store Store) {
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	token := &APIToken{GuildID: "tokens", OwnerID: "o1", OwnerName: "halkeye", Name: "script", TokenHash: hashAPIToken("secret"), Scope: apiScopeRead, CreatedAt: createdAt}
+	err := store.AddAPIToken(token)
+	if err != nil || token.ID == 0 {
+		t.Fatalf("AddAPIToken() = %d, %v; want an id", token.ID, err)
+	}
+
+	found, err := store.FindAPIToken(hashAPIToken("secret"))
+	if err != nil || found.ID != token.ID || found.Scope != apiScopeRead || !found.CreatedAt.Equal(createdAt) || !found.LastUsedAt.IsZero() {
+		t.Errorf("FindAPIToken() = %+v, %v; want %+v", found, err, token)
+	}
+	_, err = store.FindAPIToken(hashAPIToken("wrong"))
+	if err != errNotFound {
+		t.Errorf("FindAPIToken(wrong) error = %v; want %v", err, errNotFound)
+	}
+
+	token.LastUsedAt = createdAt.Add(time.Hour)
+	err = store.TouchAPIToken(token)
+	if err != nil {
+		t.Errorf("TouchAPIToken() got an error: %s", err)
+	}
+	tokens, err := store.GuildAPITokens("tokens")
+	if err != nil || len(tokens) != 1 || !tokens[0].LastUsedAt.Equal(token.LastUsedAt) {
+		t.Errorf("GuildAPITokens() = %+v, %v; want the used token", tokens, err)
+	}
+
+	deleted, err := store.DeleteAPIToken("other", token.ID)
+	if err != nil || deleted {
+		t.Errorf("DeleteAPIToken(other guild) = %t, %v; want nothing deleted", deleted, err)
+	}
+	deleted, err = store.DeleteAPIToken("tokens", token.ID)
+	if err != nil || !deleted {
+		t.Errorf("DeleteAPIToken() = %t, %v; want it deleted", deleted, err)
+	}
+
+	for _, owned := range []*APIToken{
+		&APIToken{GuildID: "tokens", OwnerID: "o1", Name: "leaving", TokenHash: hashAPIToken("leaving"), Scope: apiScopeRead, CreatedAt: createdAt},
+		&APIToken{GuildID: "tokens", OwnerID: "o2", Name: "staying", TokenHash: hashAPIToken("staying"), Scope: apiScopeRead, CreatedAt: createdAt},
+		&APIToken{GuildID: "deleted", OwnerID: "o2", Name: "gone", TokenHash: hashAPIToken("gone"), Scope: apiScopeRead, CreatedAt: createdAt},
+	} {
+		err = store.AddAPIToken(owned)
+		if err != nil {
+			t.Fatalf("AddAPIToken(%s) got an error: %s", owned.Name, err)
+		}
+	}
+	err = store.DeleteOwnerAPITokens("tokens", "o1")
+	if err != nil {
+		t.Errorf("DeleteOwnerAPITokens() got an error: %s", err)
+	}
+	tokens, _ = store.GuildAPITokens("tokens")
+	if len(tokens) != 1 || tokens[0].Name != "staying" {
+		t.Errorf("GuildAPITokens() after DeleteOwnerAPITokens() = %+v; want only staying", tokens)
+	}
+	err = store.DeleteGuild("deleted")
+	if err != nil {
+		t.Errorf("DeleteGuild() got an error: %s", err)
+	}
+	if _, err = store.FindAPIToken(hashAPIToken("gone")); err != errNotFound {
+		t.Errorf("FindAPIToken() after DeleteGuild() error = %v; want %v", err, errNotFound)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/getsentry/raven-go"
+)
+
+// startSession records that a stream went live
+func (a *App) startSession(stream *Stream) {
+	session := &StreamSession{
+		StreamID:    stream.ID,
+		GuildID:     stream.GuildID,
+		OwnerID:     stream.OwnerID,
+		Type:        stream.Type,
+		StartedAt:   stream.LiveSince,
+		Title:       stream.Title,
+		Game:        stream.Game,
+		PeakViewers: stream.PeakViewers,
+	}
+	err := a.Store.StartSession(session)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("Error starting session for "+stream.String(), err)
+	}
+}
+
+// updateSession copies the latest details of a live stream onto its open session
+func (a *App) updateSession(stream *Stream) {
+	err := a.Store.UpdateSession(stream)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("Error updating session for "+stream.String(), err)
+	}
+}
+
+// endSession closes the open session of a stream that went offline
+func (a *App) endSession(stream *Stream, endedAt time.Time) {
+	err := a.Store.EndSession(stream, endedAt)
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("Error ending session for "+stream.String(), err)
+	}
+}
+
+// gameTime is how long was spent streaming one game
+type gameTime struct {
+	Game     string
+	Duration time.Duration
+}
+
+// streamStats sums up a set of sessions
+type streamStats struct {
+	Sessions int
+	Total    time.Duration
+	Average  time.Duration
+	// Games is the most streamed games first
+	Games []gameTime
+	// Recent is the newest sessions first
+	Recent []StreamSession
+}
+
+const (
+	statsTopGames       = 5
+	statsRecentSessions = 10
+)
+
+// sessionStats works out the totals for sessions, in any order
+func sessionStats(sessions []StreamSession, now time.Time) streamStats {
+	stats := streamStats{Sessions: len(sessions)}
+	games := map[string]time.Duration{}
+
+	for _, session := range sessions {
+		duration := session.Duration(now)
+		stats.Total += duration
+		if session.Game != "" {
+			games[session.Game] += duration
+		}
+	}
+	if stats.Sessions > 0 {
+		stats.Average = stats.Total / time.Duration(stats.Sessions)
+	}
+
+	for game, duration := range games {
+		stats.Games = append(stats.Games, gameTime{Game: game, Duration: duration})
+	}
+	sort.Slice(stats.Games, func(i, j int) bool {
+		if stats.Games[i].Duration == stats.Games[j].Duration {
+			return stats.Games[i].Game < stats.Games[j].Game
+		}
+		return stats.Games[i].Duration > stats.Games[j].Duration
+	})
+	if len(stats.Games) > statsTopGames {
+		stats.Games = stats.Games[:statsTopGames]
+	}
+
+	stats.Recent = append([]StreamSession{}, sessions...)
+	sort.Slice(stats.Recent, func(i, j int) bool { return stats.Recent[i].StartedAt.After(stats.Recent[j].StartedAt) })
+	if len(stats.Recent) > statsRecentSessions {
+		stats.Recent = stats.Recent[:statsRecentSessions]
+	}
+	return stats
+}
+
+// Hours is the total rounded for display, like 12.5
+func (s streamStats) Hours() float64 {
+	return float64(int(s.Total.Hours()*10)) / 10
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionStats(t *testing.T) {
+	now := time.Date(2019, 5, 10, 12, 0, 0, 0, time.UTC)
+	sessions := []StreamSession{
+		StreamSession{StartedAt: now.Add(-72 * time.Hour), EndedAt: now.Add(-70 * time.Hour), Game: "Factorio"},
+		StreamSession{StartedAt: now.Add(-48 * time.Hour), EndedAt: now.Add(-47 * time.Hour), Game: "Science & Technology"},
+		StreamSession{StartedAt: now.Add(-24 * time.Hour), EndedAt: now.Add(-21 * time.Hour), Game: "Factorio"},
+		// still live
+		StreamSession{StartedAt: now.Add(-30 * time.Minute)},
+	}
+
+	stats := sessionStats(sessions, now)
+	if stats.Sessions != 4 || stats.Total != 6*time.Hour+30*time.Minute || stats.Average != 97*time.Minute+30*time.Second {
+		t.Errorf("sessionStats() = %d sessions, %s total, %s average; want 4, 6h30m, 1h37m30s", stats.Sessions, stats.Total, stats.Average)
+	}
+	if stats.Hours() != 6.5 {
+		t.Errorf("Hours() = %v; want 6.5", stats.Hours())
+	}
+	if len(stats.Games) != 2 || stats.Games[0].Game != "Factorio" || stats.Games[0].Duration != 5*time.Hour {
+		t.Errorf("Games = %+v; want Factorio first with 5h", stats.Games)
+	}
+	if !stats.Recent[0].EndedAt.IsZero() || stats.Recent[3].Game != "Factorio" {
+		t.Errorf("Recent = %+v; want the newest session first", stats.Recent)
+	}
+}
+
+func TestStreamStatsTemplate(t *testing.T) {
+	now := time.Now()
+	stream := &Stream{ID: 1, GuildID: "guild", OwnerName: "halkeye", Type: StreamTwitch, StreamUsername: "halkeye"}
+	sessions := []StreamSession{
+		StreamSession{StartedAt: now.Add(-2 * time.Hour), EndedAt: now.Add(-time.Hour), Title: "Building a bot", Game: "Science & Technology", PeakViewers: 42},
+	}
+
+	var out bytes.Buffer
+	err := streamStatsTemplate.Execute(&out, map[string]interface{}{"Stream": stream, "Stats": sessionStats(sessions, now)})
+	if err != nil {
+		t.Fatalf("streamStatsTemplate got an error: %s", err)
+	}
+	for _, want := range []string{"halkeye", "Science &amp; Technology - 1h 0m", "Building a bot", "<td>42</td>"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("streamStatsTemplate output is missing %q", want)
+		}
+	}
+}
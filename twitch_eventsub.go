@@ -0,0 +1,345 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	eventSubHeaderMessageID        = "Twitch-Eventsub-Message-Id"
+	eventSubHeaderMessageTimestamp = "Twitch-Eventsub-Message-Timestamp"
+	eventSubHeaderMessageSignature = "Twitch-Eventsub-Message-Signature"
+	eventSubHeaderMessageType      = "Twitch-Eventsub-Message-Type"
+
+	eventSubMessageVerification = "webhook_callback_verification"
+	eventSubMessageNotification = "notification"
+	eventSubMessageRevocation   = "revocation"
+
+	eventSubStreamOnline  = "stream.online"
+	eventSubStreamOffline = "stream.offline"
+
+	// eventSubMaxAge is how old a message can be before we treat it as a replay
+	eventSubMaxAge = 10 * time.Minute
+)
+
+// eventSubSubscription is the subscription part of every eventsub payload
+type eventSubSubscription struct {
+	ID        string `json:"id,omitempty"`
+	Type      string `json:"type"`
+	Version   string `json:"version"`
+	Status    string `json:"status,omitempty"`
+	Condition struct {
+		BroadcasterUserID string `json:"broadcaster_user_id"`
+	} `json:"condition"`
+	Transport struct {
+		Method   string `json:"method"`
+		Callback string `json:"callback"`
+		Secret   string `json:"secret,omitempty"`
+	} `json:"transport"`
+}
+
+// eventSubEvent is the event body for stream.online and stream.offline
+type eventSubEvent struct {
+	ID                   string    `json:"id"`
+	BroadcasterUserID    string    `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string    `json:"broadcaster_user_login"`
+	Type                 string    `json:"type"`
+	StartedAt            time.Time `json:"started_at"`
+}
+
+type eventSubPayload struct {
+	Challenge    string               `json:"challenge"`
+	Subscription eventSubSubscription `json:"subscription"`
+	Event        eventSubEvent        `json:"event"`
+}
+
+// signEventSub returns the signature twitch sends for a message
+func signEventSub(secret string, messageID string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(messageID))
+	mac.Write([]byte(timestamp))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func verifyEventSub(secret string, header http.Header, body []byte, now time.Time) error {
+	timestamp := header.Get(eventSubHeaderMessageTimestamp)
+	sentAt, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return fmt.Errorf("Invalid eventsub timestamp: %s", err)
+	}
+	if now.Sub(sentAt) > eventSubMaxAge {
+		return fmt.Errorf("Eventsub message is too old: %s", timestamp)
+	}
+
+	expected := signEventSub(secret, header.Get(eventSubHeaderMessageID), timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(header.Get(eventSubHeaderMessageSignature))) {
+		return fmt.Errorf("Eventsub signature does not match")
+	}
+	return nil
+}
+
+// eventSubHandler receives twitch eventsub webhooks and hands stream events to onEvent
+func eventSubHandler(secret string, onEvent func(subscriptionType string, event eventSubEvent) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Unable to read body", http.StatusBadRequest)
+			return
+		}
+
+		err = verifyEventSub(secret, r.Header, body, time.Now())
+		if err != nil {
+			log.Warning("Rejected eventsub message", err)
+			http.Error(w, "Invalid signature", http.StatusForbidden)
+			return
+		}
+
+		var payload eventSubPayload
+		err = json.Unmarshal(body, &payload)
+		if err != nil {
+			http.Error(w, "Invalid body", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Header.Get(eventSubHeaderMessageType) {
+		case eventSubMessageVerification:
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(payload.Challenge))
+		case eventSubMessageNotification:
+			err = onEvent(payload.Subscription.Type, payload.Event)
+			if err != nil {
+				log.Error("Error handling eventsub "+payload.Subscription.Type, err)
+				http.Error(w, "Unable to handle event", http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case eventSubMessageRevocation:
+			log.Warning("Eventsub subscription revoked", payload.Subscription.Type, payload.Subscription.Condition.BroadcasterUserID, payload.Subscription.Status)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+// eventSubClient creates and removes eventsub subscriptions through helix
+type eventSubClient struct {
+	*helixClient
+	callback string
+	secret   string
+}
+
+func newEventSubClient(helix *helixClient, callback string, secret string) *eventSubClient {
+	return &eventSubClient{helixClient: helix, callback: callback, secret: secret}
+}
+
+// eventSubTypes are the subscriptions every tracked twitch user needs
+var eventSubTypes = []string{eventSubStreamOnline, eventSubStreamOffline}
+
+// Subscribe starts online and offline notifications for a twitch user
+func (c *eventSubClient) Subscribe(broadcasterUserID string) error {
+	for _, subscriptionType := range eventSubTypes {
+		err := c.subscribe(broadcasterUserID, subscriptionType)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *eventSubClient) subscribe(broadcasterUserID string, subscriptionType string) error {
+	sub := eventSubSubscription{Type: subscriptionType, Version: "1"}
+	sub.Condition.BroadcasterUserID = broadcasterUserID
+	sub.Transport.Method = "webhook"
+	sub.Transport.Callback = c.callback
+	sub.Transport.Secret = c.secret
+
+	err := c.do("POST", "/eventsub/subscriptions", sub, nil)
+	if e, ok := err.(helixError); ok && e.StatusCode == http.StatusConflict {
+		// already subscribed
+		return nil
+	}
+	return err
+}
+
+// Subscriptions lists the subscriptions sent to our callback, optionally only
+// for one twitch user. Other deployments can share the client id, theirs are left out.
+func (c *eventSubClient) Subscriptions(broadcasterUserID string) ([]eventSubSubscription, error) {
+	var subscriptions []eventSubSubscription
+	cursor := ""
+
+	for {
+		query := url.Values{}
+		if broadcasterUserID != "" {
+			query.Set("user_id", broadcasterUserID)
+		}
+		if cursor != "" {
+			query.Set("after", cursor)
+		}
+
+		var page struct {
+			Data       []eventSubSubscription `json:"data"`
+			Pagination struct {
+				Cursor string `json:"cursor"`
+			} `json:"pagination"`
+		}
+		err := c.do("GET", "/eventsub/subscriptions?"+query.Encode(), nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, sub := range page.Data {
+			if sub.Transport.Callback == c.callback {
+				subscriptions = append(subscriptions, sub)
+			}
+		}
+
+		cursor = page.Pagination.Cursor
+		if cursor == "" {
+			return subscriptions, nil
+		}
+	}
+}
+
+// Unsubscribe removes every subscription we have for a twitch user
+func (c *eventSubClient) Unsubscribe(broadcasterUserID string) error {
+	subscriptions, err := c.Subscriptions(broadcasterUserID)
+	if err != nil {
+		return err
+	}
+	for _, sub := range subscriptions {
+		err = c.do("DELETE", "/eventsub/subscriptions?id="+url.QueryEscape(sub.ID), nil, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eventSubStatusOK is false for subscriptions that failed verification or were revoked
+func eventSubStatusOK(status string) bool {
+	return status == "" || status == "enabled" || status == "webhook_callback_verification_pending"
+}
+
+// Sync makes our subscriptions match the twitch users we are tracking
+func (c *eventSubClient) Sync(broadcasterUserIDs []string) error {
+	subscriptions, err := c.Subscriptions("")
+	if err != nil {
+		return err
+	}
+
+	wanted := map[string]bool{}
+	for _, id := range broadcasterUserIDs {
+		wanted[id] = true
+	}
+
+	// subscribed is keyed by "broadcaster type", a user needs every one of eventSubTypes
+	subscribed := map[string]bool{}
+	for _, sub := range subscriptions {
+		id := sub.Condition.BroadcasterUserID
+		if wanted[id] && eventSubStatusOK(sub.Status) {
+			subscribed[id+" "+sub.Type] = true
+			continue
+		}
+		err = c.do("DELETE", "/eventsub/subscriptions?id="+url.QueryEscape(sub.ID), nil, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, id := range broadcasterUserIDs {
+		for _, subscriptionType := range eventSubTypes {
+			if subscribed[id+" "+subscriptionType] {
+				continue
+			}
+			err = c.subscribe(id, subscriptionType)
+			if err != nil {
+				return err
+			}
+			subscribed[id+" "+subscriptionType] = true
+		}
+	}
+	return nil
+}
+
+// onTwitchStreamEvent records the live state eventsub reported for every stream of that twitch user
+func (a *App) onTwitchStreamEvent(subscriptionType string, event eventSubEvent) error {
+	if subscriptionType != eventSubStreamOnline && subscriptionType != eventSubStreamOffline {
+		return nil
+	}
+
+	streams, err := a.Store.StreamsByUser(StreamTwitch, event.BroadcasterUserID)
+	if err != nil {
+		return err
+	}
+
+	isLive := subscriptionType == eventSubStreamOnline
+	status := liveStatus{StartedAt: event.StartedAt}
+	if isLive && len(streams) > 0 {
+		// the notification doesn't have the title or game, so ask for them
+		live, err := a.provider(StreamTwitch).LiveStatus(streams[:1])
+		if err != nil {
+			log.Warning("Unable to look up stream details for", event.BroadcasterUserID, err)
+		} else if details, ok := live[event.BroadcasterUserID]; ok {
+			status = details
+		}
+	}
+	for i := range streams {
+		a.setStreamLive(&streams[i], isLive, status)
+	}
+	return nil
+}
+
+// untrackTwitchUser drops the eventsub subscriptions once no stream uses that twitch user
+func (a *App) untrackTwitchUser(streamUserID string) {
+	if a.TwitchEvents == nil || streamUserID == "" {
+		return
+	}
+
+	streams, err := a.Store.StreamsByUser(StreamTwitch, streamUserID)
+	if err != nil {
+		log.Error("Error counting streams for "+streamUserID, err)
+		return
+	}
+	if len(streams) > 0 {
+		return
+	}
+
+	err = a.TwitchEvents.Unsubscribe(streamUserID)
+	if err != nil {
+		log.Error("Error removing eventsub subscriptions for "+streamUserID, err)
+	}
+}
+
+// trackTwitchUser subscribes to online and offline events for a twitch user
+func (a *App) trackTwitchUser(streamUserID string) {
+	if a.TwitchEvents == nil || streamUserID == "" {
+		return
+	}
+
+	err := a.TwitchEvents.Subscribe(streamUserID)
+	if err != nil {
+		log.Error("Error creating eventsub subscriptions for "+streamUserID, err)
+	}
+}
+
+// syncEventSub subscribes to every tracked twitch user and drops stale subscriptions
+func (a *App) syncEventSub() {
+	userIDs, err := a.Store.StreamUserIDs(StreamTwitch)
+	if err != nil {
+		log.Error("Error loading twitch users for eventsub", err)
+		return
+	}
+
+	err = a.TwitchEvents.Sync(userIDs)
+	if err != nil {
+		log.Error("Error syncing eventsub subscriptions", err)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testEventSubSecret = "s3cr3tsecret"
+
+// fakeTwitchEventSub signs payloads the same way twitch does and posts them to handler
+func fakeTwitchEventSub(t *testing.T, handler http.Handler, secret string, messageType string, sentAt time.Time, payload string) *httptest.ResponseRecorder {
+	messageID := "e76c6bd4-55c9-4987-8304-da1588d8988b"
+	timestamp := sentAt.UTC().Format(time.RFC3339Nano)
+
+	req := httptest.NewRequest("POST", "/eventsub/twitch", strings.NewReader(payload))
+	req.Header.Set(eventSubHeaderMessageID, messageID)
+	req.Header.Set(eventSubHeaderMessageTimestamp, timestamp)
+	req.Header.Set(eventSubHeaderMessageSignature, signEventSub(secret, messageID, timestamp, []byte(payload)))
+	req.Header.Set(eventSubHeaderMessageType, messageType)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestEventSubChallenge(t *testing.T) {
+	handler := eventSubHandler(testEventSubSecret, func(string, eventSubEvent) error {
+		t.Errorf("onEvent should not be called for a challenge")
+		return nil
+	})
+
+	payload := `{"challenge":"pogchamp-kappa-360noscope-vohiyo","subscription":{"id":"f1c2a387-161a-49f9-a165-0f21d7a4e1c4","status":"webhook_callback_verification_pending","type":"stream.online","version":"1","condition":{"broadcaster_user_id":"12826"},"transport":{"method":"webhook","callback":"https://example.com/eventsub/twitch"}}}`
+	w := fakeTwitchEventSub(t, handler, testEventSubSecret, eventSubMessageVerification, time.Now(), payload)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("challenge status = %d; want %d", w.Code, http.StatusOK)
+	}
+	if w.Body.String() != "pogchamp-kappa-360noscope-vohiyo" {
+		t.Errorf("challenge body = %s; want pogchamp-kappa-360noscope-vohiyo", w.Body.String())
+	}
+}
+
+func TestEventSubNotification(t *testing.T) {
+	var gotType string
+	var gotEvent eventSubEvent
+	handler := eventSubHandler(testEventSubSecret, func(subscriptionType string, event eventSubEvent) error {
+		gotType = subscriptionType
+		gotEvent = event
+		return nil
+	})
+
+	payload := `{"subscription":{"id":"f1c2a387-161a-49f9-a165-0f21d7a4e1c4","status":"enabled","type":"stream.online","version":"1","condition":{"broadcaster_user_id":"1337"}},"event":{"id":"9001","broadcaster_user_id":"1337","broadcaster_user_login":"cool_user","type":"live","started_at":"2020-10-11T10:11:12.123Z"}}`
+	w := fakeTwitchEventSub(t, handler, testEventSubSecret, eventSubMessageNotification, time.Now(), payload)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("notification status = %d; want %d", w.Code, http.StatusNoContent)
+	}
+	if gotType != eventSubStreamOnline {
+		t.Errorf("subscription type = %s; want %s", gotType, eventSubStreamOnline)
+	}
+	if gotEvent.BroadcasterUserID != "1337" {
+		t.Errorf("broadcaster user id = %s; want 1337", gotEvent.BroadcasterUserID)
+	}
+}
+
+func TestEventSubRejected(t *testing.T) {
+	handler := eventSubHandler(testEventSubSecret, func(string, eventSubEvent) error {
+		t.Errorf("onEvent should not be called for a rejected message")
+		return nil
+	})
+	payload := `{"subscription":{"type":"stream.offline"},"event":{"broadcaster_user_id":"1337"}}`
+
+	items := [][]interface{}{
+		[]interface{}{"wrong secret", "not-the-secret", time.Now()},
+		[]interface{}{"replayed", testEventSubSecret, time.Now().Add(-time.Hour)},
+	}
+
+	for _, item := range items {
+		w := fakeTwitchEventSub(t, handler, item[1].(string), eventSubMessageNotification, item[2].(time.Time), payload)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s status = %d; want %d", item[0].(string), w.Code, http.StatusForbidden)
+		}
+	}
+}
+
+func TestEventSubSync(t *testing.T) {
+	var created []string
+	var deleted []string
+
+	helix := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			w.Write([]byte(`{"data":[
+				{"id":"keep","status":"enabled","type":"stream.online","condition":{"broadcaster_user_id":"1"},"transport":{"callback":"https://example.com/eventsub/twitch"}},
+				{"id":"failed","status":"webhook_callback_verification_failed","type":"stream.online","condition":{"broadcaster_user_id":"2"},"transport":{"callback":"https://example.com/eventsub/twitch"}},
+				{"id":"stale","status":"enabled","type":"stream.online","condition":{"broadcaster_user_id":"3"},"transport":{"callback":"https://example.com/eventsub/twitch"}},
+				{"id":"moved","status":"enabled","type":"stream.offline","condition":{"broadcaster_user_id":"1"},"transport":{"callback":"https://old.example.com/eventsub/twitch"}},
+				{"id":"staging","status":"enabled","type":"stream.online","condition":{"broadcaster_user_id":"4"},"transport":{"callback":"https://staging.example.com/eventsub/twitch"}}
+			],"pagination":{}}`))
+		case "POST":
+			var sub eventSubSubscription
+			b, _ := ioutil.ReadAll(r.Body)
+			json.Unmarshal(b, &sub)
+			if sub.Transport.Secret != testEventSubSecret {
+				t.Errorf("subscription secret = %s; want %s", sub.Transport.Secret, testEventSubSecret)
+			}
+			created = append(created, sub.Condition.BroadcasterUserID+" "+sub.Type)
+			w.WriteHeader(http.StatusAccepted)
+		case "DELETE":
+			deleted = append(deleted, r.URL.Query().Get("id"))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer helix.Close()
+
+	client := newEventSubClient(
+		&helixClient{baseURL: helix.URL, clientID: "client", httpClient: helix.Client()},
+		"https://example.com/eventsub/twitch",
+		testEventSubSecret,
+	)
+	err := client.Sync([]string{"1", "2", "1"})
+	if err != nil {
+		t.Fatalf("Sync() got an error: %s", err)
+	}
+
+	if strings.Join(deleted, ",") != "failed,stale" {
+		t.Errorf("deleted = %v; want [failed stale]", deleted)
+	}
+	if strings.Join(created, ",") != "1 stream.offline,2 stream.online,2 stream.offline" {
+		t.Errorf("created = %v; want [1 stream.offline 2 stream.online 2 stream.offline]", created)
+	}
+}
+
+func TestEventSubSubscribeConflict(t *testing.T) {
+	helix := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`{"error":"Conflict","status":409,"message":"subscription already exists"}`))
+	}))
+	defer helix.Close()
+
+	client := newEventSubClient(
+		&helixClient{baseURL: helix.URL, clientID: "client", httpClient: helix.Client()},
+		"https://example.com/eventsub/twitch",
+		testEventSubSecret,
+	)
+	err := client.Subscribe("1")
+	if err != nil {
+		t.Errorf("Subscribe() when already subscribed got an error: %s", err)
+	}
+	_, err = client.Subscriptions("1")
+	if e, ok := err.(helixError); !ok || e.StatusCode != http.StatusConflict {
+		t.Errorf("Subscriptions() error = %v; want the 409", err)
+	}
+}
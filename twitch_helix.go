@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	twitch "github.com/Onestay/go-new-twitch"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// helixClient makes requests to the twitch helix api with an app token.
+// The urls come from the config so it can be pointed at a fake helix.
+type helixClient struct {
+	baseURL    string
+	clientID   string
+	httpClient *http.Client
+}
+
+func newHelixClient(clientID string, clientSecret string, baseURL string, tokenURL string) *helixClient {
+	credentials := clientcredentials.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TokenURL:     tokenURL,
+	}
+	return &helixClient{
+		baseURL:    baseURL,
+		clientID:   clientID,
+		httpClient: credentials.Client(context.Background()),
+	}
+}
+
+// helixError is a response from helix that wasn't a success
+type helixError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Body       string
+}
+
+func (e helixError) Error() string {
+	return fmt.Sprintf("Twitch %s %s returned %d: %s", e.Method, e.Path, e.StatusCode, e.Body)
+}
+
+func (c *helixClient) do(method string, path string, body interface{}, out interface{}) error {
+	var reader *bytes.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Client-Id", c.clientID)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return helixError{method, path, resp.StatusCode, string(b)}
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// GetUsersByLogin looks up twitch users by their login name
+func (c *helixClient) GetUsersByLogin(logins ...string) ([]twitch.UserData, error) {
+	query := url.Values{}
+	for _, login := range logins {
+		query.Add("login", login)
+	}
+	var page struct {
+		Data []struct {
+			ID              string `json:"id"`
+			Login           string `json:"login"`
+			DisplayName     string `json:"display_name"`
+			Type            string `json:"type"`
+			BroadcasterType string `json:"broadcaster_type"`
+			Description     string `json:"description"`
+			ProfileImageURL string `json:"profile_image_url"`
+			OfflineImageURL string `json:"offline_image_url"`
+		} `json:"data"`
+	}
+	err := c.do("GET", "/users?"+query.Encode(), nil, &page)
+	if err != nil {
+		return nil, err
+	}
+
+	users := []twitch.UserData{}
+	for _, user := range page.Data {
+		users = append(users, twitch.UserData{
+			ID:              user.ID,
+			Login:           user.Login,
+			DisplayName:     user.DisplayName,
+			Type:            user.Type,
+			BroadcasterType: user.BroadcasterType,
+			Description:     user.Description,
+			ProfileImageURL: user.ProfileImageURL,
+			OfflineImageURL: user.OfflineImageURL,
+		})
+	}
+	return users, nil
+}
+
+// GetStreams returns the live streams matching input, only the user, game and paging filters are sent
+func (c *helixClient) GetStreams(input twitch.GetStreamsInput) ([]twitch.StreamData, error) {
+	query := url.Values{}
+	for _, id := range input.UserID {
+		query.Add("user_id", id)
+	}
+	for _, login := range input.UserLogin {
+		query.Add("user_login", login)
+	}
+	for _, id := range input.GameID {
+		query.Add("game_id", id)
+	}
+	if input.First > 0 {
+		query.Set("first", strconv.Itoa(input.First))
+	}
+	if input.After != "" {
+		query.Set("after", input.After)
+	}
+	var page struct {
+		Data []struct {
+			ID           string    `json:"id"`
+			UserID       string    `json:"user_id"`
+			GameID       string    `json:"game_id"`
+			Type         string    `json:"type"`
+			Title        string    `json:"title"`
+			ViewerCount  int       `json:"viewer_count"`
+			StartedAt    time.Time `json:"started_at"`
+			Language     string    `json:"language"`
+			ThumbnailURL string    `json:"thumbnail_url"`
+		} `json:"data"`
+	}
+	err := c.do("GET", "/streams?"+query.Encode(), nil, &page)
+	if err != nil {
+		return nil, err
+	}
+
+	streams := []twitch.StreamData{}
+	for _, stream := range page.Data {
+		streams = append(streams, twitch.StreamData{
+			ID:           stream.ID,
+			UserID:       stream.UserID,
+			GameID:       stream.GameID,
+			Type:         stream.Type,
+			Title:        stream.Title,
+			ViewerCount:  stream.ViewerCount,
+			StartedAt:    stream.StartedAt,
+			Language:     stream.Language,
+			ThumbnailURL: stream.ThumbnailURL,
+		})
+	}
+	return streams, nil
+}
+
+// GameNames looks up the names of twitch categories, the streams endpoint only has their ids
+func (c *helixClient) GameNames(gameIDs []string) (map[string]string, error) {
+	names := map[string]string{}
+	for start := 0; start < len(gameIDs); start += twitchStreamsPageSize {
+		end := start + twitchStreamsPageSize
+		if end > len(gameIDs) {
+			end = len(gameIDs)
+		}
+
+		query := url.Values{}
+		for _, id := range gameIDs[start:end] {
+			query.Add("id", id)
+		}
+		var page struct {
+			Data []struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"data"`
+		}
+		err := c.do("GET", "/games?"+query.Encode(), nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, game := range page.Data {
+			names[game.ID] = game.Name
+		}
+	}
+	return names, nil
+}
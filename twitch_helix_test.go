@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	twitch "github.com/Onestay/go-new-twitch"
+)
+
+func TestHelixGameNames(t *testing.T) {
+	helix := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/games" {
+			t.Errorf("GameNames called %s; want /games", r.URL.Path)
+		}
+		if strings.Join(r.URL.Query()["id"], ",") != "509670,1" {
+			t.Errorf("GameNames asked for %v; want [509670 1]", r.URL.Query()["id"])
+		}
+		w.Write([]byte(`{"data":[{"id":"509670","name":"Science & Technology"}]}`))
+	}))
+	defer helix.Close()
+
+	client := &helixClient{baseURL: helix.URL, clientID: "client", httpClient: helix.Client()}
+	names, err := client.GameNames([]string{"509670", "1"})
+	if err != nil {
+		t.Fatalf("GameNames() got an error: %s", err)
+	}
+	if len(names) != 1 || names["509670"] != "Science & Technology" {
+		t.Errorf("GameNames() = %v; want only Science & Technology", names)
+	}
+}
+
+func TestHelixClient(t *testing.T) {
+	helix := newFakeHelix(t)
+	helix.AddUser("halkeye", "1001")
+	helix.AddGame("509670", "Science & Technology")
+	startedAt := time.Date(2019, 5, 4, 18, 0, 0, 0, time.UTC)
+	helix.SetLive("1001", liveStatus{Title: "Coding", GameID: "509670", ViewerCount: 12, StartedAt: startedAt, ThumbnailURL: "https://example.com/{width}x{height}.jpg"})
+	client := newHelixClient("client", "secret", helix.APIURL(), helix.TokenURL())
+
+	users, err := client.GetUsersByLogin("halkeye", "nobody")
+	if err != nil {
+		t.Fatalf("GetUsersByLogin() got an error: %s", err)
+	}
+	if len(users) != 1 || users[0].ID != "1001" || users[0].Login != "halkeye" {
+		t.Errorf("GetUsersByLogin() = %v; want only halkeye", users)
+	}
+
+	streams, err := client.GetStreams(twitch.GetStreamsInput{UserID: []string{"1001", "1002"}, First: 100})
+	if err != nil {
+		t.Fatalf("GetStreams() got an error: %s", err)
+	}
+	if len(streams) != 1 || streams[0].UserID != "1001" || streams[0].Title != "Coding" || !streams[0].StartedAt.Equal(startedAt) {
+		t.Errorf("GetStreams() = %v; want halkeye's stream", streams)
+	}
+
+	provider := twitchProvider{api: client, games: client}
+	streamUserID, err := provider.ResolveUserID("halkeye")
+	if err != nil || streamUserID != "1001" {
+		t.Errorf("ResolveUserID(halkeye) = %s, %v; want 1001", streamUserID, err)
+	}
+	if _, err := provider.ResolveUserID("nobody"); err != errUnknownStreamUser {
+		t.Errorf("ResolveUserID(nobody) got %v; want errUnknownStreamUser", err)
+	}
+	live, err := provider.LiveStatus([]Stream{Stream{StreamUserID: "1001"}, Stream{StreamUserID: "1002"}})
+	if err != nil {
+		t.Fatalf("LiveStatus() got an error: %s", err)
+	}
+	want := liveStatus{Title: "Coding", GameID: "509670", Game: "Science & Technology", ViewerCount: 12, StartedAt: startedAt, ThumbnailURL: "https://example.com/640x360.jpg"}
+	if len(live) != 1 || !live["1001"].StartedAt.Equal(startedAt) {
+		t.Fatalf("LiveStatus() = %v; want only 1001 live", live)
+	}
+	got := live["1001"]
+	got.StartedAt = startedAt
+	if got != want {
+		t.Errorf("LiveStatus() = %+v; want %+v", got, want)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/getsentry/raven-go"
+	"github.com/gorilla/mux"
+)
+
+// widgetMaxAge is how long browsers and proxies can cache the widget
+const widgetMaxAge = time.Minute
+
+// apiWidget is the json version of the widget
+type apiWidget struct {
+	GuildID string      `json:"guild_id"`
+	Name    string      `json:"name"`
+	Live    []apiStream `json:"live"`
+}
+
+// publicLiveStreams returns a guild's live streams, but only if the guild made its dashboard public
+func (a *App) publicLiveStreams(guildID string) (*Guild, []Stream, error) {
+	guild, err := a.Store.GetGuild(guildID)
+	if err == errNotFound || (err == nil && !guild.PublicDashboard) {
+		return nil, nil, apiError{http.StatusNotFound, "Guild not found"}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	streams, err := a.Store.LiveStreams(guildID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return guild, streams, nil
+}
+
+// setWidgetHeaders lets the widget be cached briefly and embedded on any site
+func setWidgetHeaders(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(widgetMaxAge.Seconds())))
+	w.Header().Set("Content-Security-Policy", "frame-ancestors *")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+}
+
+func (a *App) widgetHandler(w http.ResponseWriter, r *http.Request) {
+	guild, streams, err := a.publicLiveStreams(mux.Vars(r)["guildID"])
+	if err != nil {
+		if _, ok := err.(apiError); !ok {
+			raven.CaptureErrorAndWait(err, nil)
+			log.Error("getting widget streams", err)
+		}
+		http.NotFound(w, r)
+		return
+	}
+
+	setWidgetHeaders(w)
+	err = widgetTemplate.Execute(w, map[string]interface{}{
+		"Guild":   guild,
+		"Streams": streams,
+	})
+	if err != nil {
+		raven.CaptureErrorAndWait(err, nil)
+		log.Error("error rendering template", err)
+	}
+}
+
+func (a *App) widgetJSONHandler(w http.ResponseWriter, r *http.Request) {
+	guild, streams, err := a.publicLiveStreams(mux.Vars(r)["guildID"])
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	setWidgetHeaders(w)
+	writeJSON(w, http.StatusOK, newAPIWidget(guild, streams))
+}
+
+func newAPIWidget(guild *Guild, streams []Stream) apiWidget {
+	widget := apiWidget{GuildID: guild.ID, Name: guild.Name, Live: []apiStream{}}
+	for _, stream := range streams {
+		widget.Live = append(widget.Live, newAPIStream(stream))
+	}
+	return widget
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWidget(t *testing.T) {
+	guild := &Guild{ID: "574047051608883214", Name: "Streamers <3", PublicDashboard: true}
+	streams := []Stream{
+		Stream{ID: 1, OwnerName: "halkeye", Type: StreamTwitch, StreamUsername: "halkeye", Live: true, Title: "Building a bot", Game: "Science & Technology", ViewerCount: 42},
+	}
+
+	var out bytes.Buffer
+	err := widgetTemplate.Execute(&out, map[string]interface{}{"Guild": guild, "Streams": streams})
+	if err != nil {
+		t.Fatalf("widgetTemplate got an error: %s", err)
+	}
+	for _, want := range []string{"Live on Streamers &lt;3", `href="https://www.twitch.tv/halkeye"`, "Science &amp; Technology - 42 viewers - Building a bot"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("widgetTemplate output is missing %q", want)
+		}
+	}
+
+	b, _ := json.Marshal(newAPIWidget(guild, nil))
+	if string(b) != `{"guild_id":"574047051608883214","name":"Streamers \u003c3","live":[]}` {
+		t.Errorf("newAPIWidget() with nobody live = %s; want an empty live list", b)
+	}
+}
+
+func TestWidgetHeaders(t *testing.T) {
+	w := httptest.NewRecorder()
+	setWidgetHeaders(w)
+
+	if w.Header().Get("Cache-Control") != "public, max-age=60" {
+		t.Errorf("Cache-Control = %s; want public, max-age=60", w.Header().Get("Cache-Control"))
+	}
+	if w.Header().Get("X-Frame-Options") != "" || w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("widget headers = %v; want it embeddable from any site", w.Header())
+	}
+}